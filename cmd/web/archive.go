@@ -0,0 +1,98 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"io"
+	"path"
+	"time"
+)
+
+// archiveFormat is a kind of archive snippets can be downloaded as. newWriter returns a writer of such an archive
+// to w, storing the files in the directory dir of the archive, all dated modTime.
+type archiveFormat struct {
+	contentType string
+	newWriter   func(w io.Writer, dir string, modTime time.Time) archiveWriter
+}
+
+// archiveWriter writes files to an archive one at a time, as they are read, so neither the archive nor the
+// contents of the files are ever all held in memory. Close must be called once every file is written.
+type archiveWriter interface {
+	WriteFile(f *models.File) error
+	Close() error
+}
+
+// archiveFormats are the formats snippets can be downloaded in, by extension.
+var archiveFormats = map[string]archiveFormat{
+	"zip":    {"application/zip", newZipWriter},
+	"tar.gz": {"application/gzip", newTarGzWriter},
+}
+
+// zipWriter writes a zip archive. Each file is compressed and written as it comes.
+type zipWriter struct {
+	zw      *zip.Writer
+	dir     string
+	modTime time.Time
+}
+
+func newZipWriter(w io.Writer, dir string, modTime time.Time) archiveWriter {
+	return &zipWriter{zw: zip.NewWriter(w), dir: dir, modTime: modTime}
+}
+
+func (aw *zipWriter) WriteFile(f *models.File) error {
+	fw, err := aw.zw.CreateHeader(&zip.FileHeader{
+		Name:     path.Join(aw.dir, f.Name),
+		Method:   zip.Deflate,
+		Modified: aw.modTime,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(fw, f.Content)
+	return err
+}
+
+func (aw *zipWriter) Close() error {
+	return aw.zw.Close()
+}
+
+// tarGzWriter writes a gzip compressed tar archive, streamed like zipWriter.
+type tarGzWriter struct {
+	gw      *gzip.Writer
+	tw      *tar.Writer
+	dir     string
+	modTime time.Time
+}
+
+func newTarGzWriter(w io.Writer, dir string, modTime time.Time) archiveWriter {
+	gw := gzip.NewWriter(w)
+	return &tarGzWriter{gw: gw, tw: tar.NewWriter(gw), dir: dir, modTime: modTime}
+}
+
+func (aw *tarGzWriter) WriteFile(f *models.File) error {
+	err := aw.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     path.Join(aw.dir, f.Name),
+		Mode:     0644,
+		Size:     int64(len(f.Content)),
+		ModTime:  aw.modTime,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(aw.tw, f.Content)
+	return err
+}
+
+func (aw *tarGzWriter) Close() error {
+	err := aw.tw.Close()
+	if err != nil {
+		return err
+	}
+
+	return aw.gw.Close()
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+var archiveFiles = []*models.File{
+	{Position: 1, Name: "Dockerfile", Content: "FROM golang"},
+	{Position: 2, Name: "run.sh", Content: "go run ."},
+}
+
+var archiveModTime = time.Date(2021, 6, 17, 10, 30, 0, 0, time.UTC)
+
+// writeArchive writes archiveFiles to an archive, one at a time.
+func writeArchive(t *testing.T, aw archiveWriter) {
+	for _, f := range archiveFiles {
+		err := aw.WriteFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := aw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteZip(t *testing.T) {
+	var buf bytes.Buffer
+	writeArchive(t, newZipWriter(&buf, "snippet-1", archiveModTime))
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(zr.File) != len(archiveFiles) {
+		t.Fatalf("want %d files; got %d", len(archiveFiles), len(zr.File))
+	}
+	for i, zf := range zr.File {
+		want := archiveFiles[i]
+		if zf.Name != "snippet-1/"+want.Name {
+			t.Errorf("want name %q; got %q", "snippet-1/"+want.Name, zf.Name)
+		}
+		if !zf.Modified.Equal(archiveModTime) {
+			t.Errorf("want modification time %v; got %v", archiveModTime, zf.Modified)
+		}
+
+		rc, err := zf.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != want.Content {
+			t.Errorf("want content %q; got %q", want.Content, content)
+		}
+	}
+}
+
+func TestWriteTarGz(t *testing.T) {
+	var buf bytes.Buffer
+	writeArchive(t, newTarGzWriter(&buf, "snippet-1", archiveModTime))
+
+	gr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gr)
+
+	for _, want := range archiveFiles {
+		hdr, err := tr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Name != "snippet-1/"+want.Name {
+			t.Errorf("want name %q; got %q", "snippet-1/"+want.Name, hdr.Name)
+		}
+		if !hdr.ModTime.Equal(archiveModTime) {
+			t.Errorf("want modification time %v; got %v", archiveModTime, hdr.ModTime)
+		}
+
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != want.Content {
+			t.Errorf("want content %q; got %q", want.Content, content)
+		}
+	}
+
+	if _, err := tr.Next(); err != io.EOF {
+		t.Errorf("want the end of the archive; got %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"github.com/luca0x333/go-snippetbox/pkg/forms"
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Types of the events written to the audit log.
+const (
+	auditLogin              = "user.login"
+	auditLoginSSO           = "user.login_sso"
+	auditLoginFailed        = "user.login_failed"
+	auditLoginThrottled     = "user.login_throttled"
+	auditSignup             = "user.signup"
+	auditLogout             = "user.logout"
+	auditPasswordChange     = "user.password_change"
+	auditSessionRevoke      = "user.session_revoke"
+	auditSessionRevokeAll   = "user.session_revoke_all"
+	auditSnippetCreate      = "snippet.create"
+	auditSnippetEdit        = "snippet.edit"
+	auditSnippetFork        = "snippet.fork"
+	auditOrgCreate          = "org.create"
+	auditOrgInvite          = "org.invite"
+	auditOrgJoin            = "org.join"
+	auditOrgRemoveMember    = "org.member_remove"
+	auditAdminActivate      = "admin.user.activate"
+	auditAdminDeactivate    = "admin.user.deactivate"
+	auditAdminUnlock        = "admin.user.unlock"
+	auditAdminDeleteSnippet = "admin.snippet.delete"
+	auditAdminDeleteComment = "admin.comment.delete"
+)
+
+// auditEvents lists every event type, in the order they are offered in the audit log filter.
+var auditEvents = []string{
+	auditLogin,
+	auditLoginSSO,
+	auditLoginFailed,
+	auditLoginThrottled,
+	auditSignup,
+	auditLogout,
+	auditPasswordChange,
+	auditSessionRevoke,
+	auditSessionRevokeAll,
+	auditSnippetCreate,
+	auditSnippetEdit,
+	auditSnippetFork,
+	auditOrgCreate,
+	auditOrgInvite,
+	auditOrgJoin,
+	auditOrgRemoveMember,
+	auditAdminActivate,
+	auditAdminDeactivate,
+	auditAdminUnlock,
+	auditAdminDeleteSnippet,
+	auditAdminDeleteComment,
+}
+
+// Layout of the dates used to filter the audit log, as sent by <input type='date'>.
+const auditDateLayout = "2006-01-02"
+
+var digitsRX = regexp.MustCompile(`^[0-9]+$`)
+
+// auditFilter validates the audit log filter sent in a query string and converts it to a models.AuditFilter.
+// The "to" date is inclusive.
+func auditFilter(form *forms.Form) models.AuditFilter {
+	form.MatchesPattern("user", digitsRX)
+	form.PermittedValues("event", auditEvents...)
+	form.ValidDate("from", auditDateLayout)
+	form.ValidDate("to", auditDateLayout)
+
+	filter := models.AuditFilter{}
+	if !form.Valid() {
+		return filter
+	}
+
+	filter.UserID, _ = strconv.Atoi(form.Get("user"))
+	filter.Event = form.Get("event")
+	if from := form.Get("from"); from != "" {
+		filter.From, _ = time.Parse(auditDateLayout, from)
+	}
+	if to := form.Get("to"); to != "" {
+		t, _ := time.Parse(auditDateLayout, to)
+		filter.To = t.AddDate(0, 0, 1)
+	}
+
+	return filter
+}
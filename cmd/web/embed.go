@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Sizes of the frames showing embedded snippets, in pixels. The height is estimated from the lines of the files
+// and capped, the frame scrolls past it.
+const (
+	embedWidth      = 600
+	embedMaxHeight  = 500
+	embedHeaderSize = 40
+	embedFileSize   = 36
+	embedLineSize   = 18
+)
+
+// embedHeight returns the estimated height of the frame showing a snippet.
+func embedHeight(s *models.Snippet) int {
+	height := embedHeaderSize
+	for _, f := range s.Files {
+		height += embedFileSize
+		if !f.Binary {
+			height += len(splitLines(f.Content)) * embedLineSize
+		}
+	}
+
+	if height > embedMaxHeight {
+		return embedMaxHeight
+	}
+	return height
+}
+
+// embedSnippet shows a public snippet on its own, in a page other sites can show in a frame. The page is
+// stateless: the session isn't loaded, so the viewer is anonymous and no flash message is consumed.
+func (app *application) embedSnippet(w http.ResponseWriter, r *http.Request) {
+	s := app.publicSnippet(w, r)
+	if s == nil {
+		return
+	}
+
+	app.countView(r, s)
+	app.renderPage(w, "embed.page.tmpl", &templateData{
+		Files:   numberFiles(s.Files, s.Revision, nil),
+		Snippet: s,
+	})
+}
+
+// embedLoader is the script sent by embedScript. It adds a frame showing the snippet after the script element,
+// and resizes it to the height the embedded page reports.
+const embedLoader = `(function () {
+	var script = document.currentScript;
+	var frame = document.createElement('iframe');
+	frame.src = %s;
+	frame.title = %s;
+	frame.width = '100%%';
+	frame.height = '%d';
+	frame.style.border = '0';
+	script.parentNode.insertBefore(frame, script.nextSibling);
+
+	window.addEventListener('message', function (event) {
+		if (event.origin !== %s || event.source !== frame.contentWindow) {
+			return;
+		}
+		if (event.data && event.data.snippetbox === 'resize') {
+			frame.height = String(event.data.height);
+		}
+	});
+})();
+`
+
+// embedScript sends a script embedding a public snippet where it is included, ex:
+//
+//	<script src="https://snippetbox.example/snippet/1/embed.js"></script>
+func (app *application) embedScript(w http.ResponseWriter, r *http.Request) {
+	s := app.publicSnippet(w, r)
+	if s == nil {
+		return
+	}
+
+	// JSON strings are valid JavaScript strings, and escape "<" so the script can't be closed early.
+	src, _ := json.Marshal(fmt.Sprintf("%s/snippet/%d/embed", app.baseURL, s.ID))
+	title, _ := json.Marshal(s.Title)
+	origin, _ := json.Marshal(siteOrigin(app.baseURL))
+
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	fmt.Fprintf(w, embedLoader, src, title, embedHeight(s), origin)
+}
+
+// siteOrigin returns the origin of a URL, its scheme and host, as browsers report it.
+func siteOrigin(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	return u.Scheme + "://" + u.Host
+}
+
+// oembedResponse is a "rich" oEmbed response, see https://oembed.com.
+type oembedResponse struct {
+	Version      string `json:"version"`
+	Type         string `json:"type"`
+	ProviderName string `json:"provider_name"`
+	ProviderURL  string `json:"provider_url"`
+	Title        string `json:"title"`
+	AuthorName   string `json:"author_name,omitempty"`
+	AuthorURL    string `json:"author_url,omitempty"`
+	HTML         string `json:"html"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+}
+
+// snippetPathRX matches the paths of the pages of snippets which can be embedded, capturing the snippet ID.
+var snippetPathRX = regexp.MustCompile(`^/snippet/([1-9][0-9]*)(?:/embed)?/?$`)
+
+// oembedSnippetID returns the ID of the snippet a URL links to, if it is the URL of a snippet on this site.
+func (app *application) oembedSnippetID(rawURL string) (int, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return 0, false
+	}
+
+	site, err := url.Parse(app.baseURL)
+	if err != nil || !strings.EqualFold(u.Host, site.Host) {
+		return 0, false
+	}
+
+	match := snippetPathRX.FindStringSubmatch(u.Path)
+	if match == nil {
+		return 0, false
+	}
+
+	id, err := strconv.Atoi(match[1])
+	return id, err == nil
+}
+
+// oembed describes how to embed the public snippet linked to by the "url" query string parameter, so other
+// services can show rich previews of the links to snippets. The "maxwidth" and "maxheight" parameters limit the
+// size of the frame; JSON is the only format supported.
+func (app *application) oembed(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if format := q.Get("format"); format != "" && format != "json" {
+		app.clientError(w, http.StatusNotImplemented)
+		return
+	}
+
+	id, ok := app.oembedSnippetID(q.Get("url"))
+	if !ok {
+		app.notFound(w)
+		return
+	}
+
+	s, err := app.snippets.Get(id, 0)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	rs := &oembedResponse{
+		Version:      "1.0",
+		Type:         "rich",
+		ProviderName: "Snippetbox",
+		ProviderURL:  app.baseURL,
+		Title:        s.Title,
+		Width:        embedWidth,
+		Height:       embedHeight(s),
+	}
+
+	if s.UserID != 0 {
+		author, err := app.users.Get(s.UserID)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, err)
+			return
+		}
+		if author != nil {
+			rs.AuthorName = author.Name
+			rs.AuthorURL = fmt.Sprintf("%s/u/%d", app.baseURL, author.ID)
+		}
+	}
+
+	if max, err := strconv.Atoi(q.Get("maxwidth")); err == nil && max > 0 && max < rs.Width {
+		rs.Width = max
+	}
+	if max, err := strconv.Atoi(q.Get("maxheight")); err == nil && max > 0 && max < rs.Height {
+		rs.Height = max
+	}
+
+	rs.HTML = fmt.Sprintf(`<iframe src="%s" width="%d" height="%d" title="%s" style="border: 0"></iframe>`,
+		html.EscapeString(fmt.Sprintf("%s/snippet/%d/embed", app.baseURL, s.ID)), rs.Width, rs.Height,
+		html.EscapeString(s.Title))
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(rs)
+	if err != nil {
+		app.errorLog.Output(2, err.Error())
+	}
+}
+
+// snippetSummary returns the beginning of the first text file of a snippet on a single line, to describe it in
+// the previews of links to it.
+func snippetSummary(s *models.Snippet) string {
+	const maxLength = 200
+
+	for _, f := range s.Files {
+		if f.Binary {
+			continue
+		}
+
+		summary := strings.Join(strings.Fields(f.Content), " ")
+		if runes := []rune(summary); len(runes) > maxLength {
+			summary = string(runes[:maxLength-1]) + "…"
+		}
+		return summary
+	}
+
+	return ""
+}
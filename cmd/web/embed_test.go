@@ -0,0 +1,49 @@
+package main
+
+import (
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"strings"
+	"testing"
+)
+
+func TestEmbedHeight(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []*models.File
+		want  int
+	}{
+		{"Three lines", []*models.File{{Content: "1\n2\n3\n"}}, embedHeaderSize + embedFileSize + 3*embedLineSize},
+		{"Binary file", []*models.File{{Content: "\x89PNG", Binary: true}}, embedHeaderSize + embedFileSize},
+		{"Long file", []*models.File{{Content: strings.Repeat("line\n", 100)}}, embedMaxHeight},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := embedHeight(&models.Snippet{Files: tt.files}); got != tt.want {
+				t.Errorf("want %d; got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSnippetSummary(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []*models.File
+		want  string
+	}{
+		{"No files", nil, ""},
+		{"Single line", []*models.File{{Content: "An old silent pond...\n  A frog jumps\tin"}},
+			"An old silent pond... A frog jumps in"},
+		{"Binary files skipped", []*models.File{{Content: "\x89PNG", Binary: true}, {Content: "Notes"}}, "Notes"},
+		{"Truncated", []*models.File{{Content: strings.Repeat("é", 300)}}, strings.Repeat("é", 199) + "…"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := snippetSummary(&models.Snippet{Files: tt.files}); got != tt.want {
+				t.Errorf("want %q; got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/luca0x333/go-snippetbox/pkg/forms"
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// maxSnippetFiles is the maximum number of files of a snippet.
+const maxSnippetFiles = 10
+
+// languages are the languages a file can be written in. An empty language is plain text.
+var languages = []string{
+	"bash", "c", "cpp", "css", "dockerfile", "go", "html", "ini", "java", "javascript", "json", "makefile",
+	"markdown", "python", "ruby", "rust", "sql", "toml", "typescript", "xml", "yaml",
+}
+
+// languageNames and languageExtensions map file names and extensions to the language they are usually written in.
+var (
+	languageNames = map[string]string{
+		"dockerfile": "dockerfile",
+		"makefile":   "makefile",
+	}
+	languageExtensions = map[string]string{
+		".bash": "bash", ".sh": "bash", ".c": "c", ".h": "c", ".cc": "cpp", ".cpp": "cpp", ".hpp": "cpp",
+		".css": "css", ".go": "go", ".htm": "html", ".html": "html", ".cfg": "ini", ".conf": "ini", ".ini": "ini",
+		".java": "java", ".js": "javascript", ".mjs": "javascript", ".json": "json", ".md": "markdown",
+		".py": "python", ".rb": "ruby", ".rs": "rust", ".sql": "sql", ".toml": "toml", ".ts": "typescript",
+		".xml": "xml", ".yaml": "yaml", ".yml": "yaml",
+	}
+)
+
+// detectLanguage guesses the language of a file from its name, ex: "go" for "main.go". It returns an empty
+// string, meaning plain text, when the name isn't recognised.
+func detectLanguage(name string) string {
+	name = strings.ToLower(name)
+	if language, ok := languageNames[name]; ok {
+		return language
+	}
+
+	return languageExtensions[path.Ext(name)]
+}
+
+// The fields of a snippet form describing its files. Each of them is repeated once per file, in order.
+// file_binary is "true" for binary files, whose content is then base64 encoded since it can't be edited as text.
+const (
+	fileNameField     = "file_name"
+	fileLanguageField = "file_language"
+	fileContentField  = "file_content"
+	fileBinaryField   = "file_binary"
+)
+
+// fileUploadField is the field of a snippet form to upload the content of a file, with the position of the file
+// as suffix, ex: "file_upload.2". Browsers don't send empty file fields, so they can't be aligned by order.
+const fileUploadField = "file_upload"
+
+// fileError returns the key of the errors of a field of the file at position in a snippet form,
+// ex: "file_name.2".
+func fileError(field string, position int) string {
+	return fmt.Sprintf("%s.%d", field, position)
+}
+
+// parseFiles returns the files described by a snippet form, in order. It doesn't validate them, a binary file
+// whose content can't be decoded is left empty.
+func parseFiles(form *forms.Form) []*models.File {
+	names := form.Values[fileNameField]
+	langs := form.Values[fileLanguageField]
+	contents := form.Values[fileContentField]
+	binaries := form.Values[fileBinaryField]
+
+	n := len(names)
+	if len(contents) > n {
+		n = len(contents)
+	}
+
+	files := []*models.File{}
+	for i := 0; i < n; i++ {
+		f := &models.File{Position: i + 1}
+		if i < len(names) {
+			f.Name = strings.TrimSpace(names[i])
+		}
+		if i < len(langs) {
+			f.Language = langs[i]
+		}
+		if i < len(contents) {
+			f.Content = contents[i]
+		}
+		if i < len(binaries) && binaries[i] == "true" {
+			content, _ := base64.StdEncoding.DecodeString(f.Content)
+			f.Content, f.Binary = string(content), true
+		}
+
+		files = append(files, f)
+	}
+
+	return files
+}
+
+// validateFiles checks the files of a snippet form and adds an error to the form for every invalid field, under
+// the key returned by fileError. Errors about the files as a whole go under the "files" key.
+// The upload policy applies to every file, whether it was uploaded, typed or posted back base64 encoded. Binary
+// files are only accepted when the policy refuses them if they are identical to one of kept: the files of the
+// snippet edited, or of the template the snippet started from.
+// Files without a language get the one detected from their name.
+func (app *application) validateFiles(form *forms.Form, files, kept []*models.File) {
+	if len(files) == 0 {
+		form.Errors.Add("files", "A snippet needs at least one file")
+	}
+	if len(files) > maxSnippetFiles {
+		form.Errors.Add("files", fmt.Sprintf("A snippet can't have more than %d files", maxSnippetFiles))
+	}
+
+	keptBinaries := map[string]bool{}
+	for _, f := range kept {
+		if f.Binary {
+			keptBinaries[f.Content] = true
+		}
+	}
+
+	names := map[string]bool{}
+	for _, f := range files {
+		nameError := fileError(fileNameField, f.Position)
+		switch {
+		case f.Name == "":
+			form.Errors.Add(nameError, "This field cannot be blank")
+		case len([]rune(f.Name)) > 100:
+			form.Errors.Add(nameError, "This field is too long (maximum is 100 characters)")
+		case strings.ContainsAny(f.Name, `/\`) || f.Name == "." || f.Name == "..":
+			form.Errors.Add(nameError, "This field cannot contain slashes")
+		case names[strings.ToLower(f.Name)]:
+			form.Errors.Add(nameError, "Another file already has this name")
+		}
+		names[strings.ToLower(f.Name)] = true
+
+		contentError := fileError(fileContentField, f.Position)
+		switch {
+		case f.Content == "" || !f.Binary && strings.TrimSpace(f.Content) == "":
+			form.Errors.Add(contentError, "This field cannot be blank")
+		case int64(len(f.Content)) > app.uploads.maxFileSize:
+			form.Errors.Add(contentError,
+				fmt.Sprintf("This file is too large (maximum is %s)", forms.FormatSize(app.uploads.maxFileSize)))
+		case f.Binary && !app.uploads.allowBinary && !keptBinaries[f.Content]:
+			form.Errors.Add(contentError, "This type of file is not permitted")
+		}
+
+		if f.Language == "" {
+			f.Language = detectLanguage(f.Name)
+		} else if !permitted(f.Language, languages) {
+			form.Errors.Add(fileError(fileLanguageField, f.Position), "This field is invalid")
+		}
+	}
+}
+
+// permitted reports whether value is one of values.
+func permitted(value string, values []string) bool {
+	for _, v := range values {
+		if value == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fileAction applies the file button pressed to submit a snippet form, if any: "add-file" adds an empty file
+// and "remove-file-N" removes the file at position N. It reports whether a button was pressed, in which case
+// the form must be shown again instead of being saved.
+func fileAction(form *forms.Form, files []*models.File) ([]*models.File, bool) {
+	action := form.Get("action")
+
+	switch {
+	case action == "add-file":
+		if len(files) < maxSnippetFiles {
+			files = append(files, &models.File{})
+		}
+	case strings.HasPrefix(action, "remove-file-"):
+		position, err := strconv.Atoi(strings.TrimPrefix(action, "remove-file-"))
+		if err == nil && position >= 1 && position <= len(files) && len(files) > 1 {
+			files = append(files[:position-1], files[position:]...)
+		}
+	default:
+		return files, false
+	}
+
+	for i, f := range files {
+		f.Position = i + 1
+	}
+
+	return files, true
+}
+
+// fileNamed returns the file of files with the given name, or nil if there is none.
+func fileNamed(files []*models.File, name string) *models.File {
+	for _, f := range files {
+		if f.Name == name {
+			return f
+		}
+	}
+
+	return nil
+}
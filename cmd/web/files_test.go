@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/base64"
+	"github.com/luca0x333/go-snippetbox/pkg/forms"
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"main.go", "go"},
+		{"Dockerfile", "dockerfile"},
+		{"docker-compose.YML", "yaml"},
+		{"notes", ""},
+		{"archive.tar.gz", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectLanguage(tt.name); got != tt.want {
+				t.Errorf("want %q; got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestValidateFiles(t *testing.T) {
+	form := forms.New(url.Values{
+		"file_name":     {"run.sh", "", "RUN.sh", "config"},
+		"file_language": {"", "go", "", "cobol"},
+		"file_content":  {"go run .", "package main", "", "port: 4000"},
+	})
+
+	files := parseFiles(form)
+	newTestApplication(t).validateFiles(form, files, nil)
+
+	tests := []struct {
+		field string
+		want  string
+	}{
+		{"file_name.1", ""},
+		{"file_name.2", "This field cannot be blank"},
+		{"file_name.3", "Another file already has this name"},
+		{"file_content.3", "This field cannot be blank"},
+		{"file_language.4", "This field is invalid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			if got := form.Errors.Get(tt.field); got != tt.want {
+				t.Errorf("want %q; got %q", tt.want, got)
+			}
+		})
+	}
+
+	// Files without a language get the one of their name.
+	if files[0].Language != "bash" {
+		t.Errorf("want language %q; got %q", "bash", files[0].Language)
+	}
+}
+
+func TestFileAction(t *testing.T) {
+	newForm := func(action string) *forms.Form {
+		return forms.New(url.Values{
+			"file_name":    {"one.txt", "two.txt"},
+			"file_content": {"one", "two"},
+			"action":       {action},
+		})
+	}
+
+	tests := []struct {
+		name        string
+		action      string
+		wantChanged bool
+		wantNames   []string
+	}{
+		{"No action", "", false, []string{"one.txt", "two.txt"}},
+		{"Add file", "add-file", true, []string{"one.txt", "two.txt", ""}},
+		{"Remove file", "remove-file-1", true, []string{"two.txt"}},
+		{"Remove non-existent file", "remove-file-3", true, []string{"one.txt", "two.txt"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := newForm(tt.action)
+			files, changed := fileAction(form, parseFiles(form))
+
+			if changed != tt.wantChanged {
+				t.Errorf("want changed %t; got %t", tt.wantChanged, changed)
+			}
+
+			if len(files) != len(tt.wantNames) {
+				t.Fatalf("want %d files; got %d", len(tt.wantNames), len(files))
+			}
+			for i, f := range files {
+				if f.Name != tt.wantNames[i] || f.Position != i+1 {
+					t.Errorf("want file %d to be %q; got %q at position %d", i+1, tt.wantNames[i], f.Name,
+						f.Position)
+				}
+			}
+		})
+	}
+}
+
+func TestParseBinaryFiles(t *testing.T) {
+	form := forms.New(url.Values{
+		"file_name":     {"notes.txt", "image.png", "broken.png"},
+		"file_language": {"", "", ""},
+		"file_content":  {"iVBORw0KGgo=", "iVBORw0KGgo=", "not base64"},
+		"file_binary":   {"", "true", "true"},
+	})
+
+	app := newTestApplication(t)
+	app.uploads.allowBinary = true
+
+	files := parseFiles(form)
+	app.validateFiles(form, files, nil)
+
+	// Text files keep their content as it is.
+	if files[0].Binary || files[0].Content != "iVBORw0KGgo=" {
+		t.Errorf("want the text file unchanged; got %+v", files[0])
+	}
+
+	if !files[1].Binary || files[1].Content != "\x89PNG\r\n\x1a\n" {
+		t.Errorf("want the binary file decoded; got %+v", files[1])
+	}
+
+	if got := form.Errors.Get("file_content.3"); got != "This field cannot be blank" {
+		t.Errorf("want the undecodable file to be empty; got error %q", got)
+	}
+	// Unless binary files are allowed, posting one base64 encoded doesn't get around the upload policy.
+	app.uploads.allowBinary = false
+	form.Errors = map[string][]string{}
+	app.validateFiles(form, files, nil)
+	if got := form.Errors.Get("file_content.2"); got != "This type of file is not permitted" {
+		t.Errorf("want the binary file refused; got error %q", got)
+	}
+}
+
+func TestValidateFilesUploadPolicy(t *testing.T) {
+	app := newTestApplication(t)
+	kept := []*models.File{{Position: 1, Name: "logo.png", Content: "\x89PNG\r\n\x1a\n", Binary: true}}
+
+	tests := []struct {
+		name        string
+		content     string
+		binary      string
+		allowBinary bool
+		want        string
+	}{
+		{"Text", "An old silent pond...", "", false, ""},
+		{"Text too large", strings.Repeat("a", 1<<10+1), "", false, "This file is too large (maximum is 1 KB)"},
+		{"Binary posted base64 encoded", "R0lGODlh", "true", false, "This type of file is not permitted"},
+		{"Binary allowed", "R0lGODlh", "true", true, ""},
+		{"Binary too large", base64.StdEncoding.EncodeToString(make([]byte, 1<<10+1)), "true", true,
+			"This file is too large (maximum is 1 KB)"},
+		{"Binary kept", "iVBORw0KGgo=", "true", false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app.uploads.allowBinary = tt.allowBinary
+			form := forms.New(url.Values{
+				"file_name":    {"file"},
+				"file_content": {tt.content},
+				"file_binary":  {tt.binary},
+			})
+
+			app.validateFiles(form, parseFiles(form), kept)
+
+			if got := form.Errors.Get("file_content.1"); got != tt.want {
+				t.Errorf("want %q; got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -1,180 +1,1911 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/luca0x333/go-snippetbox/pkg/forms"
 	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"github.com/luca0x333/go-snippetbox/pkg/oidc"
+	"mime"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 )
 
 func (app *application) home(w http.ResponseWriter, r *http.Request) {
-	s, err := app.snippets.Latest()
+	// The latest snippets are listed by default, "?sort=popular" lists the most starred ones.
+	sort := r.URL.Query().Get("sort")
+
+	var s []*models.Snippet
+	var err error
+	switch sort {
+	case "":
+		s, err = app.snippets.Latest()
+	case "popular":
+		s, err = app.snippets.Popular()
+	default:
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
 	// Call the render helper.
-	app.render(w, r, "home.page.tmpl", &templateData{Snippets: s})
+	app.render(w, r, "home.page.tmpl", &templateData{Snippets: s, Sort: sort})
 }
 
-func (app *application) showSnippet(w http.ResponseWriter, r *http.Request) {
+// rankingPageSize is the number of snippets listed on the trending and popular pages.
+const rankingPageSize = 20
+
+// trending lists the snippets gaining the most views and stars lately.
+func (app *application) trending(w http.ResponseWriter, r *http.Request) {
+	app.renderRanking(w, r, models.RankingTrending)
+}
+
+// popular lists the snippets with the most views and stars during the period picked by the "range" query string
+// parameter: "week", the default, "month" or "all".
+func (app *application) popular(w http.ResponseWriter, r *http.Request) {
+	ranking := r.URL.Query().Get("range")
+	switch ranking {
+	case "":
+		ranking = models.RankingWeek
+	case models.RankingWeek, models.RankingMonth, models.RankingAll:
+	default:
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	app.renderRanking(w, r, ranking)
+}
+
+// renderRanking renders the page of a ranking, as computed by the last run of rankSnippets.
+func (app *application) renderRanking(w http.ResponseWriter, r *http.Request, ranking string) {
+	s, err := app.rankings.Get(ranking, rankingPageSize)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, r, "ranking.page.tmpl", &templateData{Ranking: ranking, Snippets: s})
+}
+
+// snippet returns the snippet identified by the ":id" parameter, if the current user can see it.
+// Otherwise it sends a 404 Not Found response and returns nil.
+func (app *application) snippet(w http.ResponseWriter, r *http.Request) *models.Snippet {
+	return app.snippetVisibleTo(w, r, app.viewerID(r), app.snippets.Get)
+}
+
+// publicSnippet is like snippet, for anonymous users: it only returns the snippets anyone can see, as pages shown
+// on other sites must.
+func (app *application) publicSnippet(w http.ResponseWriter, r *http.Request) *models.Snippet {
+	return app.snippetVisibleTo(w, r, 0, app.snippets.Get)
+}
+
+// snippetVisibleTo fetches the snippet with get, ex: app.snippets.Find to leave its files out.
+func (app *application) snippetVisibleTo(w http.ResponseWriter, r *http.Request, viewerID int,
+	get func(int, int) (*models.Snippet, error)) *models.Snippet {
 	// Pat does not strip the colon from "id".
 	// We need to get the value of ":id" from the query string:
 	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
 	if err != nil || id < 1 {
 		app.notFound(w) // Use the notFound() helper.
-		return
+		return nil
 	}
 
-	s, err := app.snippets.Get(id)
+	s, err := get(id, viewerID)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
 			app.notFound(w)
 		} else {
 			app.serverError(w, err)
 		}
+		return nil
+	}
+
+	return s
+}
+
+func (app *application) showSnippet(w http.ResponseWriter, r *http.Request) {
+	s := app.snippet(w, r)
+	if s == nil {
 		return
 	}
 
-	// Call the render helper.
-	app.render(w, r, "show.page.tmpl", &templateData{Snippet: s})
+	rev, ok := app.revision(w, r, s)
+	if !ok {
+		return
+	}
+
+	app.countView(r, s)
+	app.renderSnippet(w, r, s, rev, forms.New(nil))
 }
 
-func (app *application) createSnippetForm(w http.ResponseWriter, r *http.Request) {
-	app.render(w, r, "create.page.tmpl", &templateData{
-		// New empty forms.Form object
-		Form: forms.New(nil),
-	})
+// revision returns the earlier revision of a snippet asked for by the "rev" query string parameter, so comments on
+// it can be read in context. It returns nil without the parameter or when it asks for the current revision.
+// If there is no such revision, it sends a 404 Not Found response and returns false.
+func (app *application) revision(w http.ResponseWriter, r *http.Request, s *models.Snippet) (*models.Revision, bool) {
+	return app.revisionWith(w, r, s, app.snippets.Revision)
 }
 
-func (app *application) createSnippet(w http.ResponseWriter, r *http.Request) {
-	// Call ParseForm() to add any data in POST request bodies to r.PostForm map.
-	err := r.ParseForm()
+// revisionWith is like revision, but fetches the revision with get, ex: app.snippets.FindRevision to leave its
+// files out.
+func (app *application) revisionWith(w http.ResponseWriter, r *http.Request, s *models.Snippet,
+	get func(int, int) (*models.Revision, error)) (*models.Revision, bool) {
+	number := r.URL.Query().Get("rev")
+	if number == "" || number == strconv.Itoa(s.Revision) {
+		return nil, true
+	}
+
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 1 {
+		app.notFound(w)
+		return nil, false
+	}
+
+	rev, err := get(s.ID, n)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return nil, false
 	}
 
-	// Create a new forms.Form struct containing the POST data from the form.
-	// Then use the validation methods to check the data.
-	form := forms.New(r.PostForm)
-	form.Required("title", "content", "expires")
-	form.MaxLength("title", 100)
-	form.PermittedValues("expires", "365", "7", "1")
+	return rev, true
+}
 
-	// If the form is not valid, re-display the template passing in the form.Form object as the data.
-	if !form.Valid() {
-		app.render(w, r, "create.page.tmpl", &templateData{Form: form})
+// rawFile sends the content of a file of a snippet as plain text, or as a download for binary files. The "rev"
+// query string parameter picks the file from an earlier revision.
+func (app *application) rawFile(w http.ResponseWriter, r *http.Request) {
+	s := app.snippet(w, r)
+	if s == nil {
+		return
+	}
+
+	rev, ok := app.revision(w, r, s)
+	if !ok {
+		return
+	}
+
+	files := s.Files
+	if rev != nil {
+		files = rev.Files
+	}
+
+	f := fileNamed(files, r.URL.Query().Get(":name"))
+	if f == nil {
+		app.notFound(w)
+		return
+	}
+
+	// Never let browsers guess the content is something they can run, like HTML.
+	if f.Binary {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": f.Name}))
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write([]byte(f.Content))
+}
+
+// downloadArchive sends the files of a snippet as an archive in the format of the ":format" parameter, ex: "zip".
+// The "rev" query string parameter picks the files of an earlier revision.
+// The files are read one at a time as the archive is written, and the archive is streamed past the buffer of the
+// session middleware, see streamResponse.
+func (app *application) downloadArchive(w http.ResponseWriter, r *http.Request) {
+	// Like the snippet page, expired snippets and the snippets the user can't see are not found.
+	s := app.snippetVisibleTo(w, r, app.viewerID(r), app.snippets.Find)
+	if s == nil {
 		return
 	}
 
-	id, err := app.snippets.Insert(form.Get("title"), form.Get("content"), form.Get("expires"))
+	extension := r.URL.Query().Get(":format")
+	format, ok := archiveFormats[extension]
+	if !ok {
+		app.notFound(w)
+		return
+	}
+
+	rev, ok := app.revisionWith(w, r, s, app.snippets.FindRevision)
+	if !ok {
+		return
+	}
+
+	// Files are dated from the last time the snippet was written.
+	name, number, modTime := fmt.Sprintf("snippet-%d", s.ID), s.Revision, s.Updated
+	if modTime.IsZero() {
+		modTime = s.Created
+	}
+	if rev != nil {
+		name, number, modTime = fmt.Sprintf("snippet-%d-rev%d", s.ID, rev.Number), rev.Number, rev.Created
+	}
+
+	w = app.streamWriter(w, r)
+	w.Header().Set("Content-Type", format.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, name, extension))
+
+	aw := format.newWriter(w, name, modTime)
+	err := app.snippets.EachFile(s.ID, number, aw.WriteFile)
+	if err == nil {
+		err = aw.Close()
+	}
+	if err != nil {
+		// The response has already started, the client gets a truncated archive.
+		app.errorLog.Output(2, err.Error())
+	}
+}
+
+// renderSnippet renders the page of a snippet with its forks and comments, and the form to post a comment.
+// If rev isn't nil, the content of that earlier revision is shown instead of the current one.
+func (app *application) renderSnippet(w http.ResponseWriter, r *http.Request, s *models.Snippet,
+	rev *models.Revision, form *forms.Form) {
+	var starred bool
+	var err error
+	if app.isAuthenticated(r) {
+		starred, err = app.stars.IsStarred(app.viewerID(r), s.ID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	forks, err := app.snippets.Forks(s.ID, app.viewerID(r))
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	// Put() add a string value "Snippet.." and a corresponding key "flash" to the session data.
-	// If a session for the current user does not exist, it will be created automatically
-	// by the session middleware.
-	app.session.Put(r, "flash", "Snippet successfully created!")
+	revisions, err := app.snippets.Revisions(s.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
 
-	// Redirect the user to the relevant page for the snippet.
-	http.Redirect(w, r, fmt.Sprintf("/snippet/%d", id), http.StatusSeeOther)
+	comments, err := app.comments.ForSnippet(s.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	files, revision := s.Files, s.Revision
+	if rev != nil {
+		files, revision = rev.Files, rev.Number
+	}
+
+	// Call the render helper.
+	app.render(w, r, "show.page.tmpl", &templateData{
+		Comments:  comments,
+		Forks:     forks,
+		Form:      form,
+		Files:     numberFiles(files, revision, comments),
+		Revision:  rev,
+		Revisions: revisions,
+		Snippet:   s,
+		Starred:   starred,
+	})
 }
 
-func (app *application) signupUserForm(w http.ResponseWriter, r *http.Request) {
-	app.render(w, r, "signup.page.tmpl", &templateData{
-		Form: forms.New(nil),
+func (app *application) editSnippetForm(w http.ResponseWriter, r *http.Request) {
+	s := app.snippet(w, r)
+	if s == nil {
+		return
+	}
+
+	// Only authors can edit their snippets.
+	if s.UserID != app.authenticatedUser(r).ID {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	app.render(w, r, "edit.page.tmpl", &templateData{
+		Form:      forms.New(url.Values{"title": {s.Title}}),
+		FormFiles: s.Files,
+		Languages: languages,
+		Snippet:   s,
 	})
 }
 
-func (app *application) signupUser(w http.ResponseWriter, r *http.Request) {
-	// Parse the form data
+func (app *application) editSnippet(w http.ResponseWriter, r *http.Request) {
+	s := app.snippet(w, r)
+	if s == nil {
+		return
+	}
+
+	user := app.authenticatedUser(r)
+	if s.UserID != user.ID {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
 	err := r.ParseForm()
 	if err != nil {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	// Validate the form data using the helpers.
-	form := forms.New(r.PostForm)
-	form.Required("name", "email", "password")
-	form.MaxLength("name", 255)
-	form.MaxLength("email", 255)
-	form.MinLength("password", 10)
-	form.MatchesPattern("email", forms.EmailRX)
+	// The files can be uploaded, replacing their content.
+	form := forms.NewMultipart(r.PostForm, r.MultipartForm)
+	files := parseFiles(form)
+	err = app.uploadFiles(form, files)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
 
-	// In case of errors re-display the signup form.
-	if !form.Valid() {
-		app.render(w, r, "signup.page.tmpl", &templateData{Form: form})
+	files, changed := fileAction(form, files)
+	if !changed {
+		form.Required("title")
+		form.MaxLength("title", 100)
+		app.validateFiles(form, files, s.Files)
+	}
+
+	if changed || !form.Valid() {
+		app.render(w, r, "edit.page.tmpl", &templateData{
+			Form:      form,
+			FormFiles: files,
+			Languages: languages,
+			Snippet:   s,
+		})
 		return
 	}
 
-	// Create a new user record in the database. If the email already exists
-	// add an error message to the form and re-display it.
-	err = app.users.Insert(form.Get("name"), form.Get("email"), form.Get("password"))
+	revision, err := app.snippets.Update(s.ID, form.Get("title"), files)
 	if err != nil {
-		if errors.Is(err, models.ErrDuplicateEmail) {
-			form.Errors.Add("email", "Address is already in use")
-			app.render(w, r, "signup.page.tmpl", &templateData{Form: form})
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
 		} else {
 			app.serverError(w, err)
 		}
 		return
 	}
 
-	// Flash message
-	app.session.Put(r, "flash", "Your signup was successful. Please log in.")
+	err = app.audit(r, user.ID, auditSnippetEdit, fmt.Sprintf("snippet %d revision %d", s.ID, revision))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
 
-	// Redirect the user to the login page.
-	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+	app.session.Put(r, "flash", "Snippet successfully updated!")
+	http.Redirect(w, r, fmt.Sprintf("/snippet/%d", s.ID), http.StatusSeeOther)
 }
 
-func (app *application) loginUserForm(w http.ResponseWriter, r *http.Request) {
-	app.render(w, r, "login.page.tmpl", &templateData{
-		Form: forms.New(nil),
+// snippetStats shows the author of a snippet how many times it was viewed during the last days, and which sites
+// brought the views.
+func (app *application) snippetStats(w http.ResponseWriter, r *http.Request) {
+	s := app.snippet(w, r)
+	if s == nil {
+		return
+	}
+
+	// Only authors can see the stats of their snippets.
+	if s.UserID != app.authenticatedUser(r).ID {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	since := day(time.Now()).AddDate(0, 0, 1-statsDays)
+	daily, err := app.views.Daily(s.ID, since)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	referrers, err := app.views.Referrers(s.ID, since, 10)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	stats := &viewStats{Referrers: referrers}
+	stats.Days, stats.Total = dailyStats(daily, since, statsDays)
+
+	app.render(w, r, "stats.page.tmpl", &templateData{
+		Snippet: s,
+		Stats:   stats,
 	})
 }
 
-func (app *application) loginUser(w http.ResponseWriter, r *http.Request) {
+func (app *application) forkSnippet(w http.ResponseWriter, r *http.Request) {
+	// Users can only fork the snippets they can see.
+	s := app.snippet(w, r)
+	if s == nil {
+		return
+	}
+
+	user := app.authenticatedUser(r)
+	forkID, err := app.snippets.Fork(s.ID, user.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	err = app.audit(r, user.ID, auditSnippetFork, fmt.Sprintf("snippet %d forked from %d", forkID, s.ID))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.session.Put(r, "flash", "Snippet successfully forked!")
+	http.Redirect(w, r, fmt.Sprintf("/snippet/%d", forkID), http.StatusSeeOther)
+}
+
+func (app *application) starSnippet(w http.ResponseWriter, r *http.Request) {
+	app.setStarred(w, r, true)
+}
+
+func (app *application) unstarSnippet(w http.ResponseWriter, r *http.Request) {
+	app.setStarred(w, r, false)
+}
+
+// setStarred stars or unstars the snippet identified by the ":id" parameter for the current user.
+func (app *application) setStarred(w http.ResponseWriter, r *http.Request, starred bool) {
+	// Users can only star the snippets they can see.
+	s := app.snippet(w, r)
+	if s == nil {
+		return
+	}
+
+	user := app.authenticatedUser(r)
+	var err error
+	if starred {
+		err = app.stars.Star(user.ID, s.ID)
+	} else {
+		err = app.stars.Unstar(user.ID, s.ID)
+	}
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/%d", s.ID), http.StatusSeeOther)
+}
+
+func (app *application) listStars(w http.ResponseWriter, r *http.Request) {
+	s, err := app.stars.Starred(app.authenticatedUser(r).ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, r, "stars.page.tmpl", &templateData{Snippets: s})
+}
+
+// commentMaxLength is the maximum number of characters of a comment.
+const commentMaxLength = 2000
+
+func (app *application) createComment(w http.ResponseWriter, r *http.Request) {
+	// Users can only comment on the snippets they can see.
+	s := app.snippet(w, r)
+	if s == nil {
+		return
+	}
+
 	err := r.ParseForm()
 	if err != nil {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	// Check if the credentials are valid.
 	form := forms.New(r.PostForm)
-	id, err := app.users.Authenticate(form.Get("email"), form.Get("password"))
-	if err != nil {
-		if errors.Is(err, models.ErrInvalidCredentials) {
-			form.Errors.Add("generic", "Email or Password is incorrect")
-			app.render(w, r, "login.page.tmpl", &templateData{Form: form})
-		} else {
+	form.Required("content")
+	form.MaxLength("content", commentMaxLength)
+
+	// Replies must be to a comment on the same snippet which still exists.
+	var parentID int
+	if form.Get("parent") != "" {
+		parentID, err = strconv.Atoi(form.Get("parent"))
+		if err != nil || parentID < 1 {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+
+		parent, err := app.comments.Get(parentID)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
 			app.serverError(w, err)
+			return
+		}
+		if parent == nil || parent.SnippetID != s.ID || parent.Deleted {
+			app.clientError(w, http.StatusBadRequest)
+			return
 		}
+	}
+
+	// Comments can be about a range of lines of the current revision. If the snippet was edited after the form
+	// was loaded, the lines the user picked may have moved.
+	lines := formLines(form, "line_file", "line_start", "line_end", s.Files)
+	revision := form.Get("revision")
+	if lines != (models.LineRange{}) && revision != "" && revision != strconv.Itoa(s.Revision) {
+		form.Errors.Add("lines", "This snippet has been edited since you loaded it, please check the lines again")
+	}
+
+	if !form.Valid() {
+		app.renderSnippet(w, r, s, nil, form)
 		return
 	}
 
-	// Add the ID of the current user to the session.
-	// Put adds a key and corresponding value to the session data. Any existing
-	// value for the key will be replaced.
-	app.session.Put(r, "authenticatedUserID", id)
+	id, err := app.comments.Insert(s.ID, s.Revision, app.authenticatedUser(r).ID, parentID, lines,
+		form.Get("content"))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
 
-	// Redirect the user to the create snippet page.
-	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+	app.session.Put(r, "flash", "Comment successfully posted!")
+	http.Redirect(w, r, fmt.Sprintf("/snippet/%d#comment-%d", s.ID, id), http.StatusSeeOther)
 }
 
-func (app *application) logoutUser(w http.ResponseWriter, r *http.Request) {
-	// Remove the authenticatedUserID from the session data so the user is logged out
-	app.session.Remove(r, "authenticatedUserID")
+// comment returns the comment identified by the ":id" parameter, if the current user can see the snippet it is
+// on. Otherwise it sends a 404 Not Found response and returns nil.
+func (app *application) comment(w http.ResponseWriter, r *http.Request) *models.Comment {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return nil
+	}
 
-	// Log out flash message
-	app.session.Put(r, "flash", "You've been logged out successfully!")
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	c, err := app.comments.Get(id)
+	if err == nil {
+		_, err = app.snippets.Get(c.SnippetID, app.viewerID(r))
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return nil
+	}
+
+	return c
+}
+
+func (app *application) editCommentForm(w http.ResponseWriter, r *http.Request) {
+	c := app.comment(w, r)
+	if c == nil {
+		return
+	}
+
+	// Only authors can edit their comments.
+	if c.UserID != app.authenticatedUser(r).ID || c.Deleted {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	app.render(w, r, "comment.page.tmpl", &templateData{
+		Comment: c,
+		Form:    forms.New(url.Values{"content": {c.Content}}),
+	})
+}
+
+func (app *application) editComment(w http.ResponseWriter, r *http.Request) {
+	c := app.comment(w, r)
+	if c == nil {
+		return
+	}
+
+	if c.UserID != app.authenticatedUser(r).ID || c.Deleted {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("content")
+	form.MaxLength("content", commentMaxLength)
+
+	if !form.Valid() {
+		app.render(w, r, "comment.page.tmpl", &templateData{Comment: c, Form: form})
+		return
+	}
+
+	err = app.comments.Update(c.ID, form.Get("content"))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.session.Put(r, "flash", "Comment successfully updated!")
+	http.Redirect(w, r, fmt.Sprintf("/snippet/%d#comment-%d", c.SnippetID, c.ID), http.StatusSeeOther)
+}
+
+func (app *application) deleteComment(w http.ResponseWriter, r *http.Request) {
+	c := app.comment(w, r)
+	if c == nil {
+		return
+	}
+
+	// Authors can delete their comments, admins can delete any comment to moderate discussions.
+	user := app.authenticatedUser(r)
+	if c.UserID != user.ID && !user.IsAdmin {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	err := app.comments.Delete(c.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	if c.UserID != user.ID {
+		err = app.audit(r, user.ID, auditAdminDeleteComment,
+			fmt.Sprintf("comment %d on snippet %d", c.ID, c.SnippetID))
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	app.session.Put(r, "flash", "The comment has been deleted.")
+	http.Redirect(w, r, fmt.Sprintf("/snippet/%d#comments", c.SnippetID), http.StatusSeeOther)
+}
+
+// profilePageSize is the number of snippets listed per page on profile pages, and profileMaxPage the last page
+// which can be requested: it keeps the offset of the query far from overflowing, and nobody pages that far.
+const (
+	profilePageSize = 20
+	profileMaxPage  = 10000
+)
+
+func (app *application) showProfile(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	// Deactivated users don't have a public profile.
+	user, err := app.users.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	if !user.Active {
+		app.notFound(w)
+		return
+	}
+
+	page := 1
+	if p := r.URL.Query().Get("page"); p != "" {
+		page, err = strconv.Atoi(p)
+		if err != nil || page < 1 || page > profileMaxPage {
+			app.notFound(w)
+			return
+		}
+	}
+
+	// Fetch one more snippet than shown to know whether there is a next page.
+	snippets, err := app.snippets.ByAuthor(id, profilePageSize+1, (page-1)*profilePageSize)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	pages := &pagination{Current: page, Previous: page - 1}
+	if len(snippets) > profilePageSize {
+		snippets = snippets[:profilePageSize]
+		pages.Next = page + 1
+	}
+
+	// Authors also see their scheduled snippets on their own profile.
+	var scheduled []*models.Snippet
+	if user.ID == app.viewerID(r) {
+		scheduled, err = app.snippets.Scheduled(user.ID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	app.render(w, r, "profile.page.tmpl", &templateData{
+		Pagination: pages,
+		Scheduled:  scheduled,
+		Snippets:   snippets,
+		User:       user,
+	})
+}
+
+func (app *application) createSnippetForm(w http.ResponseWriter, r *http.Request) {
+	// New forms.Form object, sharing the snippet with the organization in the query string if any.
+	form := forms.New(url.Values{"org": {r.URL.Query().Get("org")}})
+
+	// New snippets start with a single empty file, unless they start from a template.
+	if r.URL.Query().Get("template") == "" {
+		app.renderCreateSnippet(w, r, form, []*models.File{{Position: 1}})
+		return
+	}
+
+	id, err := strconv.Atoi(r.URL.Query().Get("template"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	user := app.authenticatedUser(r)
+	t, err := app.snippetTemplates.Get(id, user.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	// The template fills in the form, with its placeholders expanded. Snippets started from an organization
+	// template are shared with that organization, unless another one is asked for.
+	values := placeholders(user, time.Now())
+	form.Set("title", expandPlaceholders(t.Title, values))
+	form.Set("expires", t.Expires)
+	form.Set("template", strconv.Itoa(t.ID))
+	if form.Get("org") == "" && t.OrgID != 0 {
+		form.Set("org", strconv.Itoa(t.OrgID))
+	}
+
+	app.renderCreateSnippet(w, r, form, templateFiles(t, values))
+}
+
+// renderCreateSnippet renders the snippet creation form with its files, along with the organizations the snippet
+// can be shared with and the templates it can start from.
+func (app *application) renderCreateSnippet(w http.ResponseWriter, r *http.Request, form *forms.Form,
+	files []*models.File) {
+	user := app.authenticatedUser(r)
+	orgs, err := app.organizations.ForUser(user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	templates, err := app.snippetTemplates.ForUser(user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, r, "create.page.tmpl", &templateData{
+		Form:             form,
+		FormFiles:        files,
+		Languages:        languages,
+		Organizations:    orgs,
+		SnippetTemplates: templates,
+	})
+}
+
+func (app *application) createSnippet(w http.ResponseWriter, r *http.Request) {
+	// Call ParseForm() to add any data in POST request bodies to r.PostForm map.
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// Create a new forms.Form struct containing the POST data from the form, and the files uploaded with it.
+	form := forms.NewMultipart(r.PostForm, r.MultipartForm)
+
+	// An uploaded file replaces the content typed for that file.
+	files := parseFiles(form)
+	err = app.uploadFiles(form, files)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// The buttons adding and removing files submit the form too, it is then shown again with the files changed.
+	files, changed := fileAction(form, files)
+	if changed {
+		app.renderCreateSnippet(w, r, form, files)
+		return
+	}
+
+	// The binary files of the template the snippet started from, if any, are accepted like the uploaded ones.
+	user := app.authenticatedUser(r)
+	templateFiles, err := app.formTemplateFiles(form, "template", user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Use the validation methods to check the data.
+	form.Required("title", "expires")
+	form.MaxLength("title", 100)
+	form.PermittedValues("expires", "365", "7", "1")
+	app.validateFiles(form, files, templateFiles)
+
+	// An empty "org" makes the snippet public, otherwise it must be an organization the user is a member of.
+	orgID, err := app.formOrganization(form, "org", user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// An empty "publish_at" publishes the snippet right away.
+	publishAt := formPublishAt(form, "publish_at", time.Now())
+
+	// If the form is not valid, re-display the template passing in the form.Form object as the data.
+	if !form.Valid() {
+		app.renderCreateSnippet(w, r, form, files)
+		return
+	}
+
+	id, err := app.snippets.Insert(user.ID, orgID, form.Get("title"), files, form.Get("expires"), publishAt)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.audit(r, user.ID, auditSnippetCreate, fmt.Sprintf("snippet %d", id))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Put() add a string value "Snippet.." and a corresponding key "flash" to the session data.
+	// If a session for the current user does not exist, it will be created automatically
+	// by the session middleware.
+	if publishAt.IsZero() {
+		app.session.Put(r, "flash", "Snippet successfully created!")
+	} else {
+		app.session.Put(r, "flash", "Snippet scheduled for "+humanDate(publishAt)+" UTC!")
+	}
+
+	// Redirect the user to the relevant page for the snippet.
+	http.Redirect(w, r, fmt.Sprintf("/snippet/%d", id), http.StatusSeeOther)
+}
+
+func (app *application) createTemplateForm(w http.ResponseWriter, r *http.Request) {
+	s := app.snippet(w, r)
+	if s == nil {
+		return
+	}
+
+	// The template starts with the title and lifetime of the snippet, in days rounded to the closest choice.
+	expires := "365"
+	if lifetime := s.Expires.Sub(s.Created); lifetime < 2*24*time.Hour {
+		expires = "1"
+	} else if lifetime < 30*24*time.Hour {
+		expires = "7"
+	}
+
+	form := forms.New(url.Values{
+		"name":    {s.Title},
+		"title":   {s.Title},
+		"expires": {expires},
+		"org":     {""},
+	})
+	if s.OrgID != 0 {
+		form.Set("org", strconv.Itoa(s.OrgID))
+	}
+
+	app.renderCreateTemplate(w, r, s, form)
+}
+
+// renderCreateTemplate renders the form saving a snippet as a template, along with the organizations the
+// template can be shared with.
+func (app *application) renderCreateTemplate(w http.ResponseWriter, r *http.Request, s *models.Snippet,
+	form *forms.Form) {
+	orgs, err := app.organizations.ForUser(app.authenticatedUser(r).ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, r, "template.page.tmpl", &templateData{
+		Form:          form,
+		Organizations: orgs,
+		Snippet:       s,
+	})
+}
+
+// createTemplate saves the current revision of a snippet as a template. Any user who can see a snippet can save
+// it, as a personal template or for one of their organizations. Organization snippets can only be saved for their
+// organization.
+func (app *application) createTemplate(w http.ResponseWriter, r *http.Request) {
+	s := app.snippet(w, r)
+	if s == nil {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name", "title", "expires")
+	form.MaxLength("name", 100)
+	form.MaxLength("title", 100)
+	form.PermittedValues("expires", "365", "7", "1")
+
+	user := app.authenticatedUser(r)
+	orgID, err := app.formOrganization(form, "org", user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// The files of an organization snippet stay in the organization: they can't be copied to a personal template
+	// or to a template of another organization.
+	if s.OrgID != 0 && orgID != s.OrgID && form.Errors.Get("org") == "" {
+		form.Errors.Add("org", "Templates of this snippet can only be shared with its organization")
+	}
+
+	if !form.Valid() {
+		app.renderCreateTemplate(w, r, s, form)
+		return
+	}
+
+	_, err = app.snippetTemplates.Insert(user.ID, orgID, form.Get("name"), form.Get("title"), s.Files,
+		form.Get("expires"))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.session.Put(r, "flash", "Template successfully saved!")
+	http.Redirect(w, r, "/user/templates", http.StatusSeeOther)
+}
+
+func (app *application) listTemplates(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	templates, err := app.snippetTemplates.ForUser(user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Owners can delete the templates of their organizations.
+	orgs, err := app.organizations.ForUser(user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, r, "templates.page.tmpl", &templateData{
+		Organizations:    orgs,
+		SnippetTemplates: templates,
+	})
+}
+
+// deleteTemplate deletes a template. Personal templates can only be deleted by their author, organization
+// templates by their author or the owners of the organization.
+func (app *application) deleteTemplate(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	user := app.authenticatedUser(r)
+	t, err := app.snippetTemplates.Get(id, user.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	if t.UserID != user.ID {
+		org, err := app.organizations.Get(t.OrgID, user.ID)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, err)
+			return
+		}
+		if org == nil || org.Role != models.RoleOwner {
+			app.clientError(w, http.StatusForbidden)
+			return
+		}
+	}
+
+	err = app.snippetTemplates.Delete(t.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.session.Put(r, "flash", "The template has been deleted.")
+	http.Redirect(w, r, "/user/templates", http.StatusSeeOther)
+}
+
+func (app *application) signupUserForm(w http.ResponseWriter, r *http.Request) {
+	app.render(w, r, "signup.page.tmpl", &templateData{
+		Form: forms.New(nil),
+	})
+}
+
+func (app *application) signupUser(w http.ResponseWriter, r *http.Request) {
+	// Parse the form data
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// Validate the form data using the helpers.
+	form := forms.New(r.PostForm)
+	form.Required("name", "email", "password")
+	form.MaxLength("name", 255)
+	form.MaxLength("email", 255)
+	form.MinLength("password", 10)
+	form.MatchesPattern("email", forms.EmailRX)
+	err = app.checkPassword(form, "password", form.Get("name"), form.Get("email"))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// In case of errors re-display the signup form.
+	if !form.Valid() {
+		app.render(w, r, "signup.page.tmpl", &templateData{Form: form})
+		return
+	}
+
+	// Create a new user record in the database. If the email already exists
+	// add an error message to the form and re-display it.
+	id, err := app.users.Insert(form.Get("name"), form.Get("email"), form.Get("password"))
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateEmail) {
+			form.Errors.Add("email", "Address is already in use")
+			app.render(w, r, "signup.page.tmpl", &templateData{Form: form})
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	// The event is recorded with the new user, so filtering the audit log by user shows their signup.
+	err = app.audit(r, id, auditSignup, form.Get("email"))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Flash message
+	app.session.Put(r, "flash", "Your signup was successful. Please log in.")
+
+	// Redirect the user to the login page.
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+func (app *application) loginUserForm(w http.ResponseWriter, r *http.Request) {
+	app.render(w, r, "login.page.tmpl", &templateData{
+		Form: forms.New(nil),
+	})
+}
+
+func (app *application) loginUser(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	email, ip := form.Get("email"), clientIP(r)
+
+	// Record the attempt before evaluating it, it counts as a failure until the credentials are verified.
+	attemptID, err := app.loginAttempts.Insert(email, ip)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Refuse to evaluate the attempt if the email or the IP address is throttled or locked.
+	// The error message is the same one used for wrong credentials so a lockout doesn't reveal
+	// that an account exists.
+	allowed, err := app.loginAllowed(email, ip, attemptID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if !allowed {
+		err = app.audit(r, 0, auditLoginThrottled, email)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		form.Errors.Add("generic", "Email or Password is incorrect")
+		app.render(w, r, "login.page.tmpl", &templateData{Form: form})
+		return
+	}
+
+	// Check if the credentials are valid, against the directory server first if one is configured.
+	id, err := app.users.Authenticate(email, form.Get("password"))
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			err = app.audit(r, 0, auditLoginFailed, email)
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+
+			form.Errors.Add("generic", "Email or Password is incorrect")
+			app.render(w, r, "login.page.tmpl", &templateData{Form: form})
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	// The credentials are valid, forget the previous failures for this email and for the backoff of this IP
+	// address.
+	err = app.loginAttempts.Clear(email)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	err = app.loginAttempts.ClearIP(ip)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Start a server-side session for the user and add its token to the cookie session.
+	err = app.logIn(r, id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.audit(r, id, auditLogin, email)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Redirect the user to the create snippet page.
+	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+}
+
+// ssoLogin starts the authorization code flow: it redirects the user to the identity provider.
+func (app *application) ssoLogin(w http.ResponseWriter, r *http.Request) {
+	if app.oidc == nil {
+		app.notFound(w)
+		return
+	}
+
+	// The state protects the callback against CSRF, the nonce binds the ID token to this attempt and the
+	// code verifier (PKCE) makes an intercepted authorization code useless.
+	values := make([]string, 3)
+	for i := range values {
+		v, err := oidc.RandomString()
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		values[i] = v
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     ssoCookieName,
+		Value:    strings.Join(values, "."),
+		Path:     "/user/login/sso",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, app.oidc.AuthCodeURL(state, nonce, verifier), http.StatusSeeOther)
+}
+
+// ssoCallback completes the authorization code flow and logs the user in.
+func (app *application) ssoCallback(w http.ResponseWriter, r *http.Request) {
+	if app.oidc == nil {
+		app.notFound(w)
+		return
+	}
+
+	cookie, err := r.Cookie(ssoCookieName)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	// The cookie is only good for one attempt.
+	http.SetCookie(w, &http.Cookie{Name: ssoCookieName, Path: "/user/login/sso", MaxAge: -1})
+
+	values := strings.Split(cookie.Value, ".")
+	q := r.URL.Query()
+	if len(values) != 3 || q.Get("state") != values[0] {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	nonce, verifier := values[1], values[2]
+
+	// The identity provider reports errors, like the user refusing to sign in, in the "error" parameter.
+	if q.Get("error") != "" {
+		app.infoLog.Printf("sso: identity provider returned %s", q.Get("error"))
+		app.session.Put(r, "flash", "Single sign-on failed.")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	// A replayed or expired code, or an ID token failing verification, is the fault of the client or of the
+	// identity provider, not ours.
+	rawIDToken, err := app.oidc.Exchange(r.Context(), q.Get("code"), verifier)
+	if err != nil {
+		app.infoLog.Printf("sso: exchanging the code: %s", err)
+		app.session.Put(r, "flash", "Single sign-on failed.")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	claims, err := app.oidc.Verify(r.Context(), rawIDToken, nonce)
+	if err != nil {
+		app.infoLog.Printf("sso: verifying the ID token: %s", err)
+		app.session.Put(r, "flash", "Single sign-on failed.")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	id, err := app.ssoUser(r, claims)
+	if err != nil {
+		if errors.Is(err, errUnverifiedEmail) || errors.Is(err, models.ErrDuplicateEmail) {
+			app.session.Put(r, "flash", "Single sign-on failed: your account could not be linked.")
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	// Deactivated users can't sign in with single sign-on either.
+	user, err := app.users.Get(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if !user.Active {
+		app.session.Put(r, "flash", "Single sign-on failed: your account has been deactivated.")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	err = app.logIn(r, id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.audit(r, id, auditLoginSSO, claims.Issuer+" "+claims.Subject)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// This request comes from the identity provider, so a redirect would still be a cross-site navigation
+	// and the browser wouldn't send the SameSite=Strict session cookie along. Let the page redirect instead.
+	app.render(w, r, "sso.page.tmpl", &templateData{RedirectURL: "/snippet/create"})
+}
+
+func (app *application) changePasswordForm(w http.ResponseWriter, r *http.Request) {
+	app.render(w, r, "password.page.tmpl", &templateData{
+		Form: forms.New(nil),
+	})
+}
+
+func (app *application) changePassword(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	user := app.authenticatedUser(r)
+
+	form := forms.New(r.PostForm)
+	form.Required("current_password", "new_password")
+	form.MinLength("new_password", 10)
+	err = app.checkPassword(form, "new_password", user.Name, user.Email)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if !form.Valid() {
+		app.render(w, r, "password.page.tmpl", &templateData{Form: form})
+		return
+	}
+
+	err = app.users.ChangePassword(user.ID, form.Get("current_password"), form.Get("new_password"))
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			form.Errors.Add("current_password", "Current password is incorrect")
+			app.render(w, r, "password.page.tmpl", &templateData{Form: form})
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	err = app.audit(r, user.ID, auditPasswordChange, "")
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.session.Put(r, "flash", "Your password has been changed.")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (app *application) logoutUser(w http.ResponseWriter, r *http.Request) {
+	// Revoke the server-side session and remove its token from the session data so the user is logged out.
+	us := app.authenticatedSession(r)
+	err := app.userSessions.Revoke(us.UserID, us.ID)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, err)
+		return
+	}
+	app.session.Remove(r, "sessionToken")
+
+	err = app.audit(r, us.UserID, auditLogout, "")
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Log out flash message
+	app.session.Put(r, "flash", "You've been logged out successfully!")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (app *application) listUserSessions(w http.ResponseWriter, r *http.Request) {
+	us := app.authenticatedSession(r)
+
+	sessions, err := app.userSessions.List(us.UserID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, r, "sessions.page.tmpl", &templateData{UserSessions: sessions})
+}
+
+func (app *application) revokeUserSession(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	// Users can only revoke their own sessions.
+	us := app.authenticatedSession(r)
+	err = app.userSessions.Revoke(us.UserID, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	err = app.audit(r, us.UserID, auditSessionRevoke, fmt.Sprintf("session %d", id))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Revoking the current session is the same as logging out.
+	if id == us.ID {
+		app.session.Remove(r, "sessionToken")
+		app.session.Put(r, "flash", "You've been logged out successfully!")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	app.session.Put(r, "flash", "The session has been revoked.")
+	http.Redirect(w, r, "/user/sessions", http.StatusSeeOther)
+}
+
+func (app *application) revokeAllUserSessions(w http.ResponseWriter, r *http.Request) {
+	us := app.authenticatedSession(r)
+	err := app.userSessions.RevokeAll(us.UserID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.session.Remove(r, "sessionToken")
+
+	err = app.audit(r, us.UserID, auditSessionRevokeAll, "")
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.session.Put(r, "flash", "You've been logged out on every device.")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+func (app *application) listOrganizations(w http.ResponseWriter, r *http.Request) {
+	app.renderOrganizations(w, r, forms.New(nil))
+}
+
+// renderOrganizations renders the organizations of the current user, along with the form to create a new
+// organization.
+func (app *application) renderOrganizations(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	orgs, err := app.organizations.ForUser(app.authenticatedUser(r).ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, r, "orgs.page.tmpl", &templateData{
+		Form:          form,
+		Organizations: orgs,
+	})
+}
+
+func (app *application) createOrganization(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name")
+	form.MaxLength("name", 100)
+
+	if !form.Valid() {
+		app.renderOrganizations(w, r, form)
+		return
+	}
+
+	user := app.authenticatedUser(r)
+	id, err := app.organizations.Insert(form.Get("name"), user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.audit(r, user.ID, auditOrgCreate, fmt.Sprintf("organization %d", id))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.session.Put(r, "flash", "Organization successfully created!")
+	http.Redirect(w, r, fmt.Sprintf("/org/%d", id), http.StatusSeeOther)
+}
+
+// organization returns the organization identified by the ":id" parameter, if the current user is a member.
+// Otherwise it sends a 404 Not Found response and returns nil.
+func (app *application) organization(w http.ResponseWriter, r *http.Request) *models.Organization {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return nil
+	}
+
+	org, err := app.organizations.Get(id, app.authenticatedUser(r).ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return nil
+	}
+
+	return org
+}
+
+func (app *application) showOrganization(w http.ResponseWriter, r *http.Request) {
+	org := app.organization(w, r)
+	if org == nil {
+		return
+	}
+
+	app.renderOrganization(w, r, org, forms.New(nil))
+}
+
+// renderOrganization renders the page of an organization with its members and snippets. Owners also get the
+// form to invite new members.
+func (app *application) renderOrganization(w http.ResponseWriter, r *http.Request, org *models.Organization,
+	form *forms.Form) {
+	members, err := app.organizations.Members(org.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	snippets, err := app.snippets.ForOrg(org.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, r, "org.page.tmpl", &templateData{
+		Form:         form,
+		Members:      members,
+		Organization: org,
+		Snippets:     snippets,
+	})
+}
+
+func (app *application) inviteMember(w http.ResponseWriter, r *http.Request) {
+	org := app.organization(w, r)
+	if org == nil {
+		return
+	}
+
+	// Only owners manage the membership.
+	if org.Role != models.RoleOwner {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("email", "role")
+	form.MaxLength("email", 255)
+	form.MatchesPattern("email", forms.EmailRX)
+	form.PermittedValues("role", models.RoleOwner, models.RoleMember)
+
+	if !form.Valid() {
+		app.renderOrganization(w, r, org, form)
+		return
+	}
+
+	user := app.authenticatedUser(r)
+	token, err := app.organizations.Invite(org.ID, form.Get("email"), form.Get("role"), user.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateMember) {
+			form.Errors.Add("email", "Address is already a member or has already been invited")
+			app.renderOrganization(w, r, org, form)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	err = app.audit(r, user.ID, auditOrgInvite, fmt.Sprintf("organization %d: %s", org.ID, form.Get("email")))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Whoever holds the link can accept the invitation. It is emailed to the address invited when email is
+	// configured, otherwise the owner has to pass it on.
+	link := fmt.Sprintf("%s/invitations/%s", app.baseURL, token)
+	flash := fmt.Sprintf("%s has been invited.", form.Get("email"))
+	if app.mailer == nil {
+		flash = fmt.Sprintf("%s has been invited, send them this link to join: %s", form.Get("email"), link)
+	} else {
+		err = app.mailer.Send(form.Get("email"), fmt.Sprintf("Join %s on Snippetbox", org.Name),
+			fmt.Sprintf(invitationEmail, user.Name, org.Name, form.Get("role"), link))
+		if err != nil {
+			app.errorLog.Printf("invitations: sending to %s: %s", form.Get("email"), err)
+			flash = fmt.Sprintf("The invitation couldn't be emailed, send this link to %s to join: %s",
+				form.Get("email"), link)
+		}
+	}
+
+	app.session.Put(r, "flash", flash)
+	http.Redirect(w, r, fmt.Sprintf("/org/%d", org.ID), http.StatusSeeOther)
+}
+
+// invitationEmail is the body of the emails inviting to join an organization, formatted with the name of the
+// owner who sent it, the name of the organization, the role and the link to accept it.
+const invitationEmail = `Hello,
+
+%s invited you to join %s on Snippetbox as a %s.
+
+Log in, or sign up if you don't have an account yet, then open this link to accept or decline the invitation:
+
+%s
+
+The link can only be used once, don't share it.
+`
+
+func (app *application) removeMember(w http.ResponseWriter, r *http.Request) {
+	org := app.organization(w, r)
+	if org == nil {
+		return
+	}
+
+	if org.Role != models.RoleOwner {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	userID, err := strconv.Atoi(r.URL.Query().Get(":userID"))
+	if err != nil || userID < 1 {
+		app.notFound(w)
+		return
+	}
+
+	err = app.organizations.RemoveMember(org.ID, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	err = app.audit(r, app.authenticatedUser(r).ID, auditOrgRemoveMember,
+		fmt.Sprintf("organization %d: user %d", org.ID, userID))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.session.Put(r, "flash", "The member has been removed.")
+	http.Redirect(w, r, fmt.Sprintf("/org/%d", org.ID), http.StatusSeeOther)
+}
+
+// invitation returns the pending invitation identified by the ":token" parameter. Otherwise it sends a 404 Not
+// Found response and returns nil.
+func (app *application) invitation(w http.ResponseWriter, r *http.Request) *models.Invitation {
+	inv, err := app.organizations.Invitation(r.URL.Query().Get(":token"))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return nil
+	}
+
+	return inv
+}
+
+func (app *application) showInvitation(w http.ResponseWriter, r *http.Request) {
+	inv := app.invitation(w, r)
+	if inv == nil {
+		return
+	}
+
+	app.render(w, r, "invitation.page.tmpl", &templateData{
+		Invitation:      inv,
+		InvitationToken: r.URL.Query().Get(":token"),
+	})
+}
+
+func (app *application) acceptInvitation(w http.ResponseWriter, r *http.Request) {
+	// Invitations are accepted with the token sent to the address invited, not matched on the email address of
+	// the user, which nobody verified.
+	user := app.authenticatedUser(r)
+	orgID, err := app.organizations.AcceptInvitation(r.URL.Query().Get(":token"), user.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	err = app.audit(r, user.ID, auditOrgJoin, fmt.Sprintf("organization %d", orgID))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.session.Put(r, "flash", "Welcome to the organization!")
+	http.Redirect(w, r, fmt.Sprintf("/org/%d", orgID), http.StatusSeeOther)
+}
+
+func (app *application) declineInvitation(w http.ResponseWriter, r *http.Request) {
+	err := app.organizations.DeclineInvitation(r.URL.Query().Get(":token"))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.session.Put(r, "flash", "The invitation has been declined.")
+	http.Redirect(w, r, "/orgs", http.StatusSeeOther)
+}
+
+func (app *application) adminDashboard(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+
+	users, err := app.users.Search(q)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, r, "admin.page.tmpl", &templateData{Query: q, Users: users})
+}
+
+func (app *application) activateUser(w http.ResponseWriter, r *http.Request) {
+	app.setUserActive(w, r, true)
+}
+
+func (app *application) deactivateUser(w http.ResponseWriter, r *http.Request) {
+	app.setUserActive(w, r, false)
+}
+
+// setUserActive activates or deactivates the user identified by the ":id" parameter.
+func (app *application) setUserActive(w http.ResponseWriter, r *http.Request, active bool) {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	// Don't let admins lock themselves out.
+	admin := app.authenticatedUser(r)
+	if id == admin.ID {
+		app.session.Put(r, "flash", "You can't change the status of your own account.")
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	err = app.users.SetActive(id, active)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	event := auditAdminDeactivate
+	if active {
+		event = auditAdminActivate
+	}
+	err = app.audit(r, admin.ID, event, fmt.Sprintf("user %d", id))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.session.Put(r, "flash", "The user has been updated.")
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+func (app *application) unlockUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	user, err := app.users.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	// Clearing the failed login attempts lifts the lockout and the backoff.
+	err = app.loginAttempts.Clear(user.Email)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.audit(r, app.authenticatedUser(r).ID, auditAdminUnlock, fmt.Sprintf("user %d", id))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.session.Put(r, "flash", "The user has been unlocked.")
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+func (app *application) deleteSnippet(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	err = app.snippets.Delete(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	err = app.audit(r, app.authenticatedUser(r).ID, auditAdminDeleteSnippet, fmt.Sprintf("snippet %d", id))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.session.Put(r, "flash", "The snippet has been deleted.")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (app *application) showAuditLog(w http.ResponseWriter, r *http.Request) {
+	form := forms.New(r.URL.Query())
+	filter := auditFilter(form)
+
+	// In case of errors re-display the filter without results.
+	if !form.Valid() {
+		app.render(w, r, "audit.page.tmpl", &templateData{AuditEvents: auditEvents, Form: form})
+		return
+	}
+
+	events, err := app.auditLog.Search(filter, 100)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, r, "audit.page.tmpl", &templateData{AuditEvents: auditEvents, AuditLog: events, Form: form})
+}
+
+// exportAuditLog writes the audit events matching the filter as JSON lines, one event per line.
+func (app *application) exportAuditLog(w http.ResponseWriter, r *http.Request) {
+	form := forms.New(r.URL.Query())
+	filter := auditFilter(form)
+	if !form.Valid() {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit.jsonl"`)
+
+	// Encode() writes a newline after each value. The events are streamed as they are read from the database,
+	// so once the first one is written we can't send an error page anymore: just log the error.
+	enc := json.NewEncoder(w)
+	err := app.auditLog.Each(filter, func(e *models.AuditEvent) error {
+		return enc.Encode(e)
+	})
+	if err != nil {
+		app.errorLog.Output(2, err.Error())
+	}
 }
 
 // ping returns a status code 200
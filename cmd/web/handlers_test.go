@@ -1,10 +1,19 @@
 package main
 
 import (
+	"archive/zip"
 	"bytes"
+	"context"
+	"errors"
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"github.com/luca0x333/go-snippetbox/pkg/models/mock"
+	"github.com/luca0x333/go-snippetbox/pkg/oidc"
+	"github.com/luca0x333/go-snippetbox/pkg/oidc/oidctest"
 	"net/http"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestPing(t *testing.T) {
@@ -41,11 +50,971 @@ func TestShowSnippet(t *testing.T) {
 	}{
 		{"Valid ID", "/snippet/1", http.StatusOK, []byte("An old silent pond...")},
 		{"Non-existent ID", "/snippet/2", http.StatusNotFound, nil},
+		{"Organization snippet", "/snippet/3", http.StatusNotFound, nil},
 		{"Negative ID", "/snippet/-1", http.StatusNotFound, nil},
 		{"Decimal ID", "/snippet/1.23", http.StatusNotFound, nil},
 		{"String ID", "/snippet/foo", http.StatusNotFound, nil},
 		{"Empty ID", "/snippet/", http.StatusNotFound, nil},
 		{"Trailing slash", "/snippet/1/", http.StatusNotFound, nil},
+		{"Scheduled snippet", "/snippet/5", http.StatusNotFound, nil},
+		{"Numbered lines", "/snippet/1", http.StatusOK, []byte("<a href='#F1-L3'>3</a>")},
+		{"Second file", "/snippet/1", http.StatusOK, []byte("Written by Basho.")},
+		{"Rendered Markdown", "/snippet/1", http.StatusOK, []byte("<div class='markdown'><p>Written by Basho.</p>")},
+		{"OpenGraph tags", "/snippet/1", http.StatusOK,
+			[]byte("<meta property='og:url' content='https://snippetbox.example/snippet/1'>")},
+		{"oEmbed discovery", "/snippet/1", http.StatusOK,
+			[]byte("href='https://snippetbox.example/oembed?url=https%3a%2f%2fsnippetbox.example/snippet/1'")},
+		{"Comment on an earlier revision", "/snippet/1", http.StatusOK, []byte("/snippet/1?rev=1#F1-L1")},
+		{"Current revision", "/snippet/1?rev=2", http.StatusOK, []byte("A frog jumps into the pond,")},
+		{"Earlier revision", "/snippet/1?rev=1", http.StatusOK, []byte("This is revision 1")},
+		{"Non-existent revision", "/snippet/1?rev=3", http.StatusNotFound, nil},
+		{"String revision", "/snippet/1?rev=foo", http.StatusNotFound, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body to contain %q", tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestShowSnippetCountsViews(t *testing.T) {
+	app := newTestApplication(t)
+
+	// Alice wrote the snippet 1: her views aren't counted. Anonymous visitors and Bob are counted once.
+	anonymous := newTestServer(t, app.routes())
+	defer anonymous.Close()
+
+	author := newTestServer(t, app.routes())
+	defer author.Close()
+	author.login(t, "alice@example.com")
+
+	other := newTestServer(t, app.routes())
+	defer other.Close()
+	other.login(t, "bob@example.com")
+
+	for _, ts := range []*testServer{anonymous, anonymous, author, other, other} {
+		code, _, _ := ts.get(t, "/snippet/1")
+		if code != http.StatusOK {
+			t.Fatalf("want %d; got %d", http.StatusOK, code)
+		}
+	}
+
+	app.flushViewsOnce()
+
+	recorded := app.views.(*mock.ViewModel).Recorded
+	if len(recorded) != 1 || recorded[0].SnippetID != 1 || recorded[0].Views != 2 {
+		t.Errorf("want 2 views of snippet 1; got %+v", recorded)
+	}
+}
+
+func TestSnippetStats(t *testing.T) {
+	app := newTestApplication(t)
+
+	anonymous := newTestServer(t, app.routes())
+	defer anonymous.Close()
+
+	author := newTestServer(t, app.routes())
+	defer author.Close()
+	author.login(t, "alice@example.com")
+
+	other := newTestServer(t, app.routes())
+	defer other.Close()
+	other.login(t, "bob@example.com")
+
+	tests := []struct {
+		name     string
+		ts       *testServer
+		urlPath  string
+		wantCode int
+		wantBody []byte
+	}{
+		{"Author", author, "/snippet/1/stats", http.StatusOK, []byte("3 views during the last 30 days")},
+		{"Referrers", author, "/snippet/1/stats", http.StatusOK, []byte("<td>news.example</td>")},
+		{"Direct views", author, "/snippet/1/stats", http.StatusOK, []byte("Direct or unknown")},
+		{"Other user", other, "/snippet/1/stats", http.StatusForbidden, nil},
+		{"Anonymous", anonymous, "/snippet/1/stats", http.StatusSeeOther, nil},
+		{"Non-existent snippet", author, "/snippet/2/stats", http.StatusNotFound, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := tt.ts.get(t, tt.urlPath)
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body to contain %q", tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestEmbedSnippet(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Embedded snippets are public ones, even for members of an organization.
+	member := newTestServer(t, app.routes())
+	defer member.Close()
+	member.login(t, "alice@example.com")
+
+	tests := []struct {
+		name      string
+		ts        *testServer
+		urlPath   string
+		wantCode  int
+		wantFrame string
+		wantType  string
+		wantBody  string
+	}{
+		{"Embed page", ts, "/snippet/1/embed", http.StatusOK, "", "text/html; charset=utf-8",
+			"<td class='line'><code>A frog jumps into the pond,</code></td>"},
+		{"Organization snippet", member, "/snippet/3/embed", http.StatusNotFound, "", "", ""},
+		{"Scheduled snippet", member, "/snippet/5/embed", http.StatusNotFound, "", "", ""},
+		{"Snippet page", ts, "/snippet/1", http.StatusOK, "deny", "text/html; charset=utf-8", ""},
+		{"Script", ts, "/snippet/1/embed.js", http.StatusOK, "deny", "text/javascript; charset=utf-8",
+			`frame.src = "https://snippetbox.example/snippet/1/embed";`},
+		{"Script of an organization snippet", ts, "/snippet/3/embed.js", http.StatusNotFound, "deny", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, body := tt.ts.get(t, tt.urlPath)
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+
+			if code == http.StatusOK {
+				if got := header.Get("X-Frame-Options"); got != tt.wantFrame {
+					t.Errorf("want X-Frame-Options %q; got %q", tt.wantFrame, got)
+				}
+				if got := header.Get("Content-Type"); got != tt.wantType {
+					t.Errorf("want Content-Type %q; got %q", tt.wantType, got)
+				}
+			}
+
+			if !strings.Contains(string(body), tt.wantBody) {
+				t.Errorf("want body to contain %q", tt.wantBody)
+			}
+		})
+	}
+
+	// The embedded page doesn't use the session: it sets no cookie and leaves the flash message for the next page.
+	t.Run("Stateless", func(t *testing.T) {
+		anonymous := newTestServer(t, app.routes())
+		defer anonymous.Close()
+
+		_, header, _ := anonymous.get(t, "/snippet/1/embed")
+		if cookies := header.Values("Set-Cookie"); len(cookies) != 0 {
+			t.Errorf("want no cookie; got %q", cookies)
+		}
+
+		form := url.Values{}
+		form.Add("csrf_token", member.login(t, "alice@example.com"))
+		code, _, _ := member.postForm(t, "/snippet/1/fork", form)
+		if code != http.StatusSeeOther {
+			t.Fatalf("want %d; got %d", http.StatusSeeOther, code)
+		}
+
+		_, _, body := member.get(t, "/snippet/1/embed")
+		if strings.Contains(string(body), "Snippet successfully forked!") {
+			t.Errorf("want no flash message in the embedded page")
+		}
+
+		_, _, body = member.get(t, "/")
+		if !strings.Contains(string(body), "Snippet successfully forked!") {
+			t.Errorf("want the flash message kept for the next page")
+		}
+	})
+}
+
+func TestOEmbed(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{"Snippet", "/oembed?url=https://snippetbox.example/snippet/1", http.StatusOK,
+			`"type":"rich","provider_name":"Snippetbox"`},
+		{"Author", "/oembed?url=https://snippetbox.example/snippet/1", http.StatusOK, `"author_name":"Alice"`},
+		{"Frame", "/oembed?url=https://snippetbox.example/snippet/1", http.StatusOK,
+			`src=\"https://snippetbox.example/snippet/1/embed\" width=\"600\"`},
+		{"Max width", "/oembed?url=https://snippetbox.example/snippet/1&maxwidth=320", http.StatusOK,
+			`"width":320`},
+		{"JSON format", "/oembed?url=https://snippetbox.example/snippet/1&format=json", http.StatusOK,
+			`"version":"1.0"`},
+		{"XML format", "/oembed?url=https://snippetbox.example/snippet/1&format=xml", http.StatusNotImplemented,
+			""},
+		{"Embed URL", "/oembed?url=https://snippetbox.example/snippet/1/embed", http.StatusOK, `"title"`},
+		{"Other site", "/oembed?url=https://elsewhere.example/snippet/1", http.StatusNotFound, ""},
+		{"Other page", "/oembed?url=https://snippetbox.example/u/1", http.StatusNotFound, ""},
+		{"Organization snippet", "/oembed?url=https://snippetbox.example/snippet/3", http.StatusNotFound, ""},
+		{"Non-existent snippet", "/oembed?url=https://snippetbox.example/snippet/2", http.StatusNotFound, ""},
+		{"No URL", "/oembed", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+
+			if !strings.Contains(string(body), tt.wantBody) {
+				t.Errorf("want body to contain %q; got %s", tt.wantBody, body)
+			}
+		})
+	}
+}
+
+func TestDownloadArchive(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name            string
+		urlPath         string
+		wantCode        int
+		wantType        string
+		wantDisposition string
+	}{
+		{"Zip", "/snippet/1/archive.zip", http.StatusOK, "application/zip",
+			`attachment; filename="snippet-1.zip"`},
+		{"Tar.gz", "/snippet/1/archive.tar.gz", http.StatusOK, "application/gzip",
+			`attachment; filename="snippet-1.tar.gz"`},
+		{"Earlier revision", "/snippet/1/archive.zip?rev=1", http.StatusOK, "application/zip",
+			`attachment; filename="snippet-1-rev1.zip"`},
+		{"Unknown format", "/snippet/1/archive.rar", http.StatusNotFound, "", ""},
+		{"Non-existent revision", "/snippet/1/archive.zip?rev=3", http.StatusNotFound, "", ""},
+		{"Hidden snippet", "/snippet/3/archive.zip", http.StatusNotFound, "", ""},
+		{"Non-existent snippet", "/snippet/2/archive.zip", http.StatusNotFound, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, body := ts.get(t, tt.urlPath)
+
+			if code != tt.wantCode {
+				t.Fatalf("want %d; got %d", tt.wantCode, code)
+			}
+			if code != http.StatusOK {
+				return
+			}
+
+			if got := header.Get("Content-Type"); got != tt.wantType {
+				t.Errorf("want Content-Type %q; got %q", tt.wantType, got)
+			}
+			if got := header.Get("Content-Disposition"); got != tt.wantDisposition {
+				t.Errorf("want Content-Disposition %q; got %q", tt.wantDisposition, got)
+			}
+			if len(body) == 0 {
+				t.Error("want an archive; got an empty body")
+			}
+		})
+	}
+
+	// The zip holds every file of the snippet.
+	_, _, body := ts.get(t, "/snippet/1/archive.zip")
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zr.File) != 2 || zr.File[1].Name != "snippet-1/notes.md" {
+		t.Errorf("want the 2 files of the snippet; got %d files", len(zr.File))
+	}
+
+	// An earlier revision holds its own files.
+	_, _, body = ts.get(t, "/snippet/1/archive.zip?rev=1")
+	zr, err = zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zr.File) != 1 || zr.File[0].Name != "snippet-1-rev1/haiku.txt" {
+		t.Errorf("want the file of the revision; got %d files", len(zr.File))
+	}
+}
+
+func TestEditSnippet(t *testing.T) {
+	app := newTestApplication(t)
+
+	// Alice wrote the snippet 1, Bob didn't.
+	author := newTestServer(t, app.routes())
+	defer author.Close()
+
+	other := newTestServer(t, app.routes())
+	defer other.Close()
+
+	csrfTokens := map[*testServer]string{
+		author: author.login(t, "alice@example.com"),
+		other:  other.login(t, "bob@example.com"),
+	}
+
+	code, _, body := author.get(t, "/snippet/1/edit")
+	if code != http.StatusOK || !bytes.Contains(body, []byte("A frog jumps into the pond,")) {
+		t.Errorf("want the edit form with the current content; got %d", code)
+	}
+
+	code, _, _ = other.get(t, "/snippet/1/edit")
+	if code != http.StatusForbidden {
+		t.Errorf("want %d for another user; got %d", http.StatusForbidden, code)
+	}
+
+	tests := []struct {
+		name     string
+		ts       *testServer
+		urlPath  string
+		form     url.Values
+		wantCode int
+		wantBody []byte
+	}{
+		{"Valid submission", author, "/snippet/1/edit", snippetForm("Old pond", "haiku.txt", "A frog jumps"),
+			http.StatusSeeOther, nil},
+		{"Empty title", author, "/snippet/1/edit", snippetForm("", "haiku.txt", "A frog jumps"), http.StatusOK,
+			[]byte("This field cannot be blank")},
+		{"Add file", author, "/snippet/1/edit", withAction(snippetForm("Old pond", "haiku.txt", "A frog jumps"),
+			"add-file"), http.StatusOK, []byte("Remove this file")},
+		{"Other user", other, "/snippet/1/edit", snippetForm("Old pond", "haiku.txt", "A frog jumps"),
+			http.StatusForbidden, nil},
+		{"Hidden snippet", other, "/snippet/3/edit", snippetForm("Old pond", "haiku.txt", "A frog jumps"),
+			http.StatusNotFound, nil},
+		{"Non-existent snippet", author, "/snippet/2/edit", snippetForm("Old pond", "haiku.txt", "A frog jumps"),
+			http.StatusNotFound, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.form.Set("csrf_token", csrfTokens[tt.ts])
+
+			code, _, body := tt.ts.postForm(t, tt.urlPath, tt.form)
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body %s to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+// snippetForm returns the fields of a snippet form with a title and files, given as name and content pairs.
+func snippetForm(title string, files ...string) url.Values {
+	form := url.Values{"title": {title}, "expires": {"7"}}
+	for i := 0; i+1 < len(files); i += 2 {
+		form.Add("file_name", files[i])
+		form.Add("file_language", "")
+		form.Add("file_content", files[i+1])
+	}
+
+	return form
+}
+
+// withAction sets the button a snippet form was submitted with.
+func withAction(form url.Values, action string) url.Values {
+	form.Set("action", action)
+	return form
+}
+
+// withPublishAt schedules the publication of the snippet of a form.
+func withPublishAt(form url.Values, publishAt string) url.Values {
+	form.Set("publish_at", publishAt)
+	return form
+}
+
+// binaryForm is a snippet form with a single binary file, base64 encoded, started from the template templateID
+// unless it is empty.
+func binaryForm(content, templateID string) url.Values {
+	form := snippetForm("Schema", "schema.png", content)
+	form.Set("file_binary", "true")
+	form.Set("template", templateID)
+	return form
+}
+
+func TestCreateSnippet(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	csrfToken := ts.login(t, "alice@example.com")
+
+	tests := []struct {
+		name     string
+		form     url.Values
+		wantCode int
+		wantBody []byte
+	}{
+		{"Single file", snippetForm("Haiku", "haiku.txt", "An old silent pond..."), http.StatusSeeOther, nil},
+		{"Several files", snippetForm("Service", "Dockerfile", "FROM golang", "run.sh", "go run .",
+			"config.yml", "port: 4000"), http.StatusSeeOther, nil},
+		{"No file", snippetForm("Empty"), http.StatusOK, []byte("A snippet needs at least one file")},
+		{"Empty file name", snippetForm("Haiku", "", "An old silent pond..."), http.StatusOK,
+			[]byte("This field cannot be blank")},
+		{"Empty file content", snippetForm("Haiku", "haiku.txt", " "), http.StatusOK,
+			[]byte("This field cannot be blank")},
+		{"Duplicate file names", snippetForm("Haiku", "haiku.txt", "One", "HAIKU.txt", "Two"), http.StatusOK,
+			[]byte("Another file already has this name")},
+		{"File name with a slash", snippetForm("Haiku", "poems/haiku.txt", "One"), http.StatusOK,
+			[]byte("This field cannot contain slashes")},
+		{"Add file", withAction(snippetForm("Haiku", "haiku.txt", "One"), "add-file"), http.StatusOK,
+			[]byte("value='remove-file-2'")},
+		{"Remove file", withAction(snippetForm("Haiku", "haiku.txt", "One", "notes.md", "Two"), "remove-file-1"),
+			http.StatusOK, []byte("value='notes.md'")},
+		{"Scheduled", withPublishAt(snippetForm("News", "news.txt", "Soon"),
+			time.Now().UTC().Add(time.Hour).Format("2006-01-02T15:04")), http.StatusSeeOther, nil},
+		{"Publish time passed", withPublishAt(snippetForm("News", "news.txt", "Soon"), "2020-01-01T09:00"),
+			http.StatusOK, []byte("This time has already passed")},
+		{"Invalid publish time", withPublishAt(snippetForm("News", "news.txt", "Soon"), "tomorrow"),
+			http.StatusOK, []byte("This field is not a valid time")},
+		{"Binary file", binaryForm("iVBORw0KGgo=", ""), http.StatusOK,
+			[]byte("This type of file is not permitted")},
+		{"Binary file of the template", binaryForm("iVBORw0KGgo=", "2"), http.StatusSeeOther, nil},
+		{"Other binary file", binaryForm("R0lGODlh", "2"), http.StatusOK,
+			[]byte("This type of file is not permitted")},
+		{"Template the user can't use", binaryForm("iVBORw0KGgo=", "9"), http.StatusOK,
+			[]byte("This type of file is not permitted")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.form.Set("csrf_token", csrfToken)
+
+			code, _, body := ts.postForm(t, "/snippet/create", tt.form)
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body %s to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestUploadFile(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	csrfToken := ts.login(t, "alice@example.com")
+
+	// Adding a file shows the form again with the uploaded content, which lets the tests check it.
+	tests := []struct {
+		name     string
+		form     url.Values
+		upload   upload
+		wantCode int
+		wantBody []byte
+	}{
+		{"Text file", snippetForm("Haiku", "", ""),
+			upload{"file_upload.1", "haiku.txt", "text/plain", "An old silent pond..."},
+			http.StatusSeeOther, nil},
+		{"File name", withAction(snippetForm("Haiku", "", ""), "add-file"),
+			upload{"file_upload.1", "haiku.txt", "text/plain", "An old silent pond..."},
+			http.StatusOK, []byte("value='haiku.txt'")},
+		{"Typed name kept", withAction(snippetForm("Haiku", "poem.txt", ""), "add-file"),
+			upload{"file_upload.1", "haiku.txt", "text/plain", "An old silent pond..."},
+			http.StatusOK, []byte("value='poem.txt'")},
+		{"Upload replaces content", withAction(snippetForm("Haiku", "haiku.txt", "Typed"), "add-file"),
+			upload{"file_upload.1", "haiku.txt", "text/plain", "An old silent pond..."},
+			http.StatusOK, []byte("An old silent pond...")},
+		{"Windows-1252 file", withAction(snippetForm("Menu", "menu.txt", ""), "add-file"),
+			upload{"file_upload.1", "menu.txt", "text/plain", "caf\xe9 \x80 3"},
+			http.StatusOK, []byte("café € 3")},
+		{"UTF-16 file", withAction(snippetForm("Menu", "menu.txt", ""), "add-file"),
+			upload{"file_upload.1", "menu.txt", "text/plain", "\xff\xfec\x00a\x00f\x00\xe9\x00"},
+			http.StatusOK, []byte("café")},
+		{"Unsupported charset", snippetForm("Menu", "menu.txt", ""),
+			upload{"file_upload.1", "menu.txt", "text/plain; charset=shift_jis", "menu"},
+			http.StatusOK, []byte("The character set of this file is not supported")},
+		{"Binary file", snippetForm("Image", "", ""),
+			upload{"file_upload.1", "image.png", "image/png", "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"},
+			http.StatusOK, []byte("This type of file is not permitted")},
+		{"File too large", snippetForm("Log", "", ""),
+			upload{"file_upload.1", "server.log", "text/plain", strings.Repeat("a", 2<<10)},
+			http.StatusOK, []byte("This file is too large (maximum is 1 KB)")},
+		{"Request too large", snippetForm("Log", "", ""),
+			upload{"file_upload.1", "server.log", "text/plain", strings.Repeat("a", 2<<20)},
+			http.StatusRequestEntityTooLarge, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.form.Set("csrf_token", csrfToken)
+
+			code, _, body := ts.postMultipart(t, "/snippet/create", tt.form, tt.upload)
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body %s to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+
+	t.Run("Binary file allowed", func(t *testing.T) {
+		app.uploads.allowBinary = true
+		defer func() { app.uploads.allowBinary = false }()
+
+		form := withAction(snippetForm("Image", "", ""), "add-file")
+		form.Set("csrf_token", csrfToken)
+		code, _, body := ts.postMultipart(t, "/snippet/create", form,
+			upload{"file_upload.1", "image.png", "image/png", "\x89PNG\r\n\x1a\n"})
+
+		if code != http.StatusOK {
+			t.Errorf("want %d; got %d", http.StatusOK, code)
+		}
+
+		// The content is sent back base64 encoded, so the binary file is kept until the snippet is published.
+		for _, want := range []string{"Binary file, 8 bytes.", "name='file_binary' value='true'",
+			"name='file_content' value='iVBORw0KGgo='"} {
+			if !bytes.Contains(body, []byte(want)) {
+				t.Errorf("want body %s to contain %q", body, want)
+			}
+		}
+	})
+
+	// The other forms don't upload files and have a small size limit.
+	t.Run("Upload to other form", func(t *testing.T) {
+		form := url.Values{"csrf_token": {csrfToken}, "content": {"A comment"}}
+		code, _, _ := ts.postMultipart(t, "/snippet/1/comments", form,
+			upload{"file_upload.1", "server.log", "text/plain", strings.Repeat("a", maxFormSize)})
+
+		if code != http.StatusRequestEntityTooLarge {
+			t.Errorf("want %d; got %d", http.StatusRequestEntityTooLarge, code)
+		}
+	})
+
+	t.Run("Other form too large", func(t *testing.T) {
+		form := url.Values{"csrf_token": {csrfToken}, "content": {strings.Repeat("a", maxFormSize)}}
+		code, _, _ := ts.postForm(t, "/snippet/1/comments", form)
+
+		if code != http.StatusRequestEntityTooLarge {
+			t.Errorf("want %d; got %d", http.StatusRequestEntityTooLarge, code)
+		}
+	})
+}
+
+func TestRawFile(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody []byte
+	}{
+		{"First file", "/snippet/1/raw/haiku.txt", http.StatusOK, []byte("A frog jumps into the pond,")},
+		{"Second file", "/snippet/1/raw/notes.md", http.StatusOK, []byte("Written by Basho.")},
+		{"Earlier revision", "/snippet/1/raw/haiku.txt?rev=1", http.StatusOK, []byte("An old pond...")},
+		{"File of another revision", "/snippet/1/raw/notes.md?rev=1", http.StatusNotFound, nil},
+		{"Non-existent file", "/snippet/1/raw/missing.txt", http.StatusNotFound, nil},
+		{"Hidden snippet", "/snippet/3/raw/notes.txt", http.StatusNotFound, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, body := ts.get(t, tt.urlPath)
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body %s to contain %q", body, tt.wantBody)
+			}
+
+			if code == http.StatusOK && header.Get("Content-Type") != "text/plain; charset=utf-8" {
+				t.Errorf("want plain text; got %q", header.Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestForkSnippet(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/snippet/1")
+	if !bytes.Contains(body, []byte("An old silent pond (fork)")) {
+		t.Errorf("want body %s to list the forks", body)
+	}
+
+	csrfToken := ts.login(t, "bob@example.com")
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		wantCode     int
+		wantLocation string
+	}{
+		{"Valid ID", "/snippet/1/fork", http.StatusSeeOther, "/snippet/4"},
+		{"Organization snippet of another user", "/snippet/3/fork", http.StatusNotFound, ""},
+		{"Non-existent ID", "/snippet/2/fork", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+
+			code, header, _ := ts.postForm(t, tt.urlPath, form)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if header.Get("Location") != tt.wantLocation {
+				t.Errorf("want location %q; got %q", tt.wantLocation, header.Get("Location"))
+			}
+		})
+	}
+}
+
+func TestCreateSnippetFromTemplate(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "alice@example.com")
+	today := time.Now().UTC().Format("2006-01-02")
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody []byte
+	}{
+		{"Template picker", "/snippet/create", http.StatusOK, []byte("<option value='2'>SQL query (Acme)</option>")},
+		{"Expanded title", "/snippet/create?template=1", http.StatusOK, []byte("value='Incident of " + today + "'")},
+		{"Expanded content", "/snippet/create?template=1", http.StatusOK, []byte("Reported by Alice.")},
+		{"Expiry", "/snippet/create?template=1", http.StatusOK, []byte("value='7' checked")},
+		{"Organization template", "/snippet/create?template=2", http.StatusOK, []byte("value='1' selected")},
+		{"Template posted back", "/snippet/create?template=2", http.StatusOK,
+			[]byte("<input type='hidden' name='template' value='2'>")},
+		{"Non-existent template", "/snippet/create?template=5", http.StatusNotFound, nil},
+		{"String template", "/snippet/create?template=foo", http.StatusNotFound, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body %s to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestCreateTemplate(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	csrfToken := ts.login(t, "alice@example.com")
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		form         url.Values
+		wantCode     int
+		wantLocation string
+		wantBody     []byte
+	}{
+		{"Personal template", "/snippet/1/template",
+			url.Values{"name": {"Haiku"}, "title": {"Haiku of {{date}}"}, "expires": {"7"}},
+			http.StatusSeeOther, "/user/templates", nil},
+		{"Organization template", "/snippet/1/template",
+			url.Values{"name": {"Haiku"}, "title": {"Haiku"}, "expires": {"365"}, "org": {"1"}},
+			http.StatusSeeOther, "/user/templates", nil},
+		{"Empty name", "/snippet/1/template", url.Values{"name": {""}, "title": {"Haiku"}, "expires": {"7"}},
+			http.StatusOK, "", []byte("This field cannot be blank")},
+		{"Invalid expiry", "/snippet/1/template", url.Values{"name": {"Haiku"}, "title": {"Haiku"}, "expires": {"2"}},
+			http.StatusOK, "", []byte("This field is invalid")},
+		{"Other organization", "/snippet/1/template",
+			url.Values{"name": {"Haiku"}, "title": {"Haiku"}, "expires": {"7"}, "org": {"2"}},
+			http.StatusOK, "", []byte("This field is invalid")},
+		{"Non-existent snippet", "/snippet/2/template",
+			url.Values{"name": {"Haiku"}, "title": {"Haiku"}, "expires": {"7"}}, http.StatusNotFound, "", nil},
+		{"Organization snippet", "/snippet/3/template",
+			url.Values{"name": {"Notes"}, "title": {"Notes"}, "expires": {"7"}, "org": {"1"}},
+			http.StatusSeeOther, "/user/templates", nil},
+		{"Organization snippet as personal template", "/snippet/3/template",
+			url.Values{"name": {"Notes"}, "title": {"Notes"}, "expires": {"7"}},
+			http.StatusOK, "", []byte("Templates of this snippet can only be shared with its organization")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.form.Set("csrf_token", csrfToken)
+
+			code, header, body := ts.postForm(t, tt.urlPath, tt.form)
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if header.Get("Location") != tt.wantLocation {
+				t.Errorf("want location %q; got %q", tt.wantLocation, header.Get("Location"))
+			}
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body %s to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestDeleteTemplate(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	csrfToken := ts.login(t, "alice@example.com")
+
+	_, _, body := ts.get(t, "/user/templates")
+	if !bytes.Contains(body, []byte("action='/template/2/delete'")) {
+		t.Errorf("want body %s to offer deleting the templates", body)
+	}
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+	}{
+		{"Personal template", "/template/1/delete", http.StatusSeeOther},
+		{"Organization template", "/template/2/delete", http.StatusSeeOther},
+		{"Non-existent template", "/template/5/delete", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, _ := ts.postForm(t, tt.urlPath, url.Values{"csrf_token": {csrfToken}})
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+		})
+	}
+}
+
+func TestComments(t *testing.T) {
+	app := newTestApplication(t)
+
+	_, _, body := newTestServer(t, app.routes()).get(t, "/snippet/1")
+	if !bytes.Contains(body, []byte("Lovely haiku.")) || !bytes.Contains(body, []byte("Agreed!")) {
+		t.Errorf("want body %s to contain the comments", body)
+	}
+
+	// Bob wrote the comment 2, Alice is an admin.
+	author := newTestServer(t, app.routes())
+	defer author.Close()
+
+	admin := newTestServer(t, app.routes())
+	defer admin.Close()
+
+	csrfTokens := map[*testServer]string{
+		author: author.login(t, "bob@example.com"),
+		admin:  admin.login(t, "alice@example.com"),
+	}
+
+	tests := []struct {
+		name     string
+		ts       *testServer
+		urlPath  string
+		form     url.Values
+		wantCode int
+		wantBody []byte
+	}{
+		{"Comment", author, "/snippet/1/comments", url.Values{"content": {"Nice."}}, http.StatusSeeOther, nil},
+		{"Reply", author, "/snippet/1/comments", url.Values{"content": {"Nice."}, "parent": {"1"}},
+			http.StatusSeeOther, nil},
+		{"Comment on lines", author, "/snippet/1/comments",
+			url.Values{"content": {"Nice."}, "line_file": {"1"}, "line_start": {"2"}, "line_end": {"3"},
+				"revision": {"2"}}, http.StatusSeeOther, nil},
+		{"Comment on lines of the second file", author, "/snippet/1/comments",
+			url.Values{"content": {"Nice."}, "line_file": {"2"}, "line_start": {"1"}}, http.StatusSeeOther, nil},
+		{"Lines out of range of the second file", author, "/snippet/1/comments",
+			url.Values{"content": {"Nice."}, "line_file": {"2"}, "line_start": {"2"}}, http.StatusOK,
+			[]byte("Choose lines between 1 and 1")},
+		{"Non-existent file", author, "/snippet/1/comments",
+			url.Values{"content": {"Nice."}, "line_file": {"3"}, "line_start": {"1"}}, http.StatusOK,
+			[]byte("Choose one of the text files")},
+		{"Comment on a single line", author, "/snippet/1/comments",
+			url.Values{"content": {"Nice."}, "line_start": {"3"}}, http.StatusSeeOther, nil},
+		{"Lines out of range", author, "/snippet/1/comments",
+			url.Values{"content": {"Nice."}, "line_start": {"3"}, "line_end": {"4"}}, http.StatusOK,
+			[]byte("Choose lines between 1 and 3")},
+		{"Reversed lines", author, "/snippet/1/comments",
+			url.Values{"content": {"Nice."}, "line_start": {"3"}, "line_end": {"2"}}, http.StatusOK,
+			[]byte("Choose lines between 1 and 3")},
+		{"Lines of an outdated revision", author, "/snippet/1/comments",
+			url.Values{"content": {"Nice."}, "line_start": {"1"}, "revision": {"1"}}, http.StatusOK,
+			[]byte("This snippet has been edited since you loaded it")},
+		{"Empty comment", author, "/snippet/1/comments", url.Values{"content": {""}}, http.StatusOK,
+			[]byte("This field cannot be blank")},
+		{"Reply to comment on another snippet", author, "/snippet/1/comments",
+			url.Values{"content": {"Nice."}, "parent": {"3"}}, http.StatusBadRequest, nil},
+		{"Comment on hidden snippet", author, "/snippet/3/comments", url.Values{"content": {"Nice."}},
+			http.StatusNotFound, nil},
+		{"Edit own comment", author, "/comment/2/edit", url.Values{"content": {"Edited."}}, http.StatusSeeOther, nil},
+		{"Edit other user's comment", author, "/comment/1/edit", url.Values{"content": {"Edited."}},
+			http.StatusForbidden, nil},
+		{"Edit comment on hidden snippet", author, "/comment/3/edit", url.Values{"content": {"Edited."}},
+			http.StatusNotFound, nil},
+		{"Delete other user's comment", author, "/comment/1/delete", url.Values{}, http.StatusForbidden, nil},
+		{"Delete own comment", author, "/comment/2/delete", url.Values{}, http.StatusSeeOther, nil},
+		{"Admin edits other user's comment", admin, "/comment/2/edit", url.Values{"content": {"Edited."}},
+			http.StatusForbidden, nil},
+		{"Admin deletes other user's comment", admin, "/comment/2/delete", url.Values{}, http.StatusSeeOther, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.form.Set("csrf_token", csrfTokens[tt.ts])
+
+			code, _, body := tt.ts.postForm(t, tt.urlPath, tt.form)
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body %s to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestStars(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Anonymous users see the number of stars but can't star.
+	_, _, body := ts.get(t, "/snippet/1")
+	if !bytes.Contains(body, []byte("0 stars")) {
+		t.Errorf("want body %s to contain the number of stars", body)
+	}
+
+	csrfToken := ts.login(t, "alice@example.com")
+
+	_, _, body = ts.get(t, "/snippet/1")
+	if !bytes.Contains(body, []byte("action='/snippet/1/unstar'")) {
+		t.Errorf("want body %s to contain the unstar form", body)
+	}
+
+	_, _, body = ts.get(t, "/user/stars")
+	if !bytes.Contains(body, []byte("An old silent pond")) {
+		t.Errorf("want body %s to contain the starred snippet", body)
+	}
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+	}{
+		{"Star", "/snippet/1/star", http.StatusSeeOther},
+		{"Unstar", "/snippet/1/unstar", http.StatusSeeOther},
+		{"Non-existent snippet", "/snippet/2/star", http.StatusNotFound},
+		{"Invalid ID", "/snippet/foo/star", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+
+			code, _, _ := ts.postForm(t, tt.urlPath, form)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+		})
+	}
+}
+
+func TestShowProfile(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody []byte
+	}{
+		{"Valid ID", "/u/1", http.StatusOK, []byte("An old silent pond")},
+		{"No snippets", "/u/2", http.StatusOK, []byte("Bob hasn't published any snippet yet.")},
+		{"Second page", "/u/1?page=2", http.StatusOK, []byte("Alice hasn't published any snippet yet.")},
+		{"Invalid page", "/u/1?page=0", http.StatusNotFound, nil},
+		{"Page too far", "/u/1?page=10001", http.StatusNotFound, nil},
+		{"Overflowing page", "/u/1?page=461168601842738791", http.StatusNotFound, nil},
+		{"Non-existent ID", "/u/3", http.StatusNotFound, nil},
+		{"String ID", "/u/alice", http.StatusNotFound, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body %s to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestRankings(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody []byte
+	}{
+		{"Trending", "/trending", http.StatusOK, []byte("<h2>Trending Snippets</h2>")},
+		{"Popular", "/popular", http.StatusOK, []byte("<strong>This week</strong>")},
+		{"Popular this month", "/popular?range=month", http.StatusOK, []byte("<strong>This month</strong>")},
+		{"Popular ever", "/popular?range=all", http.StatusOK, []byte("An old silent pond")},
+		{"Invalid range", "/popular?range=year", http.StatusBadRequest, nil},
+		{"Latest", "/", http.StatusOK, []byte("<h2>Latest Snippets</h2>")},
+		{"Most starred", "/?sort=popular", http.StatusOK, []byte("<h2>Popular Snippets</h2>")},
+		{"Invalid sort", "/?sort=oldest", http.StatusBadRequest, nil},
 	}
 
 	for _, tt := range tests {
@@ -98,6 +1067,12 @@ func TestSignupUser(t *testing.T) {
 			[]byte("This field is too short (minimum is 10 characters)")},
 		{"Duplicate email", "Bob", "dupe@example.com", "validPa$$word", csrfToken, http.StatusOK,
 			[]byte("Address is already in use")},
+		{"Breached password", "Bob", "bob@example.com", "password1234", csrfToken, http.StatusOK,
+			[]byte("This password has appeared in a data breach")},
+		{"Password with name", "Bob", "bob@example.com", "my-name-is-bob", csrfToken, http.StatusOK,
+			[]byte("This password must not contain your name or email address")},
+		{"Guessable password", "Bob", "bob@example.com", "aaaaaaaaaaaa", csrfToken, http.StatusOK,
+			[]byte("This password is too easy to guess")},
 		{"Invalid CSRF Token", "", "", "", "wrongToken", http.StatusBadRequest, nil},
 	}
 
@@ -120,4 +1095,468 @@ func TestSignupUser(t *testing.T) {
 			}
 		})
 	}
+
+	// The signup is recorded with the ID of the new user.
+	var signups []*models.AuditEvent
+	for _, e := range app.auditLog.(*mock.AuditLogModel).Recorded {
+		if e.Event == auditSignup {
+			signups = append(signups, e)
+		}
+	}
+	if len(signups) != 1 || signups[0].UserID != 2 {
+		t.Errorf("want 1 signup of user 2 recorded; got %+v", signups)
+	}
+}
+
+func TestLoginUser(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/user/login")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		userEmail    string
+		userPassword string
+		wantCode     int
+		wantBody     []byte
+	}{
+		{"Valid credentials", "alice@example.com", "validPa$$word", http.StatusSeeOther, nil},
+		{"Invalid credentials", "carol@example.com", "validPa$$word", http.StatusOK,
+			[]byte("Email or Password is incorrect")},
+		{"Locked account", "locked@example.com", "validPa$$word", http.StatusOK,
+			[]byte("Email or Password is incorrect")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("email", tt.userEmail)
+			form.Add("password", tt.userPassword)
+			form.Add("csrf_token", csrfToken)
+
+			code, _, body := ts.postForm(t, "/user/login", form)
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body %s to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestUserSessions(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Anonymous users are redirected to the login page.
+	code, header, _ := ts.get(t, "/user/sessions")
+	if code != http.StatusSeeOther || header.Get("Location") != "/user/login" {
+		t.Errorf("want redirect to /user/login; got %d %q", code, header.Get("Location"))
+	}
+
+	csrfToken := ts.login(t, "alice@example.com")
+
+	code, _, body := ts.get(t, "/user/sessions")
+	if code != http.StatusOK {
+		t.Errorf("want %d; got %d", http.StatusOK, code)
+	}
+	if !bytes.Contains(body, []byte("Firefox on Linux (this device)")) {
+		t.Errorf("want body %s to contain the current session", body)
+	}
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+	}{
+		{"Other user's session", "/user/sessions/2/revoke", http.StatusNotFound},
+		{"Current session", "/user/sessions/1/revoke", http.StatusSeeOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+
+			code, _, _ := ts.postForm(t, tt.urlPath, form)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+		})
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	csrfToken := ts.login(t, "alice@example.com")
+
+	tests := []struct {
+		name            string
+		currentPassword string
+		newPassword     string
+		wantCode        int
+		wantBody        []byte
+	}{
+		{"Valid submission", "validPa$$word", "n3w-Pa$$word", http.StatusSeeOther, nil},
+		{"Wrong current password", "wrong", "n3w-Pa$$word", http.StatusOK, []byte("Current password is incorrect")},
+		{"Empty new password", "validPa$$word", "", http.StatusOK, []byte("This field cannot be blank")},
+		{"Short new password", "validPa$$word", "Pa$$word", http.StatusOK,
+			[]byte("This field is too short (minimum is 10 characters)")},
+		{"Breached new password", "validPa$$word", "password1234", http.StatusOK,
+			[]byte("This password has appeared in a data breach")},
+		{"New password with email", "validPa$$word", "alice@example.com!", http.StatusOK,
+			[]byte("This password must not contain your name or email address")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("current_password", tt.currentPassword)
+			form.Add("new_password", tt.newPassword)
+			form.Add("csrf_token", csrfToken)
+
+			code, _, body := ts.postForm(t, "/user/password", form)
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body %s to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestOrganizations(t *testing.T) {
+	app := newTestApplication(t)
+
+	// Alice owns the organization 1.
+	owner := newTestServer(t, app.routes())
+	defer owner.Close()
+
+	// Bob isn't a member but has been invited.
+	invited := newTestServer(t, app.routes())
+	defer invited.Close()
+
+	csrfTokens := map[*testServer]string{
+		owner:   owner.login(t, "alice@example.com"),
+		invited: invited.login(t, "bob@example.com"),
+	}
+
+	tests := []struct {
+		name     string
+		ts       *testServer
+		method   string
+		urlPath  string
+		form     url.Values
+		wantCode int
+		wantBody []byte
+	}{
+		{"Organization page", owner, "GET", "/org/1", nil, http.StatusOK, []byte("Team notes")},
+		{"Other organization", owner, "GET", "/org/2", nil, http.StatusNotFound, nil},
+		{"Organization snippet", owner, "GET", "/snippet/3", nil, http.StatusOK, []byte("Only for the team...")},
+		{"Share snippet", owner, "POST", "/snippet/create", url.Values{"org": {"1"}}, http.StatusSeeOther, nil},
+		{"Share snippet with other organization", owner, "POST", "/snippet/create", url.Values{"org": {"2"}},
+			http.StatusOK, []byte("This field is invalid")},
+		{"Invite", owner, "POST", "/org/1/invite", url.Values{"email": {"carol@example.com"}, "role": {"member"}},
+			http.StatusSeeOther, nil},
+		{"Invite member", owner, "POST", "/org/1/invite", url.Values{"email": {"bob@example.com"}, "role": {"member"}},
+			http.StatusOK, []byte("Address is already a member or has already been invited")},
+		{"Invite with invalid role", owner, "POST", "/org/1/invite",
+			url.Values{"email": {"carol@example.com"}, "role": {"admin"}}, http.StatusOK, []byte("This field is invalid")},
+		{"Non-member organization page", invited, "GET", "/org/1", nil, http.StatusNotFound, nil},
+		{"Non-member snippet", invited, "GET", "/snippet/3", nil, http.StatusNotFound, nil},
+		{"Non-member invite", invited, "POST", "/org/1/invite",
+			url.Values{"email": {"carol@example.com"}, "role": {"owner"}}, http.StatusNotFound, nil},
+		{"Invitation", invited, "GET", "/invitations/bob-invitation-token", nil, http.StatusOK, []byte("Join Acme")},
+		{"Unknown invitation", invited, "GET", "/invitations/forged", nil, http.StatusNotFound, nil},
+		{"Accept unknown invitation", invited, "POST", "/invitations/forged/accept", url.Values{},
+			http.StatusNotFound, nil},
+		{"Decline unknown invitation", invited, "POST", "/invitations/forged/decline", url.Values{},
+			http.StatusNotFound, nil},
+		{"Accept invitation", invited, "POST", "/invitations/bob-invitation-token/accept", url.Values{},
+			http.StatusSeeOther, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var code int
+			var body []byte
+			if tt.method == "GET" {
+				code, _, body = tt.ts.get(t, tt.urlPath)
+			} else {
+				tt.form.Set("csrf_token", csrfTokens[tt.ts])
+				if tt.urlPath == "/snippet/create" {
+					tt.form.Set("title", "Team notes")
+					tt.form.Set("file_name", "notes.txt")
+					tt.form.Set("file_content", "Only for the team...")
+					tt.form.Set("expires", "7")
+				}
+				code, _, body = tt.ts.postForm(t, tt.urlPath, tt.form)
+			}
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body %s to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestInviteMemberEmail(t *testing.T) {
+	tests := []struct {
+		name      string
+		mailer    *testMailer
+		wantSent  int
+		wantFlash string
+	}{
+		{"No mailer", nil, 0,
+			"send them this link to join: https://snippetbox.example/invitations/new-invitation-token"},
+		{"Mailer", &testMailer{}, 1, "carol@example.com has been invited."},
+		{"Mailer failure", &testMailer{err: errors.New("connection refused")}, 0,
+			"send this link to carol@example.com to join: https://snippetbox.example/invitations/new-invitation-token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			if tt.mailer != nil {
+				app.mailer = tt.mailer
+			}
+
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			form := url.Values{}
+			form.Set("csrf_token", ts.login(t, "alice@example.com"))
+			form.Set("email", "carol@example.com")
+			form.Set("role", "member")
+			code, _, _ := ts.postForm(t, "/org/1/invite", form)
+			if code != http.StatusSeeOther {
+				t.Fatalf("want %d; got %d", http.StatusSeeOther, code)
+			}
+
+			_, _, body := ts.get(t, "/org/1")
+			if !bytes.Contains(body, []byte(tt.wantFlash)) {
+				t.Errorf("want body to contain %q", tt.wantFlash)
+			}
+
+			if tt.mailer == nil {
+				return
+			}
+			if len(tt.mailer.sent) != tt.wantSent {
+				t.Fatalf("want %d emails sent; got %d", tt.wantSent, len(tt.mailer.sent))
+			}
+			for _, email := range tt.mailer.sent {
+				for _, want := range []string{"To: carol@example.com", "Subject: Join Acme on Snippetbox",
+					"https://snippetbox.example/invitations/new-invitation-token"} {
+					if !strings.Contains(email, want) {
+						t.Errorf("want email %q to contain %q", email, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestAdminDashboard(t *testing.T) {
+	tests := []struct {
+		name      string
+		userEmail string
+		wantCode  int
+		wantBody  []byte
+	}{
+		{"Anonymous", "", http.StatusSeeOther, nil},
+		{"Regular user", "bob@example.com", http.StatusForbidden, nil},
+		{"Administrator", "alice@example.com", http.StatusOK, []byte("bob@example.com")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			if tt.userEmail != "" {
+				ts.login(t, tt.userEmail)
+			}
+
+			code, _, body := ts.get(t, "/admin")
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body %s to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestDeactivateUser(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	csrfToken := ts.login(t, "alice@example.com")
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+	}{
+		{"Valid ID", "/admin/users/2/deactivate", http.StatusSeeOther},
+		{"Non-existent ID", "/admin/users/3/deactivate", http.StatusNotFound},
+		{"String ID", "/admin/users/foo/deactivate", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", csrfToken)
+
+			code, _, _ := ts.postForm(t, tt.urlPath, form)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+		})
+	}
+}
+
+func TestShowAuditLog(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t, "alice@example.com")
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody []byte
+	}{
+		{"No filter", "/admin/audit", http.StatusOK, []byte("user.login")},
+		{"Valid filter", "/admin/audit?user=1&event=user.login&from=2021-01-01&to=2021-12-31", http.StatusOK,
+			[]byte("alice@example.com")},
+		{"Invalid user", "/admin/audit?user=alice", http.StatusOK, []byte("This field is invalid")},
+		{"Invalid event", "/admin/audit?event=user.dance", http.StatusOK, []byte("This field is invalid")},
+		{"Invalid date", "/admin/audit?from=2021-13-01", http.StatusOK, []byte("This field is not a valid date")},
+		{"Export", "/admin/audit/export?event=user.login", http.StatusOK, []byte(`"event":"user.login"`)},
+		{"Invalid export", "/admin/audit/export?user=alice", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body %s to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSSOLogin(t *testing.T) {
+	tests := []struct {
+		name         string
+		user         oidctest.User
+		code         string
+		wantCode     int
+		wantLocation string
+	}{
+		{"Linked account", oidctest.User{Subject: "alice", Email: "alice@example.com"}, "", http.StatusOK, ""},
+		{"Verified email", oidctest.User{Subject: "bob", Email: "bob@example.com", EmailVerified: true}, "",
+			http.StatusOK, ""},
+		{"New user", oidctest.User{Subject: "carol", Email: "carol@example.com", EmailVerified: true}, "",
+			http.StatusOK, ""},
+		{"Unverified email", oidctest.User{Subject: "mallory", Email: "alice@example.com"}, "",
+			http.StatusSeeOther, "/user/login"},
+		{"Invalid code", oidctest.User{Subject: "alice", Email: "alice@example.com"}, "forged",
+			http.StatusSeeOther, "/user/login"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			idp := oidctest.NewServer("snippetbox", "secret", tt.user)
+			defer idp.Close()
+
+			provider, err := oidc.NewProvider(context.Background(), oidc.Config{
+				Issuer:       idp.Issuer(),
+				ClientID:     "snippetbox",
+				ClientSecret: "secret",
+				RedirectURL:  ts.URL + "/user/login/sso/callback",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			app.oidc = provider
+
+			// The login page offers single sign-on and redirects to the identity provider.
+			_, _, body := ts.get(t, "/user/login")
+			if !bytes.Contains(body, []byte("Sign in with SSO")) {
+				t.Errorf("want body %s to contain %q", body, "Sign in with SSO")
+			}
+
+			code, header, _ := ts.get(t, "/user/login/sso")
+			if code != http.StatusSeeOther {
+				t.Fatalf("want %d; got %d", http.StatusSeeOther, code)
+			}
+
+			// The fake identity provider approves the request and redirects to the callback.
+			rs, err := ts.Client().Get(header.Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rs.Body.Close()
+
+			callback := strings.TrimPrefix(rs.Header.Get("Location"), ts.URL)
+			if tt.code != "" {
+				u, err := url.Parse(callback)
+				if err != nil {
+					t.Fatal(err)
+				}
+				q := u.Query()
+				q.Set("code", tt.code)
+				u.RawQuery = q.Encode()
+				callback = u.String()
+			}
+			code, header, _ = ts.get(t, callback)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if header.Get("Location") != tt.wantLocation {
+				t.Errorf("want location %q; got %q", tt.wantLocation, header.Get("Location"))
+			}
+
+			// The state can't be replayed.
+			code, _, _ = ts.get(t, callback)
+			if code != http.StatusBadRequest {
+				t.Errorf("replay: want %d; got %d", http.StatusBadRequest, code)
+			}
+		})
+	}
 }
@@ -2,10 +2,15 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"github.com/justinas/nosurf"
+	"github.com/luca0x333/go-snippetbox/pkg/forms"
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"net"
 	"net/http"
 	"runtime/debug"
+	"strconv"
 	"time"
 )
 
@@ -29,11 +34,19 @@ func (app *application) notFound(w http.ResponseWriter) {
 }
 
 func (app *application) render(w http.ResponseWriter, r *http.Request, name string, td *templateData) {
+	// Inject the default data into the templateData.
+	app.renderPage(w, name, app.addDefaultData(td, r))
+}
+
+// renderPage renders a page with td alone, without the default data read from the session. It is used by the
+// stateless pages, like the embedded snippets.
+func (app *application) renderPage(w http.ResponseWriter, name string, td *templateData) {
 	// Retrieve the appropriate template set from the cache based on the page name.
 	// ex: 'home.base.tmpl'. If no entry exists calls serverError method.
 	ts, ok := app.templateCache[name]
 	if !ok {
 		app.serverError(w, fmt.Errorf("the template %s does not exist", name))
+		return
 	}
 
 	// The new built-in function allocates memory.
@@ -42,8 +55,7 @@ func (app *application) render(w http.ResponseWriter, r *http.Request, name stri
 
 	// Write the template set to the buffer instead of http.ResponseWriter.
 	// Call serverError method and return in case of an error.
-	// Also inject the default data into the templateData.
-	err := ts.Execute(buf, app.addDefaultData(td, r))
+	err := ts.Execute(buf, td)
 	if err != nil {
 		app.serverError(w, err)
 		return
@@ -66,12 +78,21 @@ func (app *application) addDefaultData(td *templateData, r *http.Request) *templ
 
 	td.CurrentYear = time.Now().Year()
 
+	// Absolute links, like the ones of the OpenGraph tags, are made from the URL of the site.
+	td.BaseURL = app.baseURL
+
 	// PopString returns the string value for a given key and then deletes it from the
 	// session data. One-time fetch.
 	td.Flash = app.session.PopString(r, "flash")
 
 	// Authentication status
 	td.IsAuthenticated = app.isAuthenticated(r)
+	td.IsAdmin = td.IsAuthenticated && app.authenticatedUser(r).IsAdmin
+	td.CurrentUserID = app.viewerID(r)
+	td.UserSession = app.authenticatedSession(r)
+
+	// Single sign-on is only offered when an identity provider is configured.
+	td.SSOEnabled = app.oidc != nil
 
 	return td
 }
@@ -85,3 +106,196 @@ func (app *application) isAuthenticated(r *http.Request) bool {
 
 	return isAuthenticated
 }
+
+// clientIP returns the IP address of the client which made the request.
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return ip
+}
+
+// authenticatedUser returns the current user, or nil if the request is not authenticated.
+func (app *application) authenticatedUser(r *http.Request) *models.User {
+	user, ok := r.Context().Value(contextKeyUser).(*models.User)
+	if !ok {
+		return nil
+	}
+
+	return user
+}
+
+// authenticatedSession returns the server-side session of the current user, or nil if the request is not
+// authenticated.
+func (app *application) authenticatedSession(r *http.Request) *models.Session {
+	us, ok := r.Context().Value(contextKeyUserSession).(*models.Session)
+	if !ok {
+		return nil
+	}
+
+	return us
+}
+
+// logIn starts a new server-side session for a user and stores its token in the cookie session.
+func (app *application) logIn(r *http.Request, userID int) error {
+	token, err := app.userSessions.Insert(userID, clientIP(r), r.UserAgent(), app.session.Lifetime)
+	if err != nil {
+		return err
+	}
+
+	app.session.Put(r, "sessionToken", token)
+
+	return nil
+}
+
+// streamWriter returns the ResponseWriter stored by streamResponse, which writes straight to the client, or w on
+// the routes without it. The session can't be saved anymore once it is written to.
+func (app *application) streamWriter(w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+	sw, ok := r.Context().Value(contextKeyStreamWriter).(http.ResponseWriter)
+	if !ok {
+		return w
+	}
+
+	return sw
+}
+
+// viewerID returns the ID of the current user, or 0 if the request is not authenticated.
+func (app *application) viewerID(r *http.Request) int {
+	user := app.authenticatedUser(r)
+	if user == nil {
+		return 0
+	}
+
+	return user.ID
+}
+
+// formTemplateFiles returns the files of the template selected in a form field, the one a snippet started from,
+// if the user can use it. An empty field or a template the user can't use returns no files.
+func (app *application) formTemplateFiles(form *forms.Form, field string, userID int) ([]*models.File, error) {
+	id, err := strconv.Atoi(form.Get(field))
+	if err != nil || id < 1 {
+		return nil, nil
+	}
+
+	t, err := app.snippetTemplates.Get(id, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return t.Files, nil
+}
+
+// formOrganization returns the ID of the organization selected in a form field, checking the user is a member.
+// An empty field selects no organization and returns 0. An invalid value adds an error to the form.
+func (app *application) formOrganization(form *forms.Form, field string, userID int) (int, error) {
+	value := form.Get(field)
+	if value == "" {
+		return 0, nil
+	}
+
+	id, err := strconv.Atoi(value)
+	if err != nil || id < 1 {
+		form.Errors.Add(field, "This field is invalid")
+		return 0, nil
+	}
+
+	_, err = app.organizations.Get(id, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			form.Errors.Add(field, "This field is invalid")
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// formLines returns the range of lines selected by the fileField, startField and endField form fields among the
+// files of a snippet. Empty line fields select no lines and return the zero LineRange, an empty fileField selects
+// the first file and an empty endField selects a single line.
+// A range which isn't within one of the files adds an error to the "lines" field of the form.
+func formLines(form *forms.Form, fileField, startField, endField string, files []*models.File) models.LineRange {
+	if form.Get(startField) == "" && form.Get(endField) == "" {
+		return models.LineRange{}
+	}
+
+	position := 1
+	var err error
+	if form.Get(fileField) != "" {
+		position, err = strconv.Atoi(form.Get(fileField))
+	}
+	// Binary files have no lines to comment on.
+	if err != nil || position < 1 || position > len(files) || files[position-1].Binary {
+		form.Errors.Add("lines", "Choose one of the text files")
+		return models.LineRange{}
+	}
+
+	start, err := strconv.Atoi(form.Get(startField))
+	end := start
+	if err == nil && form.Get(endField) != "" {
+		end, err = strconv.Atoi(form.Get(endField))
+	}
+
+	if n := len(splitLines(files[position-1].Content)); err != nil || start < 1 || end < start || end > n {
+		form.Errors.Add("lines", fmt.Sprintf("Choose lines between 1 and %d", n))
+		return models.LineRange{}
+	}
+
+	return models.LineRange{File: position, Start: start, End: end}
+}
+
+// publishAtLayout is the layout of the times sent by <input type='datetime-local'>.
+const publishAtLayout = "2006-01-02T15:04"
+
+// formPublishAt returns the time a snippet is scheduled to be published at, given in UTC in a form field. An empty
+// field publishes the snippet right away and returns the zero time. Invalid times and times which aren't after now
+// add an error to the form.
+func formPublishAt(form *forms.Form, field string, now time.Time) time.Time {
+	value := form.Get(field)
+	if value == "" {
+		return time.Time{}
+	}
+
+	t, err := time.Parse(publishAtLayout, value)
+	if err != nil {
+		form.Errors.Add(field, "This field is not a valid time")
+		return time.Time{}
+	}
+	if !t.After(now) {
+		form.Errors.Add(field, "This time has already passed")
+		return time.Time{}
+	}
+
+	return t
+}
+
+// checkPassword applies the password policy to a form field and adds the reasons the password is refused, if
+// any, to the form errors. The personal values, like the user's name and email address, must not appear in the
+// password. Fields which already failed validation are left alone.
+func (app *application) checkPassword(form *forms.Form, field string, personal ...string) error {
+	if form.Errors.Get(field) != "" {
+		return nil
+	}
+
+	reasons, err := app.passwordPolicy.Check(form.Get(field), personal...)
+	if err != nil {
+		return err
+	}
+
+	for _, reason := range reasons {
+		form.Errors.Add(field, reason)
+	}
+
+	return nil
+}
+
+// audit appends an event triggered by a request to the audit log.
+func (app *application) audit(r *http.Request, userID int, event, details string) error {
+	return app.auditLog.Insert(userID, event, clientIP(r), details)
+}
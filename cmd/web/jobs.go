@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// reapSnippets purges the expired snippets, along with their comments and stars, every interval. The file contents
+// no snippet uses anymore are deleted afterwards, along with their blobs.
+// It never returns, so it should be run in its own goroutine.
+func (app *application) reapSnippets(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		app.reapSnippetsOnce()
+		<-ticker.C
+	}
+}
+
+// reapSnippetsOnce purges the expired snippets and the unused contents. Errors are logged: the next run will try
+// again.
+func (app *application) reapSnippetsOnce() {
+	n, err := app.snippets.DeleteExpired()
+	if err != nil {
+		app.errorLog.Printf("reaper: %s", err)
+		return
+	}
+
+	if n > 0 {
+		app.infoLog.Printf("reaper: purged %d expired snippets", n)
+	}
+
+	// Deleted snippets, expired or not, leave their contents behind when no other snippet shares them.
+	n, err = app.snippets.DeleteUnusedContents()
+	if err != nil {
+		app.errorLog.Printf("reaper: %s", err)
+		return
+	}
+
+	if n > 0 {
+		app.infoLog.Printf("reaper: deleted %d unused contents", n)
+	}
+}
+
+// publishSnippets publishes the scheduled snippets whose time has come every interval.
+// It never returns, so it should be run in its own goroutine.
+func (app *application) publishSnippets(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		app.publishSnippetsOnce()
+		<-ticker.C
+	}
+}
+
+// publishedEvent is the payload of the webhook notifications sent when a snippet is published.
+type publishedEvent struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Title     string    `json:"title"`
+	URL       string    `json:"url"`
+	Published time.Time `json:"published"`
+}
+
+// publishSnippetsOnce publishes the scheduled snippets whose time has come and notifies the webhooks of the public
+// ones: the snippets of organizations aren't sent to other services. Errors are logged, a failed notification
+// isn't sent again.
+func (app *application) publishSnippetsOnce() {
+	snippets, err := app.snippets.PublishDue()
+	if err != nil {
+		app.errorLog.Printf("scheduler: %s", err)
+		return
+	}
+
+	for _, s := range snippets {
+		app.infoLog.Printf("scheduler: published snippet %d", s.ID)
+
+		if app.notifier == nil || s.OrgID != 0 {
+			continue
+		}
+
+		err = app.notifier.Notify("snippet.published", &publishedEvent{
+			ID:        s.ID,
+			UserID:    s.UserID,
+			Title:     s.Title,
+			URL:       fmt.Sprintf("%s/snippet/%d", app.baseURL, s.ID),
+			Published: s.Created,
+		})
+		if err != nil {
+			app.errorLog.Printf("scheduler: notifying the publication of snippet %d: %s", s.ID, err)
+		}
+	}
+}
+
+// flushViews saves the views counted in memory every interval.
+// It never returns, so it should be run in its own goroutine.
+func (app *application) flushViews(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		<-ticker.C
+		app.flushViewsOnce()
+	}
+}
+
+// flushViewsOnce saves the views counted since the last run in a single batch. Errors are logged and the views are
+// kept for the next run.
+func (app *application) flushViewsOnce() {
+	counts := app.viewCounter.take(time.Now())
+	if len(counts) == 0 {
+		return
+	}
+
+	err := app.views.Record(counts)
+	if err != nil {
+		app.errorLog.Printf("views: %s", err)
+		app.viewCounter.putBack(counts)
+	}
+}
+
+// rankSnippets computes the trending and popular rankings every interval.
+// It never returns, so it should be run in its own goroutine.
+func (app *application) rankSnippets(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		app.rankSnippetsOnce()
+		<-ticker.C
+	}
+}
+
+// rankSnippetsOnce computes the rankings. Errors are logged: the pages keep showing the previous rankings until
+// the next run.
+func (app *application) rankSnippetsOnce() {
+	err := app.rankings.Refresh()
+	if err != nil {
+		app.errorLog.Printf("rankings: %s", err)
+	}
+}
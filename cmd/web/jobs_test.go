@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/luca0x333/go-snippetbox/pkg/webhook"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPublishSnippetsOnce(t *testing.T) {
+	var events []publishedEvent
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get(webhook.SignatureHeader) != webhook.Sign("s3cret", body) {
+			t.Errorf("want a valid signature; got %q", r.Header.Get(webhook.SignatureHeader))
+		}
+
+		var e publishedEvent
+		err := json.Unmarshal(body, &e)
+		if err != nil {
+			t.Error(err)
+		}
+		events = append(events, e)
+	}))
+	defer receiver.Close()
+
+	app := newTestApplication(t)
+	app.notifier = &webhook.Notifier{URLs: []string{receiver.URL}, Secret: "s3cret"}
+
+	// The mock publishes a public snippet and an organization snippet, only the public one is sent.
+	app.publishSnippetsOnce()
+
+	if len(events) != 1 {
+		t.Fatalf("want 1 notification; got %d", len(events))
+	}
+	if events[0].ID != 1 || events[0].URL != "https://snippetbox.example/snippet/1" {
+		t.Errorf("want a notification about snippet 1; got %+v", events[0])
+	}
+}
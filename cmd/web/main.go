@@ -1,16 +1,24 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"database/sql"
 	"flag"
 	"github.com/golangcollege/sessions"
+	"github.com/luca0x333/go-snippetbox/pkg/auth"
+	"github.com/luca0x333/go-snippetbox/pkg/mail"
 	"github.com/luca0x333/go-snippetbox/pkg/models"
 	"github.com/luca0x333/go-snippetbox/pkg/models/mysql"
+	"github.com/luca0x333/go-snippetbox/pkg/oidc"
+	"github.com/luca0x333/go-snippetbox/pkg/passwords"
+	"github.com/luca0x333/go-snippetbox/pkg/storage"
+	"github.com/luca0x333/go-snippetbox/pkg/webhook"
 	"html/template"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -18,22 +26,126 @@ import (
 
 type contextKey string
 
-const contextKeyIsAuthenticated = contextKey("isAuthenticated")
+const (
+	contextKeyIsAuthenticated = contextKey("isAuthenticated")
+	contextKeyStreamWriter    = contextKey("streamWriter")
+	contextKeyUser            = contextKey("user")
+	contextKeyUserSession     = contextKey("userSession")
+)
 
 type application struct {
-	errorLog *log.Logger
-	infoLog  *log.Logger
+	// archiveTimeout is how long an archive may take to send, longer than the WriteTimeout of the server.
+	archiveTimeout time.Duration
+	auditLog       interface {
+		Insert(int, string, string, string) error
+		Search(models.AuditFilter, int) ([]*models.AuditEvent, error)
+		Each(models.AuditFilter, func(*models.AuditEvent) error) error
+	}
+	// baseURL is the URL of the site, used in the links sent to other services, ex: "https://snippetbox.example".
+	baseURL  string
+	comments interface {
+		Insert(int, int, int, int, models.LineRange, string) (int, error)
+		Get(int) (*models.Comment, error)
+		ForSnippet(int) ([]*models.Comment, error)
+		Update(int, string) error
+		Delete(int) error
+	}
+	errorLog   *log.Logger
+	identities interface {
+		Insert(string, string, int) error
+		Get(string, string) (int, error)
+	}
+	infoLog       *log.Logger
+	loginAttempts interface {
+		Insert(string, string) (int, error)
+		Clear(string) error
+		ClearIP(string) error
+		EmailFailures(string, int, time.Time) (*models.LoginFailures, error)
+		IPFailures(string, int, time.Time) (*models.LoginFailures, error)
+	}
+	loginThrottle *loginThrottle
+	// mailer, if set, sends emails, ex: the invitations to join organizations.
+	mailer interface {
+		Send(string, string, string) error
+	}
+	// notifier, if set, notifies other services of the snippets published.
+	notifier      *webhook.Notifier
+	oidc          *oidc.Provider
+	organizations interface {
+		Insert(string, int) (int, error)
+		Get(int, int) (*models.Organization, error)
+		ForUser(int) ([]*models.Organization, error)
+		Members(int) ([]*models.Membership, error)
+		Invite(int, string, string, int) (string, error)
+		Invitation(string) (*models.Invitation, error)
+		AcceptInvitation(string, int) (int, error)
+		DeclineInvitation(string) error
+		RemoveMember(int, int) error
+	}
+	passwordPolicy *passwords.Policy
+	rankings       interface {
+		Refresh() error
+		Get(string, int) ([]*models.Snippet, error)
+	}
 	session  *sessions.Session
 	snippets interface {
-		Insert(string, string, string) (int, error)
-		Get(int) (*models.Snippet, error)
+		Insert(int, int, string, []*models.File, string, time.Time) (int, error)
+		Get(int, int) (*models.Snippet, error)
+		Find(int, int) (*models.Snippet, error)
+		Fork(int, int) (int, error)
+		Forks(int, int) ([]*models.Snippet, error)
+		Update(int, string, []*models.File) (int, error)
+		Revision(int, int) (*models.Revision, error)
+		FindRevision(int, int) (*models.Revision, error)
+		Revisions(int) ([]*models.Revision, error)
+		EachFile(int, int, func(*models.File) error) error
 		Latest() ([]*models.Snippet, error)
+		Popular() ([]*models.Snippet, error)
+		ByAuthor(int, int, int) ([]*models.Snippet, error)
+		ForOrg(int) ([]*models.Snippet, error)
+		Scheduled(int) ([]*models.Snippet, error)
+		PublishDue() ([]*models.Snippet, error)
+		Delete(int) error
+		DeleteExpired() (int, error)
+		DeleteUnusedContents() (int, error)
+	}
+	snippetTemplates interface {
+		Insert(int, int, string, string, []*models.File, string) (int, error)
+		Get(int, int) (*models.SnippetTemplate, error)
+		ForUser(int) ([]*models.SnippetTemplate, error)
+		Delete(int) error
+	}
+	stars interface {
+		Star(int, int) error
+		Unstar(int, int) error
+		IsStarred(int, int) (bool, error)
+		Starred(int) ([]*models.Snippet, error)
 	}
 	templateCache map[string]*template.Template
+	uploads       *uploadPolicy
 	users         interface {
-		Insert(string, string, string) error
+		Insert(string, string, string) (int, error)
 		Authenticate(string, string) (int, error)
 		Get(int) (*models.User, error)
+		GetByEmail(string) (*models.User, error)
+		Provision(string, string) (int, error)
+		Search(string) ([]*models.User, error)
+		SetActive(int, bool) error
+		ChangePassword(int, string, string) error
+	}
+	userSessions interface {
+		Insert(int, string, string, time.Duration) (string, error)
+		Get(string) (*models.Session, error)
+		Touch(int, string) error
+		List(int) ([]*models.Session, error)
+		Revoke(int, int) error
+		RevokeAll(int) error
+	}
+	viewCounter *viewCounter
+	views       interface {
+		Record([]*models.ViewCount) error
+		Daily(int, time.Time) ([]*models.DailyViews, error)
+		Referrers(int, time.Time, int) ([]*models.Referrer, error)
 	}
 }
 
@@ -42,6 +154,49 @@ func main() {
 	addr := flag.String("addr", ":4000", "HTTP network address")
 	dsn := flag.String("dsn", "web_user:password@/snippetbox?parseTime=true", "MySQL data source name")
 	secret := flag.String("secret", "z6Nah+pPonzHbI*+9Pk8qNWhTzbpa@ge", "Secret Key")
+	loginMaxFailures := flag.Int("login-max-failures", 10, "Failed logins before an account is locked")
+	loginLockout := flag.Duration("login-lockout", 15*time.Minute, "How long a locked account stays locked")
+	loginDelay := flag.Duration("login-delay", time.Second, "Initial delay imposed after repeated failed logins")
+	oidcIssuer := flag.String("oidc-issuer", "", "OpenID Connect issuer URL, enables single sign-on")
+	oidcClientID := flag.String("oidc-client-id", "", "OpenID Connect client ID")
+	oidcClientSecret := flag.String("oidc-client-secret", "", "OpenID Connect client secret")
+	oidcRedirectURL := flag.String("oidc-redirect-url", "https://localhost:4000/user/login/sso/callback",
+		"OpenID Connect redirect URL")
+	ldapURL := flag.String("ldap-url", "", "LDAP server URL, enables directory logins")
+	ldapStartTLS := flag.Bool("ldap-starttls", false, "Upgrade the LDAP connection with StartTLS")
+	ldapUserDN := flag.String("ldap-user-dn", "",
+		"Template of the DN to bind as, ex: uid={username},ou=people,dc=example,dc=com")
+	ldapBaseDN := flag.String("ldap-base-dn", "", "Base DN searched for the user when -ldap-user-dn is empty")
+	ldapFilter := flag.String("ldap-filter", "(mail={email})", "Filter used to search for the user")
+	ldapBindDN := flag.String("ldap-bind-dn", "", "DN of the service account used to search, anonymous if empty")
+	ldapBindPassword := flag.String("ldap-bind-password", "", "Password of the LDAP service account")
+	breachedPasswords := flag.String("breached-passwords", "",
+		"Directory of SHA-1 range files of breached passwords, in the Have I Been Pwned format")
+	passwordMinEntropy := flag.Float64("password-min-entropy", 40, "Minimum estimated entropy of passwords, in bits")
+	passwordRejectPersonal := flag.Bool("password-reject-personal", true,
+		"Refuse passwords containing the user's name or email address")
+	reapInterval := flag.Duration("reap-interval", time.Hour, "How often expired snippets are purged")
+	rankInterval := flag.Duration("rank-interval", 10*time.Minute, "How often trending and popular snippets are ranked")
+	publishInterval := flag.Duration("publish-interval", time.Minute, "How often scheduled snippets are published")
+	baseURL := flag.String("base-url", "https://localhost:4000", "URL of the site, used in links sent elsewhere")
+	viewWindow := flag.Duration("view-window", 30*time.Minute, "Time during which a visitor's views count only once")
+	viewsFlushInterval := flag.Duration("views-flush-interval", time.Minute, "How often view counts are saved")
+	smtpAddr := flag.String("smtp-addr", "", "SMTP server address, ex: smtp.example.com:587, enables emails")
+	smtpFrom := flag.String("smtp-from", "Snippetbox <noreply@localhost>", "Address the emails are sent from")
+	smtpUsername := flag.String("smtp-username", "", "SMTP username, no authentication if empty")
+	smtpPassword := flag.String("smtp-password", "", "SMTP password")
+	webhookURLs := flag.String("webhook-urls", "", "Comma-separated URLs notified when snippets are published")
+	webhookSecret := flag.String("webhook-secret", "", "Secret signing the webhook requests")
+	maxUploadSize := flag.Int64("max-upload-size", 1<<20, "Maximum size of a file uploaded to a snippet, in bytes")
+	allowBinaryUploads := flag.Bool("allow-binary-uploads", false, "Accept binary files, like images, in snippets")
+	blobDir := flag.String("blob-dir", "", "Directory storing large file contents instead of the database")
+	blobThreshold := flag.Int("blob-threshold", 32<<10, "Size in bytes above which contents go to the blob store")
+	s3Endpoint := flag.String("s3-endpoint", "https://s3.amazonaws.com", "S3 compatible object store URL")
+	s3Region := flag.String("s3-region", "us-east-1", "Region of the S3 bucket")
+	s3Bucket := flag.String("s3-bucket", "", "S3 bucket storing large file contents, takes precedence over -blob-dir")
+	s3AccessKey := flag.String("s3-access-key", "", "S3 access key ID")
+	s3SecretKey := flag.String("s3-secret-key", "", "S3 secret access key")
+	archiveTimeout := flag.Duration("archive-timeout", 10*time.Minute, "How long an archive download may take to send")
 
 	flag.Parse()
 
@@ -74,14 +229,112 @@ func main() {
 	session.Secure = true
 	session.SameSite = http.SameSiteStrictMode
 
+	// Discover the OpenID Connect provider if single sign-on is enabled.
+	var provider *oidc.Provider
+	if *oidcIssuer != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		provider, err = oidc.NewProvider(ctx, oidc.Config{
+			Issuer:       *oidcIssuer,
+			ClientID:     *oidcClientID,
+			ClientSecret: *oidcClientSecret,
+			RedirectURL:  *oidcRedirectURL,
+		})
+		cancel()
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+	}
+
+	passwordPolicy := &passwords.Policy{
+		RejectPersonalInfo: *passwordRejectPersonal,
+		MinEntropy:         *passwordMinEntropy,
+	}
+	if *breachedPasswords != "" {
+		passwordPolicy.Breached = &passwords.Corpus{Dir: *breachedPasswords}
+	}
+
+	// Passwords are checked against the local users table, after the directory server if one is configured.
+	users := &mysql.UserModel{DB: db, ErrorLog: errorLog}
+	if *ldapURL != "" {
+		users.Authenticators = []auth.Authenticator{
+			&auth.LDAP{
+				URL:          *ldapURL,
+				StartTLS:     *ldapStartTLS,
+				UserDN:       *ldapUserDN,
+				BaseDN:       *ldapBaseDN,
+				Filter:       *ldapFilter,
+				BindDN:       *ldapBindDN,
+				BindPassword: *ldapBindPassword,
+				Users:        users,
+			},
+		}
+	}
+
+	// Large file contents are kept out of the database when a blob store is configured.
+	var blobs storage.BlobStore
+	switch {
+	case *s3Bucket != "":
+		blobs = &storage.S3{
+			Endpoint:  *s3Endpoint,
+			Region:    *s3Region,
+			Bucket:    *s3Bucket,
+			AccessKey: *s3AccessKey,
+			SecretKey: *s3SecretKey,
+		}
+	case *blobDir != "":
+		blobs = &storage.Local{Dir: *blobDir}
+	}
+
+	// Other services are notified of new snippets when webhooks are configured.
+	var notifier *webhook.Notifier
+	if *webhookURLs != "" {
+		notifier = &webhook.Notifier{URLs: strings.Split(*webhookURLs, ","), Secret: *webhookSecret}
+	}
+
+	viewCounter, err := newViewCounter(*viewWindow)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
 	// Initialize a new instance of application.
 	app := &application{
-		errorLog:      errorLog,
-		infoLog:       infoLog,
-		session:       session,
-		snippets:      &mysql.SnippetModel{DB: db},
-		templateCache: templateCache,
-		users:         &mysql.UserModel{DB: db},
+		archiveTimeout: *archiveTimeout,
+		auditLog:       &mysql.AuditLogModel{DB: db},
+		baseURL:        strings.TrimSuffix(*baseURL, "/"),
+		comments:       &mysql.CommentModel{DB: db},
+		errorLog:       errorLog,
+		identities:     &mysql.IdentityModel{DB: db},
+		infoLog:        infoLog,
+		loginAttempts:  &mysql.LoginAttemptModel{DB: db},
+		loginThrottle: &loginThrottle{
+			maxFailures: *loginMaxFailures,
+			lockout:     *loginLockout,
+			baseDelay:   *loginDelay,
+			maxDelay:    *loginLockout,
+		},
+		notifier:         notifier,
+		oidc:             provider,
+		organizations:    &mysql.OrganizationModel{DB: db},
+		passwordPolicy:   passwordPolicy,
+		rankings:         &mysql.RankingModel{DB: db},
+		session:          session,
+		snippets:         &mysql.SnippetModel{DB: db, Blobs: blobs, BlobThreshold: *blobThreshold},
+		snippetTemplates: &mysql.SnippetTemplateModel{DB: db, Blobs: blobs, BlobThreshold: *blobThreshold},
+		stars:            &mysql.StarModel{DB: db},
+		templateCache:    templateCache,
+		uploads: &uploadPolicy{
+			maxFileSize: *maxUploadSize,
+			allowBinary: *allowBinaryUploads,
+		},
+		users:        users,
+		userSessions: &mysql.SessionModel{DB: db},
+		viewCounter:  viewCounter,
+		views:        &mysql.ViewModel{DB: db},
+	}
+
+	// Invitations are emailed when an SMTP server is configured, otherwise their links are shown to the owners.
+	if *smtpAddr != "" {
+		app.mailer = &mail.Sender{Addr: *smtpAddr, From: *smtpFrom, Username: *smtpUsername, Password: *smtpPassword}
 	}
 
 	// Initialize a new tls.Config struct to overwrite the default TLS settings we want to change.
@@ -106,6 +359,13 @@ func main() {
 		WriteTimeout: 10 * time.Second,
 	}
 
+	// Purge the expired snippets, publish the scheduled ones, save the view counts and rank the snippets in the
+	// background.
+	go app.reapSnippets(*reapInterval)
+	go app.publishSnippets(*publishInterval)
+	go app.flushViews(*viewsFlushInterval)
+	go app.rankSnippets(*rankInterval)
+
 	// flag.String() returns a pointer.
 	infoLog.Printf("Starting server on %s", *addr)
 	err = srv.ListenAndServeTLS("./tls/cert.pem", "./tls/key.pem")
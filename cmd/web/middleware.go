@@ -7,6 +7,7 @@ import (
 	"github.com/justinas/nosurf"
 	"github.com/luca0x333/go-snippetbox/pkg/models"
 	"net/http"
+	"time"
 )
 
 // secureHeaders add two Http headers to every response.
@@ -21,6 +22,17 @@ func secureHeaders(next http.Handler) http.Handler {
 	})
 }
 
+// allowFraming lets other sites show a page in a frame, overriding the X-Frame-Options header set by
+// secureHeaders. It is only meant for the pages made to be embedded.
+func allowFraming(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Del("X-Frame-Options")
+		w.Header().Set("Content-Security-Policy", "frame-ancestors *")
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 // logRequest <-> secureHeaders <-> servemux <-> application handler
 func (app *application) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -66,6 +78,44 @@ func (app *application) requireAuthentication(next http.Handler) http.Handler {
 	})
 }
 
+// requireAdmin only lets requests from authenticated administrators through.
+// It must be chained after requireAuthentication.
+func (app *application) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.authenticatedUser(r)
+		if user == nil || !user.IsAdmin {
+			app.clientError(w, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeDeadliner is implemented by the ResponseWriters of the HTTP/1 and HTTP/2 servers of net/http since Go 1.20.
+type writeDeadliner interface {
+	SetWriteDeadline(time.Time) error
+}
+
+// streamResponse lets a handler stream a large response, ex: an archive. It must be chained before the session
+// middleware, which buffers the whole response to set the cookie first: it stores the ResponseWriter it is given in
+// the request context for streamWriter.
+// It also lets the response take up to archiveTimeout to send instead of the WriteTimeout of the server, when the
+// ResponseWriter supports it.
+func (app *application) streamResponse(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wd, ok := w.(writeDeadliner); ok {
+			err := wd.SetWriteDeadline(time.Now().Add(app.archiveTimeout))
+			if err != nil {
+				app.errorLog.Print(err)
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), contextKeyStreamWriter, w)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 // NoSurf is a middleware function which uses a customized CSRF cookie with
 // the Secure, Path and HttpOnly flags set.
 func NoSurf(next http.Handler) http.Handler {
@@ -79,24 +129,37 @@ func NoSurf(next http.Handler) http.Handler {
 	return csrfHandler
 }
 
-// authenticate middleware fetches the user's ID from their session, checks the database to see if the ID is valid
-// and the user is active, then updates the request context to include this information.
+// authenticate middleware fetches the server-side session referenced by the token stored in the user's session
+// cookie, checks the database to see if the session is still valid and its user is active, then updates the
+// request context to include this information.
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Check if a authenticatedUserID value exists in the session.
+		// Check if a session token exists in the cookie session.
 		// If it does not exist call the next handler in the chain.
-		exists := app.session.Exists(r, "authenticatedUserID")
-		if !exists {
+		token := app.session.GetString(r, "sessionToken")
+		if token == "" {
 			next.ServeHTTP(w, r)
 			return
 		}
 
+		// Fetch the server-side session. If it has been revoked or has expired, remove the token from the
+		// cookie session and call the next handler in the chain.
+		us, err := app.userSessions.Get(token)
+		if errors.Is(err, models.ErrNoRecord) {
+			app.session.Remove(r, "sessionToken")
+			next.ServeHTTP(w, r)
+			return
+		} else if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
 		// Fetch the details of the current user from the database.
-		// If no record is found or the user is deactivated, remove "authenticatedUserID" value from their session
+		// If no record is found or the user is deactivated, remove "sessionToken" value from their session
 		// and call the next handler in the chain.
-		user, err := app.users.Get(app.session.GetInt(r, "authenticatedUserID"))
-		if errors.Is(err, models.ErrNoRecord) || !user.Active {
-			app.session.Remove(r, "authenticatedUserID")
+		user, err := app.users.Get(us.UserID)
+		if errors.Is(err, models.ErrNoRecord) || (err == nil && !user.Active) {
+			app.session.Remove(r, "sessionToken")
 			next.ServeHTTP(w, r)
 			return
 		} else if err != nil {
@@ -104,9 +167,22 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
+		// Record when and from where the session was last used. This is done at most once a minute to avoid
+		// a database write on every request.
+		if time.Since(us.LastSeen) > time.Minute {
+			err = app.userSessions.Touch(us.ID, clientIP(r))
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+		}
+
 		// If the request is coming from an authenticated and active user, we create a new copy of the request adding
-		// "contextKeyIsAuthenticated" true and call the next handler in the chain using the new copy of the request.
+		// "contextKeyIsAuthenticated" true, the user and the session, then call the next handler in the chain using the new
+		// copy of the request.
 		ctx := context.WithValue(r.Context(), contextKeyIsAuthenticated, true)
+		ctx = context.WithValue(ctx, contextKeyUser, user)
+		ctx = context.WithValue(ctx, contextKeyUserSession, us)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
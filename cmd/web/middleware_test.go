@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestSecureHeaders(t *testing.T) {
@@ -57,3 +58,44 @@ func TestSecureHeaders(t *testing.T) {
 		t.Errorf("want body equal %q", "OK")
 	}
 }
+
+// deadlineRecorder is a ResponseRecorder recording the write deadline set on it.
+type deadlineRecorder struct {
+	*httptest.ResponseRecorder
+	deadline time.Time
+}
+
+func (rr *deadlineRecorder) SetWriteDeadline(deadline time.Time) error {
+	rr.deadline = deadline
+	return nil
+}
+
+func TestStreamResponse(t *testing.T) {
+	app := newTestApplication(t)
+	rr := &deadlineRecorder{ResponseRecorder: httptest.NewRecorder()}
+
+	r, err := http.NewRequest(http.MethodGet, "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// What the handler writes to the stream writer reaches the client right away, although the session middleware
+	// buffers the response.
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w = app.streamWriter(w, r)
+		w.Write([]byte("PK"))
+		if got := rr.Body.String(); got != "PK" {
+			t.Errorf("want the response streamed; got %q written", got)
+		}
+	})
+
+	start := time.Now()
+	app.streamResponse(app.session.Enable(next)).ServeHTTP(rr, r)
+
+	if rr.deadline.Before(start.Add(app.archiveTimeout)) {
+		t.Errorf("want the write deadline extended by %v; got %v", app.archiveTimeout, rr.deadline.Sub(start))
+	}
+	if got := rr.Body.String(); got != "PK" {
+		t.Errorf("want body %q; got %q", "PK", got)
+	}
+}
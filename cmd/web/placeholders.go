@@ -0,0 +1,58 @@
+package main
+
+import (
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"regexp"
+	"time"
+)
+
+// placeholderRX matches the placeholders of snippet templates, ex: {{date}} or {{ date }}.
+var placeholderRX = regexp.MustCompile(`\{\{\s*([a-z]+)\s*\}\}`)
+
+// placeholders returns the values of the placeholders of snippet templates for a snippet created by a user at a
+// given time:
+//
+//	{{date}}  the date, ex: 2021-03-14
+//	{{time}}  the time of day, ex: 15:04
+//	{{year}}  the year, ex: 2021
+//	{{user}}  the name of the user
+//
+// Dates and times are in UTC, like the dates shown on the site.
+func placeholders(user *models.User, now time.Time) map[string]string {
+	now = now.UTC()
+
+	return map[string]string{
+		"date": now.Format("2006-01-02"),
+		"time": now.Format("15:04"),
+		"year": now.Format("2006"),
+		"user": user.Name,
+	}
+}
+
+// expandPlaceholders replaces the placeholders in s by their values. Unknown placeholders are left as they are,
+// so snippets can still hold text looking like them, ex: Go templates.
+func expandPlaceholders(s string, values map[string]string) string {
+	return placeholderRX.ReplaceAllStringFunc(s, func(placeholder string) string {
+		value, ok := values[placeholderRX.FindStringSubmatch(placeholder)[1]]
+		if !ok {
+			return placeholder
+		}
+		return value
+	})
+}
+
+// templateFiles returns the files of a snippet template with their placeholders expanded, ready to fill in the
+// snippet creation form. Binary files are copied as they are.
+func templateFiles(t *models.SnippetTemplate, values map[string]string) []*models.File {
+	var files []*models.File
+	for _, f := range t.Files {
+		file := *f
+		if !file.Binary {
+			file.Name = expandPlaceholders(file.Name, values)
+			file.Content = expandPlaceholders(file.Content, values)
+		}
+		files = append(files, &file)
+	}
+
+	return files
+}
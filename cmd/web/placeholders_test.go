@@ -0,0 +1,33 @@
+package main
+
+import (
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"testing"
+	"time"
+)
+
+func TestExpandPlaceholders(t *testing.T) {
+	// Placeholders are expanded in UTC.
+	now := time.Date(2021, 3, 14, 23, 30, 0, 0, time.FixedZone("UTC-1", -3600))
+	values := placeholders(&models.User{Name: "Alice"}, now)
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"Date", "Incident of {{date}}", "Incident of 2021-03-15"},
+		{"Spaces", "{{ time }} by {{ user }}", "00:30 by Alice"},
+		{"Year", "(c) {{year}}", "(c) 2021"},
+		{"Unknown placeholder", "{{.Title}} {{month}}", "{{.Title}} {{month}}"},
+		{"No placeholder", "SELECT 1;", "SELECT 1;"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expandPlaceholders(tt.input, values); got != tt.want {
+				t.Errorf("want %q; got %q", tt.want, got)
+			}
+		})
+	}
+}
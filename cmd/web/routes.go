@@ -14,24 +14,87 @@ func (app *application) routes() http.Handler {
 	// our dynamic application routes.
 	// Add NoSurf middleware function to all dynamic routes to prevent CSRF attacks.
 	// Add authenticate() middleware.
-	dynamicMiddleware := alice.New(app.session.Enable, NoSurf, app.authenticate)
+	dynamicMiddleware := alice.New(app.session.Enable, app.limitRequestBody, NoSurf, app.authenticate)
+
+	// The snippet forms upload files, only they accept large bodies and multipart forms.
+	uploadMiddleware := alice.New(app.session.Enable, app.limitUploadBody, NoSurf, app.authenticate,
+		app.requireAuthentication)
+
+	// Archives are streamed past the buffer of the session middleware, see streamResponse.
+	archiveMiddleware := alice.New(app.streamResponse, app.session.Enable, app.limitRequestBody, NoSurf,
+		app.authenticate)
+
+	// The embedded pages are shown on other sites: they don't use the session, which isn't sent by browsers
+	// blocking third-party cookies anyway, and must not read or write it.
+	embedMiddleware := alice.New(allowFraming)
 
 	// Initialize a new mux using pat package.
 	// Pat matches patterns in the order that they are registered.
 	// We need to register GET "/snippet/create/" before GET "/snippet/:id"
 	mux := pat.New()
 	mux.Get("/", dynamicMiddleware.ThenFunc(app.home))
+	mux.Get("/trending", dynamicMiddleware.ThenFunc(app.trending))
+	mux.Get("/popular", dynamicMiddleware.ThenFunc(app.popular))
 	mux.Get("/snippet/create", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.createSnippetForm))
-	mux.Post("/snippet/create", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.createSnippet))
+	mux.Post("/snippet/create", uploadMiddleware.ThenFunc(app.createSnippet))
 	mux.Get("/snippet/:id", dynamicMiddleware.ThenFunc(app.showSnippet))
+	mux.Get("/snippet/:id/embed", embedMiddleware.ThenFunc(app.embedSnippet))
+	mux.Get("/snippet/:id/embed.js", http.HandlerFunc(app.embedScript))
+	mux.Get("/snippet/:id/raw/:name", dynamicMiddleware.ThenFunc(app.rawFile))
+	mux.Get("/snippet/:id/archive.:format", archiveMiddleware.ThenFunc(app.downloadArchive))
+	mux.Get("/snippet/:id/edit", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.editSnippetForm))
+	mux.Post("/snippet/:id/edit", uploadMiddleware.ThenFunc(app.editSnippet))
+	mux.Post("/snippet/:id/comments", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.createComment))
+	mux.Get("/comment/:id/edit", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.editCommentForm))
+	mux.Post("/comment/:id/edit", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.editComment))
+	mux.Post("/comment/:id/delete", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.deleteComment))
+	mux.Get("/snippet/:id/template", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.createTemplateForm))
+	mux.Post("/snippet/:id/template", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.createTemplate))
+	mux.Get("/snippet/:id/stats", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.snippetStats))
+	mux.Post("/snippet/:id/fork", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.forkSnippet))
+	mux.Post("/snippet/:id/star", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.starSnippet))
+	mux.Post("/snippet/:id/unstar", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.unstarSnippet))
+	mux.Get("/u/:id", dynamicMiddleware.ThenFunc(app.showProfile))
 
 	mux.Get("/user/signup", dynamicMiddleware.ThenFunc(app.signupUserForm))
 	mux.Post("/user/signup", dynamicMiddleware.ThenFunc(app.signupUser))
 	mux.Get("/user/login", dynamicMiddleware.ThenFunc(app.loginUserForm))
 	mux.Post("/user/login", dynamicMiddleware.ThenFunc(app.loginUser))
+	mux.Get("/user/login/sso", dynamicMiddleware.ThenFunc(app.ssoLogin))
+	mux.Get("/user/login/sso/callback", dynamicMiddleware.ThenFunc(app.ssoCallback))
 	mux.Post("/user/logout", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.logoutUser))
+	mux.Get("/user/password", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.changePasswordForm))
+	mux.Post("/user/password", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.changePassword))
+	mux.Get("/user/stars", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.listStars))
+	mux.Get("/user/templates", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.listTemplates))
+	mux.Post("/template/:id/delete", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.deleteTemplate))
+	mux.Get("/user/sessions", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.listUserSessions))
+	mux.Post("/user/sessions/revoke-all", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.revokeAllUserSessions))
+	mux.Post("/user/sessions/:id/revoke", dynamicMiddleware.Append(app.requireAuthentication).ThenFunc(app.revokeUserSession))
+
+	// Organizations, only available to authenticated users. Members can only see the organizations they belong to.
+	authMiddleware := dynamicMiddleware.Append(app.requireAuthentication)
+	mux.Get("/orgs", authMiddleware.ThenFunc(app.listOrganizations))
+	mux.Post("/orgs", authMiddleware.ThenFunc(app.createOrganization))
+	mux.Get("/org/:id", authMiddleware.ThenFunc(app.showOrganization))
+	mux.Post("/org/:id/invite", authMiddleware.ThenFunc(app.inviteMember))
+	mux.Post("/org/:id/members/:userID/remove", authMiddleware.ThenFunc(app.removeMember))
+	mux.Get("/invitations/:token", authMiddleware.ThenFunc(app.showInvitation))
+	mux.Post("/invitations/:token/accept", authMiddleware.ThenFunc(app.acceptInvitation))
+	mux.Post("/invitations/:token/decline", authMiddleware.ThenFunc(app.declineInvitation))
+
+	// Administration routes, only available to authenticated administrators.
+	adminMiddleware := dynamicMiddleware.Append(app.requireAuthentication, app.requireAdmin)
+	mux.Get("/admin", adminMiddleware.ThenFunc(app.adminDashboard))
+	mux.Post("/admin/users/:id/activate", adminMiddleware.ThenFunc(app.activateUser))
+	mux.Post("/admin/users/:id/deactivate", adminMiddleware.ThenFunc(app.deactivateUser))
+	mux.Post("/admin/users/:id/unlock", adminMiddleware.ThenFunc(app.unlockUser))
+	mux.Post("/admin/snippets/:id/delete", adminMiddleware.ThenFunc(app.deleteSnippet))
+	mux.Get("/admin/audit", adminMiddleware.ThenFunc(app.showAuditLog))
+	mux.Get("/admin/audit/export", adminMiddleware.ThenFunc(app.exportAuditLog))
 
 	mux.Get("/ping", http.HandlerFunc(ping))
+	mux.Get("/oembed", http.HandlerFunc(app.oembed))
 
 	fileServer := http.FileServer(http.Dir("./ui/static/"))
 	// There is no need for this route to have stateful behaviour.
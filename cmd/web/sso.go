@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"github.com/luca0x333/go-snippetbox/pkg/oidc"
+	"net/http"
+	"strings"
+)
+
+// Name of the cookie holding the state, the nonce and the PKCE code verifier of a single sign-on attempt.
+// The session cookie can't be used for this: it is SameSite=Strict, so browsers don't send it back when the
+// identity provider redirects to the callback.
+const ssoCookieName = "sso"
+
+var errUnverifiedEmail = errors.New("sso: the identity provider didn't verify the email address")
+
+// ssoUser returns the ID of the local user matching the claims of a validated ID token.
+// The first time an account of the identity provider signs in, it is linked to the user with the same email
+// address, or to a new user if there is none. This is only done when the provider has verified the email
+// address, otherwise anyone could take over an account by registering its email at the provider.
+func (app *application) ssoUser(r *http.Request, claims *oidc.Claims) (int, error) {
+	id, err := app.identities.Get(claims.Issuer, claims.Subject)
+	if err == nil || !errors.Is(err, models.ErrNoRecord) {
+		return id, err
+	}
+
+	if !claims.EmailVerified || claims.Email == "" {
+		return 0, errUnverifiedEmail
+	}
+
+	user, err := app.users.GetByEmail(claims.Email)
+	if err == nil {
+		id = user.ID
+	} else if errors.Is(err, models.ErrNoRecord) {
+		name := claims.Name
+		if name == "" {
+			name = strings.SplitN(claims.Email, "@", 2)[0]
+		}
+
+		id, err = app.users.Provision(name, claims.Email)
+		if err != nil {
+			return 0, err
+		}
+
+		err = app.audit(r, id, auditSignup, claims.Email+" (sso)")
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		return 0, err
+	}
+
+	err = app.identities.Insert(claims.Issuer, claims.Subject, id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
@@ -1,23 +1,160 @@
 package main
 
 import (
+	"encoding/base64"
+	"fmt"
 	"github.com/luca0x333/go-snippetbox/pkg/forms"
+	"github.com/luca0x333/go-snippetbox/pkg/markdown"
 	"github.com/luca0x333/go-snippetbox/pkg/models"
 	"html/template"
+	"net/url"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
 // Define a templateData type to act as the holding structure for
 // any dynamic data that we want to pass to our HTML templates.
 type templateData struct {
-	CSRFToken       string
-	CurrentYear     int
-	Flash           string
-	Form            *forms.Form
-	IsAuthenticated bool
-	Snippet         *models.Snippet
-	Snippets        []*models.Snippet
+	AuditEvents      []string
+	AuditLog         []*models.AuditEvent
+	BaseURL          string
+	Comment          *models.Comment
+	Comments         []*models.Comment
+	CSRFToken        string
+	CurrentUserID    int
+	CurrentYear      int
+	Files            []*file
+	Flash            string
+	Forks            []*models.Snippet
+	Form             *forms.Form
+	FormFiles        []*models.File
+	Invitation       *models.Invitation
+	InvitationToken  string
+	IsAdmin          bool
+	IsAuthenticated  bool
+	Languages        []string
+	Members          []*models.Membership
+	Organization     *models.Organization
+	Organizations    []*models.Organization
+	Pagination       *pagination
+	Query            string
+	Ranking          string
+	RedirectURL      string
+	Scheduled        []*models.Snippet
+	Revision         *models.Revision
+	Revisions        []*models.Revision
+	Snippet          *models.Snippet
+	Snippets         []*models.Snippet
+	SnippetTemplates []*models.SnippetTemplate
+	Sort             string
+	SSOEnabled       bool
+	Starred          bool
+	Stats            *viewStats
+	UserSession      *models.Session
+	User             *models.User
+	Users            []*models.User
+	UserSessions     []*models.Session
+}
+
+// pagination holds the numbers of the current, previous and next pages of a paginated list.
+// Previous and Next are zero when there is no such page.
+type pagination struct {
+	Current  int
+	Previous int
+	Next     int
+}
+
+// file is a file of a snippet split into numbered lines. Binary files have no lines, only a Size in bytes.
+// Content is kept for the files shown rendered, like Markdown documents.
+type file struct {
+	Position int
+	Name     string
+	Language string
+	Binary   bool
+	Size     int
+	Content  string
+	Lines    []*line
+}
+
+// line is a numbered line of a file. Comments are the IDs of the comments about a range of lines ending on this
+// one.
+type line struct {
+	Number   int
+	Text     string
+	Comments []int
+}
+
+// splitLines splits the content of a file into lines. Both "\n" and "\r\n" end a line, and a final line ending
+// doesn't start another line.
+func splitLines(content string) []string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = strings.TrimSuffix(content, "\n")
+
+	return strings.Split(content, "\n")
+}
+
+// numberFiles numbers the lines of the files of the given revision of a snippet, and attaches the comments on
+// that revision to the last line they are about.
+func numberFiles(files []*models.File, revision int, comments []*models.Comment) []*file {
+	var numbered []*file
+	for _, f := range files {
+		nf := &file{Position: f.Position, Name: f.Name, Language: f.Language, Binary: f.Binary, Size: len(f.Content)}
+		if f.Binary {
+			numbered = append(numbered, nf)
+			continue
+		}
+		nf.Content = f.Content
+
+		for i, text := range splitLines(f.Content) {
+			nf.Lines = append(nf.Lines, &line{Number: i + 1, Text: text})
+		}
+
+		for _, c := range comments {
+			if c.Revision == revision && !c.Deleted && c.Lines.File == f.Position && c.Lines.End >= 1 &&
+				c.Lines.End <= len(nf.Lines) {
+				l := nf.Lines[c.Lines.End-1]
+				l.Comments = append(l.Comments, c.ID)
+			}
+		}
+
+		numbered = append(numbered, nf)
+	}
+
+	return numbered
+}
+
+// lineAnchor returns the URL fragment identifying a range of lines of a file, ex: "F1-L12" or "F1-L12-L20".
+func lineAnchor(lines models.LineRange) string {
+	if lines.End <= lines.Start {
+		return fmt.Sprintf("F%d-L%d", lines.File, lines.Start)
+	}
+
+	return fmt.Sprintf("F%d-L%d-L%d", lines.File, lines.Start, lines.End)
+}
+
+// lineLabel describes a range of lines of a file for humans, ex: "file 1, lines 12 to 20".
+func lineLabel(lines models.LineRange) string {
+	if lines.End <= lines.Start {
+		return fmt.Sprintf("file %d, line %d", lines.File, lines.Start)
+	}
+
+	return fmt.Sprintf("file %d, lines %d to %d", lines.File, lines.Start, lines.End)
+}
+
+// base64String encodes a string in base64, used to send binary content back with a form.
+func base64String(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+// markdownHTML renders a Markdown document as sanitized HTML, with the ids of its headings starting with idPrefix.
+func markdownHTML(content, idPrefix string) (template.HTML, error) {
+	b, err := markdown.Render([]byte(content), idPrefix)
+	if err != nil {
+		return "", err
+	}
+
+	return template.HTML(b), nil
 }
 
 // humanDate returns a nicely formatted string containing time.Time object.
@@ -31,13 +168,58 @@ func humanDate(t time.Time) string {
 	return t.UTC().Format("02 Jan 2006 at 15:04")
 }
 
+// device returns a short description of the browser and operating system found in a User-Agent header,
+// ex: "Firefox on Linux".
+func device(userAgent string) string {
+	// The order matters: Chrome based browsers also mention Safari, Edge also mentions Chrome.
+	browsers := []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	}
+	systems := []struct{ token, name string }{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	}
+
+	browser := "Unknown browser"
+	for _, b := range browsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	for _, s := range systems {
+		if strings.Contains(userAgent, s.token) {
+			return browser + " on " + s.name
+		}
+	}
+
+	return browser
+}
+
 // FuncMap is the type of the map defining the mapping from names to
 // functions. Each function must have either a single return value, or two
 // return values of which the second has type error.
 // String-keyed map which acts as a lookup between the names of our custom template functions (names in template files)
 // and the name of the functions themselves.
 var functions = template.FuncMap{
-	"humanDate": humanDate,
+	"base64":     base64String,
+	"device":     device,
+	"humanDate":  humanDate,
+	"lineAnchor": lineAnchor,
+	"lineLabel":  lineLabel,
+	"markdown":   markdownHTML,
+	"pathEscape": url.PathEscape,
+	"summary":    snippetSummary,
 }
 
 func newTemplateCache(dir string) (map[string]*template.Template, error) {
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -45,3 +47,107 @@ func TestHumanDate(t *testing.T) {
 		})
 	}
 }
+
+func TestDevice(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		want      string
+	}{
+		{"Firefox", "Mozilla/5.0 (X11; Linux x86_64; rv:89.0) Gecko/20100101 Firefox/89.0", "Firefox on Linux"},
+		{"Chrome", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) " +
+			"Chrome/91.0.4472.124 Safari/537.36", "Chrome on Windows"},
+		{"Safari", "Mozilla/5.0 (iPhone; CPU iPhone OS 14_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) " +
+			"Version/14.1.1 Mobile/15E148 Safari/604.1", "Safari on iOS"},
+		{"Unknown", "", "Unknown browser"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := device(tt.userAgent)
+			if d != tt.want {
+				t.Errorf("want %q; got %q", tt.want, d)
+			}
+		})
+	}
+}
+
+func TestSplitLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"Single line", "one", []string{"one"}},
+		{"Unix line endings", "one\ntwo", []string{"one", "two"}},
+		{"Windows line endings", "one\r\ntwo\r\n", []string{"one", "two"}},
+		{"Blank lines", "one\n\ntwo\n\n", []string{"one", "", "two", ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitLines(tt.content)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("want %q; got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNumberFiles(t *testing.T) {
+	files := []*models.File{
+		{Position: 1, Name: "one.txt", Content: "one\ntwo"},
+		{Position: 2, Name: "two.txt", Content: "three"},
+	}
+	comments := []*models.Comment{
+		{ID: 1, Revision: 2, Lines: models.LineRange{File: 1, Start: 1, End: 2}},
+		{ID: 2, Revision: 2},
+		{ID: 3, Revision: 1, Lines: models.LineRange{File: 1, Start: 1, End: 1}},
+		{ID: 4, Revision: 2, Lines: models.LineRange{File: 1, Start: 2, End: 2}},
+		{ID: 5, Revision: 2, Lines: models.LineRange{File: 1, Start: 2, End: 2}, Deleted: true},
+		{ID: 6, Revision: 2, Lines: models.LineRange{File: 2, Start: 1, End: 1}},
+	}
+
+	numbered := numberFiles(files, 2, comments)
+
+	if len(numbered) != 2 || numbered[1].Name != "two.txt" || numbered[1].Position != 2 {
+		t.Fatalf("want 2 files; got %+v", numbered)
+	}
+
+	lines := numbered[0].Lines
+	if len(lines) != 2 || lines[0].Number != 1 || lines[1].Number != 2 || lines[1].Text != "two" {
+		t.Fatalf("want 2 numbered lines; got %+v", lines)
+	}
+	if lines[0].Comments != nil {
+		t.Errorf("want no comments on line 1; got %v", lines[0].Comments)
+	}
+	if want := []int{1, 4}; !reflect.DeepEqual(lines[1].Comments, want) {
+		t.Errorf("want comments %v on line 2; got %v", want, lines[1].Comments)
+	}
+	if want := []int{6}; !reflect.DeepEqual(numbered[1].Lines[0].Comments, want) {
+		t.Errorf("want comments %v on the second file; got %v", want, numbered[1].Lines[0].Comments)
+	}
+}
+
+func TestLineAnchor(t *testing.T) {
+	tests := []struct {
+		name      string
+		lines     models.LineRange
+		wantID    string
+		wantLabel string
+	}{
+		{"Single line", models.LineRange{File: 1, Start: 12, End: 12}, "F1-L12", "file 1, line 12"},
+		{"Range", models.LineRange{File: 2, Start: 12, End: 20}, "F2-L12-L20", "file 2, lines 12 to 20"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lineAnchor(tt.lines); got != tt.wantID {
+				t.Errorf("want %q; got %q", tt.wantID, got)
+			}
+			if got := lineLabel(tt.lines); got != tt.wantLabel {
+				t.Errorf("want %q; got %q", tt.wantLabel, got)
+			}
+		})
+	}
+}
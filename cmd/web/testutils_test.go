@@ -1,14 +1,20 @@
 package main
 
 import (
+	"bytes"
+	"fmt"
 	"github.com/golangcollege/sessions"
 	"github.com/luca0x333/go-snippetbox/pkg/models/mock"
+	"github.com/luca0x333/go-snippetbox/pkg/passwords"
 	"html"
+	"io"
 	"io/ioutil"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"net/http/cookiejar"
 	"net/http/httptest"
+	"net/textproto"
 	"net/url"
 	"regexp"
 	"testing"
@@ -28,15 +34,62 @@ func newTestApplication(t *testing.T) *application {
 	session.Lifetime = 12 * time.Hour
 	session.Secure = true
 
+	viewCounter, err := newViewCounter(30 * time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	// Initialize the dependencies using the mocks for the loggers and database models.
 	return &application{
-		errorLog:      log.New(ioutil.Discard, "", 0),
-		infoLog:       log.New(ioutil.Discard, "", 0),
-		session:       session,
-		snippets:      &mock.SnippetModel{},
-		templateCache: templateCache,
-		users:         &mock.UserModel{},
+		archiveTimeout: time.Minute,
+		auditLog:       &mock.AuditLogModel{},
+		baseURL:        "https://snippetbox.example",
+		comments:       &mock.CommentModel{},
+		errorLog:       log.New(ioutil.Discard, "", 0),
+		identities:     &mock.IdentityModel{},
+		infoLog:        log.New(ioutil.Discard, "", 0),
+		loginAttempts:  &mock.LoginAttemptModel{},
+		loginThrottle: &loginThrottle{
+			maxFailures: 10,
+			lockout:     15 * time.Minute,
+			baseDelay:   time.Second,
+			maxDelay:    15 * time.Minute,
+		},
+		organizations: &mock.OrganizationModel{},
+		passwordPolicy: &passwords.Policy{
+			Breached:           &passwords.Corpus{Dir: "./../../pkg/passwords/testdata/breached"},
+			RejectPersonalInfo: true,
+			MinEntropy:         40,
+		},
+		rankings:         &mock.RankingModel{},
+		session:          session,
+		snippets:         &mock.SnippetModel{},
+		snippetTemplates: &mock.SnippetTemplateModel{},
+		stars:            &mock.StarModel{},
+		templateCache:    templateCache,
+		uploads: &uploadPolicy{
+			maxFileSize: 1 << 10,
+		},
+		users:        &mock.UserModel{},
+		userSessions: &mock.SessionModel{},
+		viewCounter:  viewCounter,
+		views:        &mock.ViewModel{},
+	}
+}
+
+// testMailer records the emails sent, or fails to send them with err.
+type testMailer struct {
+	err  error
+	sent []string
+}
+
+func (m *testMailer) Send(to, subject, body string) error {
+	if m.err != nil {
+		return m.err
 	}
+
+	m.sent = append(m.sent, fmt.Sprintf("To: %s\nSubject: %s\n\n%s", to, subject, body))
+	return nil
 }
 
 // Custom testServer type which embeds a httptest.Server instance.
@@ -99,6 +152,61 @@ func (ts *testServer) postForm(t *testing.T, urlPath string, form url.Values) (i
 	return rs.StatusCode, rs.Header, body
 }
 
+// upload is a file sent with a multipart form by postMultipart.
+type upload struct {
+	field       string
+	filename    string
+	contentType string
+	content     string
+}
+
+// postMultipart method sends a multipart POST request with form values and uploaded files to the test server.
+func (ts *testServer) postMultipart(t *testing.T, urlPath string, form url.Values,
+	uploads ...upload) (int, http.Header, []byte) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for field, values := range form {
+		for _, value := range values {
+			err := mw.WriteField(field, value)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for _, u := range uploads {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, u.field, u.filename))
+		header.Set("Content-Type", u.contentType)
+		pw, err := mw.CreatePart(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = io.WriteString(pw, u.content)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := mw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs, err := ts.Client().Post(ts.URL+urlPath, mw.FormDataContentType(), &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rs.Body.Close()
+	body, err := ioutil.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rs.StatusCode, rs.Header, body
+}
+
 // Captures CSRF token value from the html user sign up page.
 var csrfTokenRX = regexp.MustCompile(`<input type='hidden' name='csrf_token' value='(.+)'>`)
 
@@ -111,3 +219,21 @@ func extractCSRFToken(t *testing.T, body []byte) string {
 
 	return html.UnescapeString(string(matches[1]))
 }
+
+// login logs the test client in as the mock user with the given email and returns a CSRF token valid for the
+// new session.
+func (ts *testServer) login(t *testing.T, email string) string {
+	_, _, body := ts.get(t, "/user/login")
+	form := url.Values{}
+	form.Add("email", email)
+	form.Add("password", "validPa$$word")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, _, _ := ts.postForm(t, "/user/login", form)
+	if code != http.StatusSeeOther {
+		t.Fatalf("login: want %d; got %d", http.StatusSeeOther, code)
+	}
+
+	_, _, body = ts.get(t, "/")
+	return extractCSRFToken(t, body)
+}
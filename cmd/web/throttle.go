@@ -0,0 +1,69 @@
+package main
+
+import (
+	"time"
+)
+
+// loginThrottle holds the settings used to slow down password guessing.
+// Failed attempts are counted both per target email and per client IP: every failure past a few free
+// attempts doubles the time the client has to wait before trying again, and an email which collects
+// maxFailures failures is locked until lockout has elapsed since the last one or an admin unlocks it.
+// Attempts are recorded before they are evaluated and count as failures until the credentials are verified,
+// refused attempts included, so neither concurrent guesses nor retries while throttled get around the limits.
+type loginThrottle struct {
+	maxFailures int
+	lockout     time.Duration
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+const (
+	// Number of failures allowed before the backoff kicks in.
+	emailFreeAttempts = 3
+	// An IP address is often shared by many users (NAT, proxies) so it gets more slack.
+	ipFreeAttempts = 10
+)
+
+// backoff returns how long a client must wait after n failures before the next attempt is evaluated.
+func (lt *loginThrottle) backoff(n, free int) time.Duration {
+	if n < free {
+		return 0
+	}
+
+	delay := lt.baseDelay
+	for i := free; i < n; i++ {
+		delay *= 2
+		if delay >= lt.maxDelay {
+			return lt.maxDelay
+		}
+	}
+
+	return delay
+}
+
+// loginAllowed reports whether the login attempt recorded with attemptID, for an email address from an IP address,
+// may be evaluated now. Only the attempts recorded before it count, concurrent attempts included.
+// Callers must not reveal why an attempt was refused, so a lockout can't be used to enumerate accounts.
+func (app *application) loginAllowed(email, ip string, attemptID int) (bool, error) {
+	now := time.Now()
+	since := now.Add(-app.loginThrottle.lockout)
+
+	f, err := app.loginAttempts.EmailFailures(email, attemptID, since)
+	if err != nil {
+		return false, err
+	}
+
+	if f.Count >= app.loginThrottle.maxFailures && now.Before(f.Last.Add(app.loginThrottle.lockout)) {
+		return false, nil
+	}
+	if now.Before(f.Last.Add(app.loginThrottle.backoff(f.Count, emailFreeAttempts))) {
+		return false, nil
+	}
+
+	f, err = app.loginAttempts.IPFailures(ip, attemptID, since)
+	if err != nil {
+		return false, err
+	}
+
+	return !now.Before(f.Last.Add(app.loginThrottle.backoff(f.Count, ipFreeAttempts))), nil
+}
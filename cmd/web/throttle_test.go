@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginThrottleBackoff(t *testing.T) {
+	lt := &loginThrottle{baseDelay: time.Second, maxDelay: time.Minute}
+
+	tests := []struct {
+		name     string
+		failures int
+		want     time.Duration
+	}{
+		{"Free attempt", 2, 0},
+		{"First delay", 3, time.Second},
+		{"Doubled delay", 5, 4 * time.Second},
+		{"Capped delay", 20, time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := lt.backoff(tt.failures, emailFreeAttempts)
+			if got != tt.want {
+				t.Errorf("want %v; got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"github.com/luca0x333/go-snippetbox/pkg/charset"
+	"github.com/luca0x333/go-snippetbox/pkg/forms"
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// uploadPolicy holds the settings applied to the files uploaded with snippet forms.
+// maxFileSize is the size limit of each file, and binary files, like images, are refused unless allowBinary is set.
+type uploadPolicy struct {
+	maxFileSize int64
+	allowBinary bool
+}
+
+// maxRequestSize returns the size limit of request bodies: enough for a snippet form with every file uploaded,
+// plus some room for the other fields.
+func (up *uploadPolicy) maxRequestSize() int64 {
+	return maxSnippetFiles*up.maxFileSize + 1<<20
+}
+
+// multipartMemory is how much of a multipart form is kept in memory, the rest of the files is stored on disk
+// until the request is over.
+const multipartMemory = 1 << 20
+
+// maxFormSize is the size limit of the request bodies of the forms which don't upload files.
+const maxFormSize = 256 << 10
+
+// limitRequestBody refuses request bodies larger than maxFormSize with 413 Request Entity Too Large.
+// It must be chained before NoSurf: it parses the form itself, otherwise a body too large would be reported as a
+// missing CSRF token by NoSurf when it looks for the token.
+func (app *application) limitRequestBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.limitBody(w, r, maxFormSize, false) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// limitUploadBody is limitRequestBody for the snippet forms, which upload files: their bodies can be as large as
+// the upload policy allows, and their multipart forms are parsed with the files mostly stored on disk.
+func (app *application) limitUploadBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.limitBody(w, r, app.uploads.maxRequestSize(), true) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// limitBody limits the body of a request to max bytes and parses the form it holds, if it is a POST request.
+// Multipart forms are only parsed if multipart is set. It reports whether the request can be handled, otherwise
+// an error response has been sent.
+func (app *application) limitBody(w http.ResponseWriter, r *http.Request, max int64, multipart bool) bool {
+	if r.ContentLength > max {
+		app.clientError(w, http.StatusRequestEntityTooLarge)
+		return false
+	}
+
+	// The length can be unknown, MaxBytesReader stops reading the body at the limit anyway.
+	r.Body = http.MaxBytesReader(w, r.Body, max)
+
+	if r.Method != http.MethodPost {
+		return true
+	}
+
+	var err error
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if multipart && mediaType == "multipart/form-data" {
+		err = r.ParseMultipartForm(multipartMemory)
+	} else {
+		err = r.ParseForm()
+	}
+	if err != nil {
+		// The error of MaxBytesReader isn't exported, only its message tells it apart.
+		if strings.Contains(err.Error(), "http: request body too large") {
+			app.clientError(w, http.StatusRequestEntityTooLarge)
+		} else {
+			app.clientError(w, http.StatusBadRequest)
+		}
+		return false
+	}
+
+	return true
+}
+
+// uploadFiles replaces the content of the files of a snippet form with the files uploaded for them, if any.
+// Text is decoded to UTF-8 from the charset declared by the browser or detected from the content. A file without
+// a name takes the name of the uploaded file. Uploads breaking the upload policy are reported as errors of the
+// form, under the key returned by fileError for the upload field.
+func (app *application) uploadFiles(form *forms.Form, files []*models.File) error {
+	for _, f := range files {
+		field := fileError(fileUploadField, f.Position)
+		fh := form.File(field)
+		if fh == nil {
+			continue
+		}
+
+		form.MaxFileSize(field, app.uploads.maxFileSize)
+		if !app.uploads.allowBinary {
+			form.PermittedFileTypes(field, "text/*")
+		}
+		if form.Errors.Get(field) != "" {
+			continue
+		}
+
+		contentType, err := forms.DetectFileType(fh)
+		if err != nil {
+			return err
+		}
+
+		file, err := fh.Open()
+		if err != nil {
+			return err
+		}
+		b, err := ioutil.ReadAll(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+
+		if strings.HasPrefix(contentType, "text/") {
+			_, params, _ := mime.ParseMediaType(fh.Header.Get("Content-Type"))
+			content, _, err := charset.Decode(b, params["charset"])
+			if errors.Is(err, charset.ErrUnsupported) {
+				form.Errors.Add(field, "The character set of this file is not supported")
+				continue
+			} else if err != nil {
+				return err
+			}
+			f.Content, f.Binary = content, false
+		} else {
+			f.Content, f.Binary = string(b), true
+		}
+
+		if f.Name == "" {
+			f.Name = fh.Filename
+		}
+	}
+
+	return nil
+}
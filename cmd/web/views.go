@@ -0,0 +1,242 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// viewCounter counts the views of snippets in memory, so showing a snippet doesn't write to the database: the
+// counts are added to the database in batches by flushViews. A visitor seeing a snippet again within window
+// isn't counted twice.
+// Visitors are identified by a hash of their session, or of their IP address, salted with a random value which
+// never leaves the process: the hashes are only kept in memory, for the duration of the window, and no IP address
+// is stored.
+type viewCounter struct {
+	window time.Duration
+	salt   []byte
+
+	mu        sync.Mutex
+	seen      map[[sha256.Size]byte]time.Time
+	pending   map[viewKey]int
+	referrers map[snippetDay]map[string]bool
+}
+
+// viewKey identifies the views counted together: the views of a snippet on a day coming from a site.
+type viewKey struct {
+	snippetID int
+	day       time.Time
+	referrer  string
+}
+
+// snippetDay identifies the views of a snippet on a day.
+type snippetDay struct {
+	snippetID int
+	day       time.Time
+}
+
+// maxReferrers is the number of sites whose views of a snippet are counted separately each day. The views coming
+// from the other sites are counted together under otherReferrer, so forged Referer headers can't make the memory
+// used, or the snippet_views table, grow without bounds. The sites are only remembered by the process: after a
+// restart, as many new sites can be counted for the day.
+const maxReferrers = 50
+
+// otherReferrer is the referrer the views coming from the sites past maxReferrers are counted under.
+const otherReferrer = "other"
+
+// newViewCounter returns a viewCounter with a fresh salt.
+func newViewCounter(window time.Duration) (*viewCounter, error) {
+	salt := make([]byte, 32)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &viewCounter{
+		window:    window,
+		salt:      salt,
+		seen:      make(map[[sha256.Size]byte]time.Time),
+		pending:   make(map[viewKey]int),
+		referrers: make(map[snippetDay]map[string]bool),
+	}, nil
+}
+
+// count counts a view of a snippet by a visitor at a given time, unless the visitor already saw it within the
+// window. It reports whether the view was counted.
+func (vc *viewCounter) count(snippetID int, visitor, referrer string, now time.Time) bool {
+	h := sha256.New()
+	h.Write(vc.salt)
+	binary.Write(h, binary.BigEndian, int64(snippetID))
+	h.Write([]byte(visitor))
+	var key [sha256.Size]byte
+	copy(key[:], h.Sum(nil))
+
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	if last, ok := vc.seen[key]; ok && now.Sub(last) < vc.window {
+		return false
+	}
+	vc.seen[key] = now
+
+	d := day(now)
+	vc.pending[viewKey{snippetID, d, vc.fold(snippetDay{snippetID, d}, referrer)}]++
+	return true
+}
+
+// fold returns the referrer a view of a snippet on a day is counted under: the site it comes from, or
+// otherReferrer once maxReferrers other sites have been counted. It must be called with the lock held.
+func (vc *viewCounter) fold(sd snippetDay, referrer string) string {
+	if referrer == "" {
+		return ""
+	}
+
+	sites := vc.referrers[sd]
+	if sites[referrer] {
+		return referrer
+	}
+	if len(sites) >= maxReferrers {
+		return otherReferrer
+	}
+
+	if sites == nil {
+		sites = make(map[string]bool)
+		vc.referrers[sd] = sites
+	}
+	sites[referrer] = true
+	return referrer
+}
+
+// take returns the views counted since the last call and forgets the visitors whose window is over, and the
+// sites counted on the previous days.
+func (vc *viewCounter) take(now time.Time) []*models.ViewCount {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	for key, last := range vc.seen {
+		if now.Sub(last) >= vc.window {
+			delete(vc.seen, key)
+		}
+	}
+
+	today := day(now)
+	for sd := range vc.referrers {
+		if sd.day.Before(today) {
+			delete(vc.referrers, sd)
+		}
+	}
+
+	counts := []*models.ViewCount{}
+	for k, n := range vc.pending {
+		counts = append(counts, &models.ViewCount{SnippetID: k.snippetID, Day: k.day, Referrer: k.referrer, Views: n})
+	}
+	vc.pending = make(map[viewKey]int)
+
+	return counts
+}
+
+// putBack returns counts which couldn't be saved, so they are saved with the next ones.
+func (vc *viewCounter) putBack(counts []*models.ViewCount) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	for _, c := range counts {
+		vc.pending[viewKey{c.SnippetID, c.Day, c.Referrer}] += c.Views
+	}
+}
+
+// day returns the start of the day of t, in UTC like the dates shown on the site.
+func day(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// visitor returns what identifies the client which made a request: its session when it is logged in, its IP
+// address otherwise. The user agent is left out, a client could change it at every request to be counted again.
+func (app *application) visitor(r *http.Request) string {
+	if us := app.authenticatedSession(r); us != nil {
+		return "session " + strconv.Itoa(us.ID)
+	}
+
+	return "client " + clientIP(r)
+}
+
+// referrer returns the host name of the site of the page which linked to the requested one, or an empty string
+// when it is unknown. Only the host is kept: full URLs could reveal private pages.
+func referrer(r *http.Request) string {
+	u, err := url.Parse(r.Referer())
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if len(host) > 255 {
+		return ""
+	}
+
+	return host
+}
+
+// countView counts a view of a snippet, unless it is seen by its author.
+func (app *application) countView(r *http.Request, s *models.Snippet) {
+	if user := app.authenticatedUser(r); user != nil && user.ID == s.UserID {
+		return
+	}
+
+	app.viewCounter.count(s.ID, app.visitor(r), referrer(r), time.Now())
+}
+
+// statsDays is the number of days covered by the stats of a snippet, today included.
+const statsDays = 30
+
+// viewStats are the stats shown to the author of a snippet: the views of the last days, oldest first, and the sites
+// which brought the most views during those days.
+type viewStats struct {
+	Days      []*dayViews
+	Total     int
+	Referrers []*models.Referrer
+}
+
+// dayViews is the number of views of a snippet on a day. Percent is relative to the day with the most views, to
+// draw the bars of the chart.
+type dayViews struct {
+	Day     time.Time
+	Views   int
+	Percent int
+}
+
+// dailyStats returns the views of a number of days starting from since, including the days without views, and
+// their total.
+func dailyStats(daily []*models.DailyViews, since time.Time, days int) ([]*dayViews, int) {
+	views := make(map[time.Time]int)
+	for _, d := range daily {
+		views[day(d.Day)] += d.Views
+	}
+
+	var stats []*dayViews
+	var total, max int
+	for i := 0; i < days; i++ {
+		d := &dayViews{Day: day(since).AddDate(0, 0, i)}
+		d.Views = views[d.Day]
+		total += d.Views
+		if d.Views > max {
+			max = d.Views
+		}
+		stats = append(stats, d)
+	}
+
+	if max > 0 {
+		for _, d := range stats {
+			d.Percent = d.Views * 100 / max
+		}
+	}
+
+	return stats, total
+}
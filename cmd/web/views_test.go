@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestViewCounter(t *testing.T) {
+	vc, err := newViewCounter(30 * time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2021, 3, 14, 23, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		name      string
+		snippetID int
+		visitor   string
+		at        time.Duration
+		want      bool
+	}{
+		{"First view", 1, "client 192.0.2.1", 0, true},
+		{"Same visitor", 1, "client 192.0.2.1", 10 * time.Minute, false},
+		{"Other snippet", 2, "client 192.0.2.1", 10 * time.Minute, true},
+		{"Other visitor", 1, "session 7", 10 * time.Minute, true},
+		{"Window over", 1, "client 192.0.2.1", 70 * time.Minute, true},
+	}
+
+	for _, step := range steps {
+		if got := vc.count(step.snippetID, step.visitor, "", now.Add(step.at)); got != step.want {
+			t.Errorf("%s: want %t; got %t", step.name, step.want, got)
+		}
+	}
+
+	// The last view happened the next day.
+	counts := vc.take(now.Add(70 * time.Minute))
+	views := make(map[models.ViewCount]int)
+	for _, c := range counts {
+		views[models.ViewCount{SnippetID: c.SnippetID, Day: c.Day}] += c.Views
+	}
+
+	march14 := time.Date(2021, 3, 14, 0, 0, 0, 0, time.UTC)
+	want := map[models.ViewCount]int{
+		{SnippetID: 1, Day: march14}:                  2,
+		{SnippetID: 2, Day: march14}:                  1,
+		{SnippetID: 1, Day: march14.AddDate(0, 0, 1)}: 1,
+	}
+	if len(views) != len(want) {
+		t.Fatalf("want %v; got %v", want, views)
+	}
+	for k, n := range want {
+		if views[k] != n {
+			t.Errorf("want %d views of snippet %d on %s; got %d", n, k.SnippetID, k.Day.Format("2006-01-02"),
+				views[k])
+		}
+	}
+
+	if counts := vc.take(now.Add(80 * time.Minute)); len(counts) != 0 {
+		t.Errorf("want no counts after a take; got %d", len(counts))
+	}
+
+	// Counts put back are taken again, and the visitors forgotten after their window can be counted again.
+	vc.putBack(counts)
+	if got := len(vc.take(now.Add(80 * time.Minute))); got != len(counts) {
+		t.Errorf("want %d counts put back; got %d", len(counts), got)
+	}
+	if len(vc.seen) != 1 {
+		t.Errorf("want 1 visitor left within the window; got %d", len(vc.seen))
+	}
+}
+
+func TestViewCounterReferrers(t *testing.T) {
+	vc, err := newViewCounter(30 * time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2021, 3, 14, 12, 0, 0, 0, time.UTC)
+
+	// Past maxReferrers sites, the views of new sites are counted together while the known ones are still counted
+	// separately.
+	for i := 0; i < maxReferrers+2; i++ {
+		vc.count(1, fmt.Sprintf("client 192.0.2.%d", i), fmt.Sprintf("site%d.example", i), now)
+	}
+	vc.count(1, "client 198.51.100.1", "site0.example", now)
+	vc.count(1, "client 198.51.100.2", "", now)
+
+	views := make(map[string]int)
+	for _, c := range vc.take(now) {
+		views[c.Referrer] += c.Views
+	}
+	if len(views) != maxReferrers+2 {
+		t.Errorf("want %d referrers; got %d", maxReferrers+2, len(views))
+	}
+	for referrer, want := range map[string]int{"site0.example": 2, otherReferrer: 2, "": 1} {
+		if views[referrer] != want {
+			t.Errorf("want %d views from %q; got %d", want, referrer, views[referrer])
+		}
+	}
+
+	// The sites are counted again the next day.
+	tomorrow := now.AddDate(0, 0, 1)
+	vc.count(1, "client 203.0.113.1", fmt.Sprintf("site%d.example", maxReferrers+1), tomorrow)
+	counts := vc.take(tomorrow)
+	if len(counts) != 1 || counts[0].Referrer != fmt.Sprintf("site%d.example", maxReferrers+1) {
+		t.Errorf("want the views of a new site counted separately; got %+v", counts)
+	}
+	if len(vc.referrers) != 1 {
+		t.Errorf("want the sites of 1 day left; got %d", len(vc.referrers))
+	}
+}
+
+func TestVisitor(t *testing.T) {
+	app := newTestApplication(t)
+
+	// Anonymous visitors are identified by their IP address alone, changing the user agent doesn't matter.
+	r1 := httptest.NewRequest("GET", "/snippet/1", nil)
+	r1.RemoteAddr = "192.0.2.1:1234"
+	r1.Header.Set("User-Agent", "Firefox")
+	r2 := httptest.NewRequest("GET", "/snippet/1", nil)
+	r2.RemoteAddr = "192.0.2.1:5678"
+	r2.Header.Set("User-Agent", "Chrome")
+	r3 := httptest.NewRequest("GET", "/snippet/1", nil)
+	r3.RemoteAddr = "192.0.2.2:1234"
+	r3.Header.Set("User-Agent", "Firefox")
+
+	if v1, v2 := app.visitor(r1), app.visitor(r2); v1 != v2 {
+		t.Errorf("want the same visitor for other user agents; got %q and %q", v1, v2)
+	}
+	if v1, v3 := app.visitor(r1), app.visitor(r3); v1 == v3 {
+		t.Errorf("want other visitors for other IP addresses; got %q", v1)
+	}
+}
+
+func TestReferrer(t *testing.T) {
+	tests := []struct {
+		name    string
+		referer string
+		want    string
+	}{
+		{"None", "", ""},
+		{"Full URL", "https://News.Example:8443/item?id=42", "news.example"},
+		{"Other scheme", "android-app://com.example", ""},
+		{"Invalid URL", "http://%zz", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/snippet/1", nil)
+			r.Header.Set("Referer", tt.referer)
+
+			if got := referrer(r); got != tt.want {
+				t.Errorf("want %q; got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDailyStats(t *testing.T) {
+	since := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	daily := []*models.DailyViews{
+		{Day: since, Views: 2},
+		{Day: since.AddDate(0, 0, 2), Views: 8},
+	}
+
+	days, total := dailyStats(daily, since, 3)
+
+	if total != 10 {
+		t.Errorf("want 10 views in total; got %d", total)
+	}
+	if len(days) != 3 {
+		t.Fatalf("want 3 days; got %d", len(days))
+	}
+
+	want := []dayViews{{since, 2, 25}, {since.AddDate(0, 0, 1), 0, 0}, {since.AddDate(0, 0, 2), 8, 100}}
+	for i, d := range days {
+		if !d.Day.Equal(want[i].Day) || d.Views != want[i].Views || d.Percent != want[i].Percent {
+			t.Errorf("want %+v; got %+v", want[i], *d)
+		}
+	}
+}
@@ -3,10 +3,17 @@ module github.com/luca0x333/go-snippetbox
 go 1.16
 
 require (
+	github.com/alecthomas/chroma v0.10.0
 	github.com/bmizerany/pat v0.0.0-20210406213842-e4b6760bdd6f
+	github.com/go-asn1-ber/asn1-ber v1.5.1
+	github.com/go-ldap/ldap/v3 v3.4.1
 	github.com/go-sql-driver/mysql v1.6.0
 	github.com/golangcollege/sessions v1.2.0
 	github.com/justinas/alice v1.2.0
 	github.com/justinas/nosurf v1.1.1
-	golang.org/x/crypto v0.0.0-20200317142112-1b76d66859c6
+	github.com/microcosm-cc/bluemonday v1.0.18
+	github.com/yuin/goldmark v1.5.2
+	golang.org/x/crypto v0.10.0
+	golang.org/x/net v0.11.0 // indirect
+	golang.org/x/sys v0.10.0 // indirect
 )
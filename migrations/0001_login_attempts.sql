@@ -0,0 +1,12 @@
+-- Failed logins, counted per email address and per client IP to throttle password guessing. Cleared attempts
+-- no longer count, ex: after a successful login.
+CREATE TABLE login_attempts (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    email VARCHAR(255) NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    created DATETIME NOT NULL,
+    cleared BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX idx_login_attempts_email ON login_attempts(email, created);
+CREATE INDEX idx_login_attempts_ip ON login_attempts(ip, created);
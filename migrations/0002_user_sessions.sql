@@ -0,0 +1,16 @@
+-- Server-side login sessions. Only a SHA-256 hash of the token held by the cookie session is stored.
+-- Users logged in before this migration have to log in again.
+CREATE TABLE user_sessions (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    token_hash CHAR(64) NOT NULL,
+    user_id INTEGER NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    user_agent VARCHAR(255) NOT NULL,
+    created DATETIME NOT NULL,
+    last_seen DATETIME NOT NULL,
+    expires DATETIME NOT NULL,
+    revoked BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+ALTER TABLE user_sessions ADD CONSTRAINT user_sessions_uc_token_hash UNIQUE (token_hash);
+CREATE INDEX idx_user_sessions_user_id ON user_sessions(user_id, last_seen);
@@ -0,0 +1,5 @@
+-- Administrators can manage users and delete any snippet. Nobody is an administrator at first: grant the role
+-- to the first one by hand, ex:
+--
+--   UPDATE users SET is_admin = TRUE WHERE email = 'admin@example.com';
+ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT FALSE;
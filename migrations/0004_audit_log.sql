@@ -0,0 +1,11 @@
+-- Admin actions are recorded in the audit log, with the administrator and their IP address.
+CREATE TABLE audit_log (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER,
+    event VARCHAR(50) NOT NULL,
+    details VARCHAR(255) NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    created DATETIME NOT NULL
+);
+
+CREATE INDEX idx_audit_log_created ON audit_log(created);
@@ -0,0 +1,10 @@
+-- Security-relevant events: logins, password changes, admin actions... The log can be filtered by user and event,
+-- and is append-only: triggers refuse to update or delete its rows, even for the application's own database user.
+CREATE INDEX idx_audit_log_user_id ON audit_log(user_id, created);
+CREATE INDEX idx_audit_log_event ON audit_log(event, created);
+
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
+
+CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
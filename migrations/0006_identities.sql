@@ -0,0 +1,10 @@
+-- Links between users and the accounts of an OpenID Connect provider, identified by their issuer and subject.
+CREATE TABLE identities (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    issuer VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    created DATETIME NOT NULL
+);
+
+ALTER TABLE identities ADD CONSTRAINT identities_uc_issuer_subject UNIQUE (issuer, subject);
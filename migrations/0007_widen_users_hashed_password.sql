@@ -0,0 +1,3 @@
+-- argon2id hashes are longer than the 60 characters of a bcrypt hash.
+-- Existing bcrypt hashes keep working and are replaced when their owner next logs in.
+ALTER TABLE users MODIFY hashed_password VARCHAR(255) NOT NULL;
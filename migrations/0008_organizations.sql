@@ -0,0 +1,32 @@
+-- Snippets get an author and can be shared with the members of an organization only.
+-- Existing snippets have no author and stay public.
+ALTER TABLE snippets ADD COLUMN user_id INTEGER AFTER id, ADD COLUMN org_id INTEGER AFTER user_id;
+CREATE INDEX idx_snippets_org_id ON snippets(org_id, created);
+
+CREATE TABLE organizations (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    name VARCHAR(100) NOT NULL,
+    created DATETIME NOT NULL
+);
+
+CREATE TABLE memberships (
+    org_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    role VARCHAR(10) NOT NULL,
+    created DATETIME NOT NULL,
+    PRIMARY KEY (org_id, user_id)
+);
+
+CREATE INDEX idx_memberships_user_id ON memberships(user_id);
+
+CREATE TABLE invitations (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    org_id INTEGER NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    role VARCHAR(10) NOT NULL,
+    invited_by INTEGER NOT NULL,
+    created DATETIME NOT NULL
+);
+
+ALTER TABLE invitations ADD CONSTRAINT invitations_uc_org_id_email UNIQUE (org_id, email);
+CREATE INDEX idx_invitations_email ON invitations(email);
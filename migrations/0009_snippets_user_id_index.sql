@@ -0,0 +1,2 @@
+-- Profile pages list the snippets of a user.
+CREATE INDEX idx_snippets_user_id ON snippets(user_id, created);
@@ -0,0 +1,12 @@
+-- Users can star snippets. The number of stars is kept on the snippets so they can be sorted by popularity.
+ALTER TABLE snippets ADD COLUMN stars INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX idx_snippets_stars ON snippets(stars, created);
+
+CREATE TABLE stars (
+    user_id INTEGER NOT NULL,
+    snippet_id INTEGER NOT NULL,
+    created DATETIME NOT NULL,
+    PRIMARY KEY (user_id, snippet_id)
+);
+
+CREATE INDEX idx_stars_snippet_id ON stars(snippet_id);
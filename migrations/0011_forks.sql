@@ -0,0 +1,3 @@
+-- Snippets can be forked, the fork keeps a reference to the original snippet.
+ALTER TABLE snippets ADD COLUMN forked_from INTEGER;
+CREATE INDEX idx_snippets_forked_from ON snippets(forked_from);
@@ -0,0 +1,13 @@
+-- Threaded comments on snippets.
+CREATE TABLE comments (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    snippet_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    parent_id INTEGER,
+    content TEXT NOT NULL,
+    created DATETIME NOT NULL,
+    updated DATETIME,
+    deleted BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX idx_comments_snippet_id ON comments(snippet_id, created);
@@ -0,0 +1,17 @@
+-- Snippets can be edited by their author. The replaced versions are kept in snippet_revisions, and comments
+-- record the revision they were written on and the lines they are about.
+ALTER TABLE snippets ADD COLUMN revision INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE snippets ADD COLUMN updated DATETIME;
+
+CREATE TABLE snippet_revisions (
+    snippet_id INTEGER NOT NULL,
+    revision INTEGER NOT NULL,
+    title VARCHAR(100) NOT NULL,
+    content TEXT NOT NULL,
+    created DATETIME NOT NULL,
+    PRIMARY KEY (snippet_id, revision)
+);
+
+ALTER TABLE comments ADD COLUMN revision INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE comments ADD COLUMN line_start INTEGER;
+ALTER TABLE comments ADD COLUMN line_end INTEGER;
@@ -0,0 +1,24 @@
+-- Snippets hold several named files. The files of every revision are kept in snippet_files, and the content of
+-- existing snippets and revisions moves to a single file.
+CREATE TABLE snippet_files (
+    snippet_id INTEGER NOT NULL,
+    revision INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    language VARCHAR(20) NOT NULL,
+    content TEXT NOT NULL,
+    PRIMARY KEY (snippet_id, revision, position)
+);
+
+INSERT INTO snippet_files (snippet_id, revision, position, name, language, content)
+SELECT id, revision, 1, 'snippet.txt', '', content FROM snippets;
+
+INSERT INTO snippet_files (snippet_id, revision, position, name, language, content)
+SELECT snippet_id, revision, 1, 'snippet.txt', '', content FROM snippet_revisions;
+
+ALTER TABLE snippets DROP COLUMN content;
+ALTER TABLE snippet_revisions DROP COLUMN content;
+
+-- Comments on lines refer to a file, the existing ones are on the only file.
+ALTER TABLE comments ADD COLUMN line_file INTEGER;
+UPDATE comments SET line_file = 1 WHERE line_start IS NOT NULL;
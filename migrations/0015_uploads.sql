@@ -0,0 +1,3 @@
+-- Files can be uploaded, which makes them larger than a TEXT column holds. Binary files are stored base64 encoded.
+ALTER TABLE snippet_files MODIFY content MEDIUMTEXT NOT NULL;
+ALTER TABLE snippet_files ADD COLUMN is_binary BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,14 @@
+-- File contents are stored once in the contents table, keyed by their SHA-256 hash, and files refer to them.
+CREATE TABLE contents (
+    hash CHAR(64) NOT NULL PRIMARY KEY,
+    content MEDIUMTEXT NOT NULL
+);
+
+INSERT IGNORE INTO contents (hash, content) SELECT SHA2(content, 256), content FROM snippet_files;
+
+ALTER TABLE snippet_files ADD COLUMN content_hash CHAR(64) NOT NULL DEFAULT '';
+UPDATE snippet_files SET content_hash = SHA2(content, 256);
+ALTER TABLE snippet_files DROP COLUMN content;
+ALTER TABLE snippet_files ALTER content_hash DROP DEFAULT;
+
+CREATE INDEX idx_snippet_files_content_hash ON snippet_files(content_hash);
@@ -0,0 +1,2 @@
+-- Large contents can be kept in a blob store, the row then only holds the key of the blob and an empty content.
+ALTER TABLE contents ADD COLUMN blob_key VARCHAR(100);
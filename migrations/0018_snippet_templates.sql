@@ -0,0 +1,23 @@
+-- Users can save snippets as templates, personal or shared with an organization, to start new snippets from.
+CREATE TABLE snippet_templates (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    org_id INTEGER,
+    name VARCHAR(100) NOT NULL,
+    title VARCHAR(100) NOT NULL,
+    expires INTEGER NOT NULL,
+    created DATETIME NOT NULL
+);
+
+CREATE INDEX idx_snippet_templates_user_id ON snippet_templates(user_id);
+CREATE INDEX idx_snippet_templates_org_id ON snippet_templates(org_id);
+
+CREATE TABLE snippet_template_files (
+    template_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    language VARCHAR(20) NOT NULL,
+    content MEDIUMTEXT NOT NULL,
+    is_binary BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (template_id, position)
+);
@@ -0,0 +1,3 @@
+-- Snippets can be scheduled: they are only visible to their author until publish_at, then it is cleared.
+ALTER TABLE snippets ADD COLUMN publish_at DATETIME;
+CREATE INDEX idx_snippets_publish_at ON snippets(publish_at);
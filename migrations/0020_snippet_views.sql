@@ -0,0 +1,9 @@
+-- Views of snippets, counted per day and per referring site. Visitors are deduplicated in memory by the
+-- application: nothing identifying them, like IP addresses, is stored.
+CREATE TABLE snippet_views (
+    snippet_id INTEGER NOT NULL,
+    day DATE NOT NULL,
+    referrer VARCHAR(255) NOT NULL DEFAULT '',
+    views INTEGER NOT NULL,
+    PRIMARY KEY (snippet_id, day, referrer)
+);
@@ -0,0 +1,9 @@
+-- Rankings of the public snippets by views and stars, computed periodically by the application so pages don't
+-- aggregate the views and stars themselves.
+CREATE TABLE snippet_rankings (
+    ranking VARCHAR(20) NOT NULL,
+    position INTEGER NOT NULL,
+    snippet_id INTEGER NOT NULL,
+    score DOUBLE NOT NULL,
+    PRIMARY KEY (ranking, position)
+);
@@ -0,0 +1,8 @@
+-- Invitations are accepted with a single-use token sent to the invited address, instead of being matched on the
+-- unverified email address of the user accepting them. Only a SHA-256 hash of the token is stored.
+-- The pending invitations have no token and can't be accepted anymore, they are deleted and have to be sent again.
+DELETE FROM invitations;
+
+ALTER TABLE invitations ADD COLUMN token_hash CHAR(64) NOT NULL AFTER role;
+ALTER TABLE invitations ADD CONSTRAINT invitations_uc_token_hash UNIQUE (token_hash);
+DROP INDEX idx_invitations_email ON invitations;
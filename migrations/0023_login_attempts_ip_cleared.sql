@@ -0,0 +1,4 @@
+-- Login attempts are recorded before the password is verified, so concurrent guesses count against each other,
+-- and are cleared once it is. A successful login also clears the attempts coming from its IP address, in a
+-- separate column so the attempts against the other email addresses still count for those addresses.
+ALTER TABLE login_attempts ADD COLUMN ip_cleared BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,10 @@
+-- The files of templates refer to their content in the contents table, like the files of snippets, so the contents
+-- still used by templates aren't purged.
+INSERT IGNORE INTO contents (hash, content) SELECT SHA2(content, 256), content FROM snippet_template_files;
+
+ALTER TABLE snippet_template_files ADD COLUMN content_hash CHAR(64) NOT NULL DEFAULT '';
+UPDATE snippet_template_files SET content_hash = SHA2(content, 256);
+ALTER TABLE snippet_template_files DROP COLUMN content;
+ALTER TABLE snippet_template_files ALTER content_hash DROP DEFAULT;
+
+CREATE INDEX idx_snippet_template_files_content_hash ON snippet_template_files(content_hash);
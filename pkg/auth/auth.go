@@ -0,0 +1,38 @@
+// Package auth checks login credentials against one or more credential backends.
+package auth
+
+import (
+	"errors"
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"log"
+)
+
+// Authenticator verifies an email and a password and returns the ID of the matching local user.
+// It returns models.ErrInvalidCredentials if the credentials are wrong.
+type Authenticator interface {
+	Authenticate(email, password string) (int, error)
+}
+
+// Chain tries a list of authenticators in order and returns the first success.
+// A backend which fails, for example because a directory server is unreachable, is logged and skipped so the
+// other backends keep working.
+type Chain struct {
+	Authenticators []Authenticator
+	ErrorLog       *log.Logger
+}
+
+// Authenticate implements Authenticator.
+func (c *Chain) Authenticate(email, password string) (int, error) {
+	for _, a := range c.Authenticators {
+		id, err := a.Authenticate(email, password)
+		if err == nil {
+			return id, nil
+		}
+
+		if !errors.Is(err, models.ErrInvalidCredentials) && c.ErrorLog != nil {
+			c.ErrorLog.Printf("auth: %T: %s", a, err)
+		}
+	}
+
+	return 0, models.ErrInvalidCredentials
+}
@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// LDAP authenticates users with a simple bind against a directory server. The first time a directory user
+// logs in, a local user is provisioned with the same email address.
+//
+// The DN to bind as is either built from UserDN, or looked up by searching BaseDN with Filter.
+// In both templates "{email}" is replaced by the email address and "{username}" by its local part.
+//
+// The entry bound as must have a "mail" attribute equal to the email address typed: the local part alone doesn't
+// identify a user, and the local user logged in is the one with that email address.
+type LDAP struct {
+	// URL of the server, ex: "ldap://ldap.example.com" or "ldaps://ldap.example.com".
+	URL string
+	// StartTLS upgrades an ldap:// connection to TLS before sending any credentials.
+	StartTLS bool
+	// TLSConfig defaults to verifying the server certificate against the host name of URL.
+	TLSConfig *tls.Config
+	// UserDN is a template of the DN to bind as, ex: "uid={username},ou=people,dc=example,dc=com".
+	UserDN string
+	// BaseDN and Filter are used to look the DN up when UserDN is empty, ex: "(mail={email})".
+	BaseDN string
+	Filter string
+	// BindDN and BindPassword are the credentials of the service account used for the search.
+	// The search is anonymous if BindDN is empty.
+	BindDN       string
+	BindPassword string
+	// Timeout of each request, defaults to 5 seconds.
+	Timeout time.Duration
+	// Users is where local users are looked up and provisioned.
+	Users interface {
+		GetByEmail(string) (*models.User, error)
+		Provision(string, string) (int, error)
+	}
+}
+
+// Authenticate implements Authenticator.
+func (a *LDAP) Authenticate(email, password string) (int, error) {
+	// An empty password would turn the bind into an unauthenticated bind, which most servers accept.
+	if email == "" || password == "" {
+		return 0, models.ErrInvalidCredentials
+	}
+
+	conn, err := a.dial()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	dn, entry, err := a.userDN(conn, email)
+	if err != nil {
+		return 0, err
+	}
+
+	err = conn.Bind(dn, password)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return 0, models.ErrInvalidCredentials
+		}
+		return 0, err
+	}
+
+	// Read the entry with the user's own credentials when the DN came from the template.
+	if entry == nil {
+		entry, err = a.search(conn, dn, ldap.ScopeBaseObject, "(objectClass=*)")
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// Otherwise "alice@example.org" could log in as the local user with that address using the password of
+	// "alice@example.com" in the directory.
+	if !hasMail(entry, email) {
+		return 0, models.ErrInvalidCredentials
+	}
+
+	return a.localUser(email, entry.GetAttributeValue("cn"))
+}
+
+func (a *LDAP) dial() (*ldap.Conn, error) {
+	u, err := url.Parse(a.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	config := a.TLSConfig
+	if config == nil {
+		config = &tls.Config{ServerName: u.Hostname()}
+	}
+
+	conn, err := ldap.DialURL(a.URL, ldap.DialWithTLSConfig(config))
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := a.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	conn.SetTimeout(timeout)
+
+	if a.StartTLS {
+		err = conn.StartTLS(config)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+// userDN returns the DN of the directory user with an email address and, if it was searched for, its entry.
+func (a *LDAP) userDN(conn *ldap.Conn, email string) (string, *ldap.Entry, error) {
+	username := strings.SplitN(email, "@", 2)[0]
+
+	if a.UserDN != "" {
+		r := strings.NewReplacer("{email}", escapeDN(email), "{username}", escapeDN(username))
+		return r.Replace(a.UserDN), nil, nil
+	}
+
+	if a.BindDN != "" {
+		err := conn.Bind(a.BindDN, a.BindPassword)
+		if err != nil {
+			return "", nil, fmt.Errorf("ldap: service account bind: %w", err)
+		}
+	}
+
+	r := strings.NewReplacer("{email}", ldap.EscapeFilter(email), "{username}", ldap.EscapeFilter(username))
+	entry, err := a.search(conn, a.BaseDN, ldap.ScopeWholeSubtree, r.Replace(a.Filter))
+	if err != nil {
+		return "", nil, err
+	}
+
+	return entry.DN, entry, nil
+}
+
+// search returns the single entry matching a filter. It returns ErrInvalidCredentials when there is no
+// matching entry or when there are several, since the user can't be identified.
+func (a *LDAP) search(conn *ldap.Conn, base string, scope int, filter string) (*ldap.Entry, error) {
+	req := ldap.NewSearchRequest(base, scope, ldap.NeverDerefAliases, 2, 0, false, filter,
+		[]string{"cn", "mail"}, nil)
+
+	result, err := conn.Search(req)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return nil, models.ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	if len(result.Entries) != 1 {
+		return nil, models.ErrInvalidCredentials
+	}
+
+	return result.Entries[0], nil
+}
+
+// hasMail reports whether one of the email addresses of an entry is email. The comparison ignores case, like the
+// directory servers comparing "mail" values.
+func hasMail(entry *ldap.Entry, email string) bool {
+	for _, mail := range entry.GetAttributeValues("mail") {
+		if strings.EqualFold(mail, email) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// localUser returns the ID of the local user with an email address, provisioning it on first login.
+func (a *LDAP) localUser(email, name string) (int, error) {
+	user, err := a.Users.GetByEmail(email)
+	if err == nil {
+		// Deactivated users stay locked out whatever the directory says.
+		if !user.Active {
+			return 0, models.ErrInvalidCredentials
+		}
+		return user.ID, nil
+	}
+
+	if !errors.Is(err, models.ErrNoRecord) {
+		return 0, err
+	}
+
+	if name == "" {
+		name = strings.SplitN(email, "@", 2)[0]
+	}
+
+	return a.Users.Provision(name, email)
+}
+
+// escapeDN escapes a value to be used as an attribute value in a DN, as described in RFC 4514.
+func escapeDN(value string) string {
+	var b strings.Builder
+	for i, r := range value {
+		switch {
+		case strings.ContainsRune(`,+"\<>;=`, r),
+			r == '#' && i == 0,
+			r == ' ' && (i == 0 || i == len(value)-1):
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case r == 0:
+			b.WriteString(`\00`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"errors"
+	"github.com/luca0x333/go-snippetbox/pkg/auth/ldaptest"
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"io/ioutil"
+	"log"
+	"testing"
+)
+
+// testUsers is an in-memory store of local users.
+type testUsers struct {
+	users       map[string]*models.User
+	provisioned []string
+}
+
+func newTestUsers() *testUsers {
+	return &testUsers{users: map[string]*models.User{
+		"alice@example.com": {ID: 1, Name: "Alice Jones", Email: "alice@example.com", Active: true},
+		"dave@example.com":  {ID: 4, Name: "Dave", Email: "dave@example.com", Active: false},
+		"alice@example.org": {ID: 5, Name: "Alice Brown", Email: "alice@example.org", Active: true},
+	}}
+}
+
+func (u *testUsers) GetByEmail(email string) (*models.User, error) {
+	user, ok := u.users[email]
+	if !ok {
+		return nil, models.ErrNoRecord
+	}
+
+	return user, nil
+}
+
+func (u *testUsers) Provision(name, email string) (int, error) {
+	u.provisioned = append(u.provisioned, name)
+	u.users[email] = &models.User{ID: 10 + len(u.users), Name: name, Email: email, Active: true}
+
+	return u.users[email].ID, nil
+}
+
+// Authenticate lets testUsers act as the local password backend: everybody's password is "local-password".
+func (u *testUsers) Authenticate(email, password string) (int, error) {
+	user, ok := u.users[email]
+	if !ok || password != "local-password" {
+		return 0, models.ErrInvalidCredentials
+	}
+
+	return user.ID, nil
+}
+
+func newTestDirectory() *ldaptest.Server {
+	return ldaptest.NewServer(
+		&ldaptest.Entry{
+			DN:       "cn=service,dc=example,dc=com",
+			Password: "service-password",
+		},
+		&ldaptest.Entry{
+			DN:       "uid=alice,ou=people,dc=example,dc=com",
+			Password: "alice-password",
+			Attributes: map[string][]string{
+				"uid":  {"alice"},
+				"cn":   {"Alice Jones"},
+				"mail": {"alice@example.com"},
+			},
+		},
+		&ldaptest.Entry{
+			DN:       "uid=bob,ou=people,dc=example,dc=com",
+			Password: "bob-password",
+			Attributes: map[string][]string{
+				"uid":  {"bob"},
+				"cn":   {"Bob Smith"},
+				"mail": {"bob@example.com"},
+			},
+		},
+		&ldaptest.Entry{
+			DN:       "uid=dave,ou=people,dc=example,dc=com",
+			Password: "dave-password",
+			Attributes: map[string][]string{
+				"cn":   {"Dave"},
+				"mail": {"dave@example.com"},
+			},
+		},
+	)
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	srv := newTestDirectory()
+	defer srv.Close()
+
+	template := &LDAP{URL: srv.URL, UserDN: "uid={username},ou=people,dc=example,dc=com"}
+	search := &LDAP{
+		URL:          srv.URL,
+		StartTLS:     true,
+		TLSConfig:    srv.ClientTLSConfig(),
+		BaseDN:       "ou=people,dc=example,dc=com",
+		Filter:       "(mail={email})",
+		BindDN:       "cn=service,dc=example,dc=com",
+		BindPassword: "service-password",
+	}
+	searchUsername := &LDAP{
+		URL:          srv.URL,
+		BaseDN:       "ou=people,dc=example,dc=com",
+		Filter:       "(uid={username})",
+		BindDN:       "cn=service,dc=example,dc=com",
+		BindPassword: "service-password",
+	}
+
+	tests := []struct {
+		name            string
+		ldap            *LDAP
+		email           string
+		password        string
+		wantID          int
+		wantError       error
+		wantProvisioned string
+	}{
+		{"Existing user", template, "alice@example.com", "alice-password", 1, nil, ""},
+		{"New user", template, "bob@example.com", "bob-password", 13, nil, "Bob Smith"},
+		{"Wrong password", template, "alice@example.com", "wrong", 0, models.ErrInvalidCredentials, ""},
+		{"Empty password", template, "alice@example.com", "", 0, models.ErrInvalidCredentials, ""},
+		{"Unknown user", template, "carol@example.com", "carol", 0, models.ErrInvalidCredentials, ""},
+		{"Injection", template, "alice,ou=people@example.com", "alice-password", 0,
+			models.ErrInvalidCredentials, ""},
+		{"Deactivated user", template, "dave@example.com", "dave-password", 0, models.ErrInvalidCredentials, ""},
+		{"Other domain", template, "alice@example.org", "alice-password", 0, models.ErrInvalidCredentials, ""},
+		{"Other domain new user", template, "bob@example.org", "bob-password", 0, models.ErrInvalidCredentials, ""},
+		{"Search", search, "alice@example.com", "alice-password", 1, nil, ""},
+		{"Search new user", search, "bob@example.com", "bob-password", 13, nil, "Bob Smith"},
+		{"Search wrong password", search, "bob@example.com", "wrong", 0, models.ErrInvalidCredentials, ""},
+		{"Search injection", search, "*", "alice-password", 0, models.ErrInvalidCredentials, ""},
+		{"Search username", searchUsername, "alice@example.com", "alice-password", 1, nil, ""},
+		{"Search username other domain", searchUsername, "alice@example.org", "alice-password", 0,
+			models.ErrInvalidCredentials, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := newTestUsers()
+			tt.ldap.Users = users
+
+			id, err := tt.ldap.Authenticate(tt.email, tt.password)
+
+			if !errors.Is(err, tt.wantError) {
+				t.Errorf("want %v; got %v", tt.wantError, err)
+			}
+			if id != tt.wantID {
+				t.Errorf("want ID %d; got %d", tt.wantID, id)
+			}
+			if tt.wantProvisioned != "" && (len(users.provisioned) != 1 || users.provisioned[0] != tt.wantProvisioned) {
+				t.Errorf("want %q provisioned; got %v", tt.wantProvisioned, users.provisioned)
+			}
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	srv := newTestDirectory()
+	defer srv.Close()
+
+	users := newTestUsers()
+	directory := &LDAP{URL: srv.URL, UserDN: "uid={username},ou=people,dc=example,dc=com", Users: users}
+	down := &LDAP{URL: "ldap://127.0.0.1:1", UserDN: "uid={username},dc=example,dc=com", Users: users}
+
+	tests := []struct {
+		name      string
+		chain     *Chain
+		password  string
+		wantID    int
+		wantError error
+	}{
+		{"Directory password", &Chain{Authenticators: []Authenticator{directory, users}}, "alice-password", 1, nil},
+		{"Local password", &Chain{Authenticators: []Authenticator{directory, users}}, "local-password", 1, nil},
+		{"Wrong password", &Chain{Authenticators: []Authenticator{directory, users}}, "wrong", 0,
+			models.ErrInvalidCredentials},
+		{"Directory down", &Chain{Authenticators: []Authenticator{down, users}}, "local-password", 1, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.chain.ErrorLog = log.New(ioutil.Discard, "", 0)
+
+			id, err := tt.chain.Authenticate("alice@example.com", tt.password)
+
+			if !errors.Is(err, tt.wantError) {
+				t.Errorf("want %v; got %v", tt.wantError, err)
+			}
+			if id != tt.wantID {
+				t.Errorf("want ID %d; got %d", tt.wantID, id)
+			}
+		})
+	}
+}
+
+func TestEscapeDN(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"alice", "alice"},
+		{"alice,ou=admins", `alice\,ou\=admins`},
+		{"#alice ", `\#alice\ `},
+		{`a+b"c\d<e>f;g`, `a\+b\"c\\d\<e\>f\;g`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got := escapeDN(tt.value)
+			if got != tt.want {
+				t.Errorf("want %q; got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,415 @@
+// Package ldaptest provides an in-process LDAP server for tests. It understands just enough of the protocol
+// for simple binds, StartTLS and searches with equality, presence, "and", "or" and "not" filters.
+package ldaptest
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+// LDAP application tags, from RFC 4511.
+const (
+	appBindRequest       = 0
+	appBindResponse      = 1
+	appUnbindRequest     = 2
+	appSearchRequest     = 3
+	appSearchResultEntry = 4
+	appSearchResultDone  = 5
+	appExtendedRequest   = 23
+	appExtendedResponse  = 24
+)
+
+// LDAP result codes.
+const (
+	resultSuccess            = 0
+	resultOperationsError    = 1
+	resultProtocolError      = 2
+	resultNoSuchObject       = 32
+	resultInvalidCredentials = 49
+	resultInsufficientAccess = 50
+	resultUnwillingToPerform = 53
+)
+
+// Search filter tags and scopes.
+const (
+	filterAnd       = 0
+	filterOr        = 1
+	filterNot       = 2
+	filterEquality  = 3
+	filterPresent   = 7
+	scopeBaseObject = 0
+)
+
+const startTLSOID = "1.3.6.1.4.1.1466.20037"
+
+// Entry is a directory entry. Password is the userPassword the entry can bind with, empty if it can't bind.
+type Entry struct {
+	DN         string
+	Password   string
+	Attributes map[string][]string
+}
+
+// Server is an LDAP server listening on the loopback interface.
+type Server struct {
+	// URL is the ldap:// URL of the server.
+	URL string
+	// AllowAnonymousSearch lets clients search without binding first.
+	AllowAnonymousSearch bool
+
+	listener  net.Listener
+	tlsConfig *tls.Config
+	certPool  *x509.CertPool
+	wg        sync.WaitGroup
+
+	mu      sync.Mutex
+	entries []*Entry
+	conns   map[net.Conn]struct{}
+}
+
+// NewServer starts an LDAP server serving the given entries.
+// The caller should call Close when finished, to shut it down.
+func NewServer(entries ...*Entry) *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+
+	s := &Server{
+		URL:      "ldap://" + l.Addr().String(),
+		listener: l,
+		entries:  entries,
+		conns:    map[net.Conn]struct{}{},
+	}
+	s.generateCertificate()
+
+	s.wg.Add(1)
+	go s.serve()
+
+	return s
+}
+
+// ClientTLSConfig returns a TLS configuration trusting the server's self-signed certificate, for StartTLS.
+func (s *Server) ClientTLSConfig() *tls.Config {
+	return &tls.Config{RootCAs: s.certPool, ServerName: "127.0.0.1"}
+}
+
+// Close shuts down the server, closing the open connections.
+func (s *Server) Close() {
+	s.listener.Close()
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+// generateCertificate creates the self-signed certificate used for StartTLS.
+func (s *Server) generateCertificate() {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ldaptest"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		panic(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(err)
+	}
+
+	s.certPool = x509.NewCertPool()
+	s.certPool.AddCert(cert)
+	s.tlsConfig = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	}
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// handle serves the requests of a connection, one at a time.
+func (s *Server) handle(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	boundDN := ""
+	for {
+		packet, err := ber.ReadPacket(r)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case appBindRequest:
+			code := s.bind(op)
+			boundDN = ""
+			if code == resultSuccess {
+				boundDN = stringValue(op.Children[1])
+			}
+			write(conn, id, result(appBindResponse, code))
+		case appSearchRequest:
+			s.search(conn, id, op, boundDN)
+		case appExtendedRequest:
+			if len(op.Children) == 0 || stringValue(op.Children[0]) != startTLSOID {
+				write(conn, id, result(appExtendedResponse, resultProtocolError))
+				continue
+			}
+			write(conn, id, result(appExtendedResponse, resultSuccess))
+
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn = tlsConn
+			r = bufio.NewReader(conn)
+		case appUnbindRequest:
+			return
+		default:
+			write(conn, id, result(op.Tag+1, resultUnwillingToPerform))
+		}
+	}
+}
+
+// bind checks the credentials of a simple bind request. An empty name and password is an anonymous bind.
+func (s *Server) bind(op *ber.Packet) int {
+	if len(op.Children) < 3 || op.Children[2].ClassType != ber.ClassContext || op.Children[2].Tag != 0 {
+		return resultUnwillingToPerform
+	}
+	dn := stringValue(op.Children[1])
+	password := op.Children[2].Data.String()
+
+	if dn == "" && password == "" {
+		return resultSuccess
+	}
+
+	e := s.entry(dn)
+	if e == nil || e.Password == "" || e.Password != password {
+		return resultInvalidCredentials
+	}
+
+	return resultSuccess
+}
+
+func (s *Server) search(conn net.Conn, id int64, op *ber.Packet, boundDN string) {
+	if boundDN == "" && !s.AllowAnonymousSearch {
+		write(conn, id, result(appSearchResultDone, resultInsufficientAccess))
+		return
+	}
+	if len(op.Children) < 8 {
+		write(conn, id, result(appSearchResultDone, resultProtocolError))
+		return
+	}
+	base := normalize(stringValue(op.Children[0]))
+	scope, _ := op.Children[1].Value.(int64)
+	filter := op.Children[6]
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found := false
+	for _, e := range s.entries {
+		dn := normalize(e.DN)
+		inScope := dn == base
+		if scope != scopeBaseObject {
+			inScope = inScope || strings.HasSuffix(dn, ","+base) || base == ""
+		}
+		if !inScope {
+			continue
+		}
+		found = found || dn == base
+
+		ok, err := matches(filter, e)
+		if err != nil {
+			write(conn, id, result(appSearchResultDone, resultOperationsError))
+			return
+		}
+		if ok {
+			write(conn, id, searchEntry(e))
+		}
+	}
+
+	if scope == scopeBaseObject && !found {
+		write(conn, id, result(appSearchResultDone, resultNoSuchObject))
+		return
+	}
+
+	write(conn, id, result(appSearchResultDone, resultSuccess))
+}
+
+// entry returns the entry with a DN, or nil.
+func (s *Server) entry(dn string) *Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range s.entries {
+		if normalize(e.DN) == normalize(dn) {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// matches evaluates a search filter against an entry.
+func matches(filter *ber.Packet, e *Entry) (bool, error) {
+	switch filter.Tag {
+	case filterAnd, filterOr:
+		for _, child := range filter.Children {
+			ok, err := matches(child, e)
+			if err != nil {
+				return false, err
+			}
+			if ok == (filter.Tag == filterOr) {
+				return ok, nil
+			}
+		}
+		return filter.Tag == filterAnd, nil
+	case filterNot:
+		if len(filter.Children) != 1 {
+			return false, errUnsupportedFilter
+		}
+		ok, err := matches(filter.Children[0], e)
+		return !ok, err
+	case filterEquality:
+		if len(filter.Children) != 2 {
+			return false, errUnsupportedFilter
+		}
+		attr, value := stringValue(filter.Children[0]), stringValue(filter.Children[1])
+		for _, v := range attribute(e, attr) {
+			if strings.EqualFold(v, value) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case filterPresent:
+		return len(attribute(e, filter.Data.String())) > 0, nil
+	default:
+		return false, errUnsupportedFilter
+	}
+}
+
+type filterError string
+
+func (e filterError) Error() string { return string(e) }
+
+const errUnsupportedFilter = filterError("ldaptest: unsupported filter")
+
+// attribute returns the values of an attribute of an entry. Attribute names are case-insensitive.
+func attribute(e *Entry, name string) []string {
+	if strings.EqualFold(name, "objectClass") && len(e.Attributes["objectClass"]) == 0 {
+		return []string{"top"}
+	}
+	for k, v := range e.Attributes {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+
+	return nil
+}
+
+func searchEntry(e *Entry) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, appSearchResultEntry, nil, "Search Result Entry")
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.DN, "DN"))
+
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for name, values := range e.Attributes {
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		vals := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, v := range values {
+			vals.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "Value"))
+		}
+		attr.AppendChild(vals)
+		attrs.AppendChild(attr)
+	}
+	p.AppendChild(attrs)
+
+	return p
+}
+
+// result returns an LDAPResult with the given application tag and result code.
+func result(tag ber.Tag, code int) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "Result Code"))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic"))
+
+	return p
+}
+
+func write(conn net.Conn, id int64, op *ber.Packet) {
+	p := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "Message ID"))
+	p.AppendChild(op)
+	conn.Write(p.Bytes())
+}
+
+func stringValue(p *ber.Packet) string {
+	if s, ok := p.Value.(string); ok {
+		return s
+	}
+
+	return p.Data.String()
+}
+
+// normalize lower-cases a DN and removes the spaces around its components, which is enough for tests.
+func normalize(dn string) string {
+	parts := strings.Split(dn, ",")
+	for i, p := range parts {
+		parts[i] = strings.ToLower(strings.TrimSpace(p))
+	}
+
+	return strings.Join(parts, ",")
+}
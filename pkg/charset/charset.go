@@ -0,0 +1,147 @@
+// Package charset detects the character encoding of text and decodes it to UTF-8.
+//
+// It knows the encodings text files are usually saved in: UTF-8, UTF-16 (little and big endian) and, for
+// anything else, Windows-1252, the superset of ISO-8859-1 used by most western legacy files.
+package charset
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Names of the supported encodings, as returned by Detect.
+const (
+	UTF8        = "utf-8"
+	UTF16LE     = "utf-16le"
+	UTF16BE     = "utf-16be"
+	Windows1252 = "windows-1252"
+)
+
+// ErrUnsupported is returned by Decode when the declared charset isn't supported.
+var ErrUnsupported = errors.New("charset: unsupported charset")
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// aliases maps the charset names found in Content-Type headers to the supported encodings.
+var aliases = map[string]string{
+	"utf-8":        UTF8,
+	"utf8":         UTF8,
+	"us-ascii":     UTF8,
+	"ascii":        UTF8,
+	"utf-16le":     UTF16LE,
+	"utf-16be":     UTF16BE,
+	"iso-8859-1":   Windows1252,
+	"latin1":       Windows1252,
+	"windows-1252": Windows1252,
+	"cp1252":       Windows1252,
+}
+
+// Detect guesses the encoding of b. A byte order mark decides, otherwise text where every other byte is zero is
+// UTF-16, valid UTF-8 is UTF-8, and anything else is Windows-1252.
+func Detect(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, bomUTF8):
+		return UTF8
+	case bytes.HasPrefix(b, bomUTF16LE):
+		return UTF16LE
+	case bytes.HasPrefix(b, bomUTF16BE):
+		return UTF16BE
+	}
+
+	// Zero bytes are valid UTF-8 but text doesn't contain them, so UTF-16 is looked for first.
+	if len(b) >= 2 && len(b)%2 == 0 {
+		var evenZeros, oddZeros int
+		for i := 0; i < len(b); i += 2 {
+			if b[i] == 0 {
+				evenZeros++
+			}
+			if b[i+1] == 0 {
+				oddZeros++
+			}
+		}
+
+		// Mostly ASCII text in UTF-16 has a zero byte in every code unit.
+		half := len(b) / 2
+		switch {
+		case oddZeros*10 >= half*9 && evenZeros == 0:
+			return UTF16LE
+		case evenZeros*10 >= half*9 && oddZeros == 0:
+			return UTF16BE
+		}
+	}
+
+	if utf8.Valid(b) {
+		return UTF8
+	}
+
+	return Windows1252
+}
+
+// Decode converts b to UTF-8. declared is the charset b is said to be in, ex: the charset parameter of a
+// Content-Type header, or empty to detect it. Byte order marks are removed.
+// It returns the text and the name of the encoding it was decoded from.
+func Decode(b []byte, declared string) (string, string, error) {
+	name := Detect(b)
+	if declared != "" {
+		var ok bool
+		name, ok = aliases[strings.ToLower(strings.TrimSpace(declared))]
+		if !ok {
+			return "", "", ErrUnsupported
+		}
+	}
+
+	switch name {
+	case UTF8:
+		b = bytes.TrimPrefix(b, bomUTF8)
+		// Invalid sequences become U+FFFD, so the result is always valid UTF-8.
+		return strings.ToValidUTF8(string(b), "�"), name, nil
+	case UTF16LE:
+		return decodeUTF16(bytes.TrimPrefix(b, bomUTF16LE), false), name, nil
+	case UTF16BE:
+		return decodeUTF16(bytes.TrimPrefix(b, bomUTF16BE), true), name, nil
+	default:
+		return decodeWindows1252(b), name, nil
+	}
+}
+
+func decodeUTF16(b []byte, bigEndian bool) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		if bigEndian {
+			units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+		} else {
+			units = append(units, uint16(b[i+1])<<8|uint16(b[i]))
+		}
+	}
+
+	return string(utf16.Decode(units))
+}
+
+// windows1252 maps the bytes 0x80 to 0x9F of Windows-1252 to runes. The other bytes are the same as in
+// ISO-8859-1, and so as the first 256 Unicode code points. Unassigned bytes map to U+FFFD.
+var windows1252 = [32]rune{
+	'€', '�', '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', '�', 'Ž', '�',
+	'�', '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', '�', 'ž', 'Ÿ',
+}
+
+func decodeWindows1252(b []byte) string {
+	var sb strings.Builder
+	sb.Grow(len(b))
+
+	for _, c := range b {
+		if c >= 0x80 && c <= 0x9F {
+			sb.WriteRune(windows1252[c-0x80])
+		} else {
+			sb.WriteRune(rune(c))
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,45 @@
+package charset
+
+import (
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		declared string
+		want     string
+		wantName string
+		wantErr  error
+	}{
+		{"ASCII", "plain text", "", "plain text", UTF8, nil},
+		{"UTF-8", "café", "", "café", UTF8, nil},
+		{"UTF-8 BOM", "\xef\xbb\xbfcafé", "", "café", UTF8, nil},
+		{"UTF-16LE BOM", "\xff\xfec\x00a\x00f\x00\xe9\x00", "", "café", UTF16LE, nil},
+		{"UTF-16BE BOM", "\xfe\xff\x00c\x00a\x00f\x00\xe9", "", "café", UTF16BE, nil},
+		{"UTF-16LE without BOM", "l\x00o\x00g\x00", "", "log", UTF16LE, nil},
+		{"UTF-16 surrogate pair", "\xff\xfe\x3d\xd8\x00\xde", "", "😀", UTF16LE, nil},
+		{"Windows-1252", "caf\xe9 \x80 3", "", "café € 3", Windows1252, nil},
+		{"Declared Latin-1", "na\xefve", "ISO-8859-1", "naïve", Windows1252, nil},
+		{"Declared UTF-8 with invalid bytes", "caf\xe9", "utf-8", "caf�", UTF8, nil},
+		{"Unsupported charset", "menu", "shift_jis", "", "", ErrUnsupported},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, name, err := Decode([]byte(tt.input), tt.declared)
+			if err != tt.wantErr {
+				t.Fatalf("want error %v; got %v", tt.wantErr, err)
+			}
+
+			if got != tt.want {
+				t.Errorf("want %q; got %q", tt.want, got)
+			}
+
+			if name != tt.wantName {
+				t.Errorf("want charset %q; got %q", tt.wantName, name)
+			}
+		})
+	}
+}
@@ -2,9 +2,14 @@ package forms
 
 import (
 	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
 	"net/url"
 	"regexp"
 	"strings"
+	"time"
 	"unicode/utf8"
 )
 
@@ -17,6 +22,8 @@ type Form struct {
 	// url.Values is embedded anonymously.
 	url.Values
 	Errors errors
+	// Files holds the files uploaded with a multipart form, by field name.
+	Files map[string][]*multipart.FileHeader
 }
 
 // New initialize a custom Form struct.
@@ -24,9 +31,20 @@ func New(data url.Values) *Form {
 	return &Form{
 		data,
 		errors(map[string][]string{}),
+		nil,
 	}
 }
 
+// NewMultipart initialize a custom Form struct from a parsed multipart form, including its uploaded files.
+func NewMultipart(data url.Values, form *multipart.Form) *Form {
+	f := New(data)
+	if form != nil {
+		f.Files = form.File
+	}
+
+	return f
+}
+
 // Required method check that specific fields in the form data are present and not blank.
 // If any field fails this check, add the message to the Form errors.
 func (f *Form) Required(fields ...string) {
@@ -96,3 +114,98 @@ func (f *Form) MatchesPattern(field string, pattern *regexp.Regexp) {
 func (f *Form) Valid() bool {
 	return len(f.Errors) == 0
 }
+
+// ValidDate method check that a specific field in the form is a date in the given layout.
+// If the check fails then add the message to the form errors.
+func (f *Form) ValidDate(field, layout string) {
+	value := f.Get(field)
+	if value == "" {
+		return
+	}
+	if _, err := time.Parse(layout, value); err != nil {
+		f.Errors.Add(field, "This field is not a valid date")
+	}
+}
+
+// File method returns the first file uploaded with a specific field, or nil if no file was uploaded.
+func (f *Form) File(field string) *multipart.FileHeader {
+	fhs := f.Files[field]
+	if len(fhs) == 0 {
+		return nil
+	}
+
+	return fhs[0]
+}
+
+// MaxFileSize method check that the file uploaded with a specific field is at most n bytes.
+// If the check fails then add the message to the form errors.
+func (f *Form) MaxFileSize(field string, n int64) {
+	fh := f.File(field)
+	if fh == nil {
+		return
+	}
+	if fh.Size > n {
+		f.Errors.Add(field, fmt.Sprintf("This file is too large (maximum is %s)", FormatSize(n)))
+	}
+}
+
+// PermittedFileTypes method check that the content of the file uploaded with a specific field is of one of the
+// given media types, ex: "text/plain". A type can end with "/*" to permit any subtype, ex: "text/*".
+// The type is detected from the content, so the name of the file and the type declared by the browser don't
+// matter. If the check fails then add the appropriate message to the form errors.
+func (f *Form) PermittedFileTypes(field string, types ...string) {
+	fh := f.File(field)
+	if fh == nil {
+		return
+	}
+
+	contentType, err := DetectFileType(fh)
+	if err != nil {
+		f.Errors.Add(field, "This file could not be read")
+		return
+	}
+
+	for _, t := range types {
+		if contentType == t || strings.HasSuffix(t, "/*") && strings.HasPrefix(contentType, strings.TrimSuffix(t, "*")) {
+			return
+		}
+	}
+
+	f.Errors.Add(field, "This type of file is not permitted")
+}
+
+// DetectFileType returns the media type of an uploaded file, detected from its first bytes with
+// http.DetectContentType, without parameters, ex: "text/plain".
+func DetectFileType(fh *multipart.FileHeader) (string, error) {
+	file, err := fh.Open()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	// DetectContentType considers at most the first 512 bytes.
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(buf[:n]))
+	if err != nil {
+		return "", err
+	}
+
+	return mediaType, nil
+}
+
+// FormatSize formats a number of bytes for error messages, ex: "2 MB".
+func FormatSize(n int64) string {
+	switch {
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return fmt.Sprintf("%d MB", n>>20)
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return fmt.Sprintf("%d KB", n>>10)
+	default:
+		return fmt.Sprintf("%d bytes", n)
+	}
+}
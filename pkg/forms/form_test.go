@@ -0,0 +1,121 @@
+package forms
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/url"
+	"testing"
+)
+
+// newFileForm returns a Form with a file uploaded with the "upload" field.
+func newFileForm(t *testing.T, content string) *Form {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	w, err := mw.CreateFormFile("upload", "upload.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte(content))
+	mw.Close()
+
+	mf, err := multipart.NewReader(&body, mw.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { mf.RemoveAll() })
+
+	return NewMultipart(url.Values{}, mf)
+}
+
+func TestMaxFileSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		max     int64
+		want    string
+	}{
+		{"Smaller", "abc", 4, ""},
+		{"Equal", "abcd", 4, ""},
+		{"Larger", "abcde", 4, "This file is too large (maximum is 4 bytes)"},
+		{"Kilobytes", string(make([]byte, 3<<10)), 2 << 10, "This file is too large (maximum is 2 KB)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := newFileForm(t, tt.content)
+			form.MaxFileSize("upload", tt.max)
+
+			if got := form.Errors.Get("upload"); got != tt.want {
+				t.Errorf("want %q; got %q", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("No file", func(t *testing.T) {
+		form := New(url.Values{})
+		form.MaxFileSize("upload", 0)
+
+		if !form.Valid() {
+			t.Errorf("want no error; got %v", form.Errors)
+		}
+	})
+}
+
+func TestPermittedFileTypes(t *testing.T) {
+	const png = "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+
+	tests := []struct {
+		name    string
+		content string
+		types   []string
+		want    string
+	}{
+		{"Exact type", "A frog jumps into the pond", []string{"text/plain"}, ""},
+		{"Wildcard", "A frog jumps into the pond", []string{"text/*"}, ""},
+		{"One of several", png, []string{"text/*", "image/png"}, ""},
+		{"Not permitted", png, []string{"text/*"}, "This type of file is not permitted"},
+		{"Wildcard prefix only", "A frog jumps into the pond", []string{"tex/*"},
+			"This type of file is not permitted"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := newFileForm(t, tt.content)
+			form.PermittedFileTypes("upload", tt.types...)
+
+			if got := form.Errors.Get("upload"); got != tt.want {
+				t.Errorf("want %q; got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDetectFileType(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"Text", "A frog jumps into the pond", "text/plain"},
+		{"Empty", "", "text/plain"},
+		{"HTML", "<!DOCTYPE html><p>A frog</p>", "text/html"},
+		{"PNG", "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR", "image/png"},
+		{"Binary", "\x00\x01\x02\x03", "application/octet-stream"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := newFileForm(t, tt.content)
+
+			got, err := DetectFileType(form.File("upload"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The parameters, like the charset of text files, are left out.
+			if got != tt.want {
+				t.Errorf("want %q; got %q", tt.want, got)
+			}
+		})
+	}
+}
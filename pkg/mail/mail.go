@@ -0,0 +1,135 @@
+// Package mail sends plain text emails through an SMTP server.
+package mail
+
+import (
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Sender sends emails through an SMTP server. The connection is upgraded with STARTTLS when the server supports
+// it, and credentials are only sent over TLS or to localhost.
+type Sender struct {
+	// Addr is the host and port of the server, ex: "smtp.example.com:587".
+	Addr string
+	// From is the address the emails are sent from, ex: "Snippetbox <noreply@snippetbox.example>".
+	From string
+	// Username and Password authenticate to the server with PLAIN, if Username is set.
+	Username string
+	Password string
+	// Timeout of the whole exchange with the server, defaults to 10 seconds.
+	Timeout time.Duration
+}
+
+// Send sends an email to a single address.
+func (s *Sender) Send(to, subject, body string) error {
+	from, err := envelopeAddress(s.From)
+	if err != nil {
+		return err
+	}
+
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return err
+	}
+
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+
+	// smtp.SendMail has no timeout, so the connection is dialed here with a deadline.
+	conn, err := net.DialTimeout("tcp", s.Addr, timeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		err = c.StartTLS(&tls.Config{ServerName: host})
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.Username != "" {
+		err = c.Auth(smtp.PlainAuth("", s.Username, s.Password, host))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = c.Mail(from)
+	if err != nil {
+		return err
+	}
+	err = c.Rcpt(to)
+	if err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(message(s.From, to, subject, body, time.Now()))
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// envelopeAddress returns the bare address of a From header, ex: "noreply@snippetbox.example".
+func envelopeAddress(from string) (string, error) {
+	addr := from
+	if i := strings.LastIndexByte(addr, '<'); i >= 0 && strings.HasSuffix(addr, ">") {
+		addr = addr[i+1 : len(addr)-1]
+	}
+
+	if addr == "" || strings.ContainsAny(from, "\r\n") || strings.ContainsAny(addr, "<> ") {
+		return "", fmt.Errorf("mail: invalid sender address %q", from)
+	}
+
+	return addr, nil
+}
+
+// message returns an email encoded as sent to the server. Line breaks are removed from the header values so they
+// can't add headers, and the subject is encoded when it isn't plain ASCII.
+func message(from, to, subject, body string, date time.Time) []byte {
+	oneLine := strings.NewReplacer("\r", "", "\n", " ")
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", oneLine.Replace(from))
+	fmt.Fprintf(&b, "To: %s\r\n", oneLine.Replace(to))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", oneLine.Replace(subject)))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+
+	// Lines end with CRLF. The dots starting lines are escaped by the smtp client.
+	body = strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n")
+	b.WriteString(body)
+	if !strings.HasSuffix(body, "\r\n") {
+		b.WriteString("\r\n")
+	}
+
+	return []byte(b.String())
+}
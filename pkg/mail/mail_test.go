@@ -0,0 +1,133 @@
+package mail
+
+import (
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessage(t *testing.T) {
+	date := time.Date(2021, 3, 15, 10, 0, 0, 0, time.UTC)
+	got := string(message("Snippetbox <noreply@snippetbox.example>", "carol@example.com",
+		"Join Acme\r\nBcc: mallory@example.com", "Hello,\n\nJoin us.", date))
+
+	want := "From: Snippetbox <noreply@snippetbox.example>\r\n" +
+		"To: carol@example.com\r\n" +
+		"Subject: Join Acme Bcc: mallory@example.com\r\n" +
+		"Date: Mon, 15 Mar 2021 10:00:00 +0000\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: 8bit\r\n" +
+		"\r\n" +
+		"Hello,\r\n\r\nJoin us.\r\n"
+	if got != want {
+		t.Errorf("want %q; got %q", want, got)
+	}
+
+	got = string(message("noreply@snippetbox.example", "carol@example.com", "Join Café", "", date))
+	if !strings.Contains(got, "Subject: =?utf-8?q?Join_Caf=C3=A9?=\r\n") {
+		t.Errorf("want an encoded subject; got %q", got)
+	}
+}
+
+func TestEnvelopeAddress(t *testing.T) {
+	tests := []struct {
+		from    string
+		want    string
+		wantErr bool
+	}{
+		{"noreply@snippetbox.example", "noreply@snippetbox.example", false},
+		{"Snippetbox <noreply@snippetbox.example>", "noreply@snippetbox.example", false},
+		{"", "", true},
+		{"noreply@snippetbox.example\r\nRCPT TO:<mallory@example.com>", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from, func(t *testing.T) {
+			got, err := envelopeAddress(tt.from)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("want error %t; got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("want %q; got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+// serveSMTP accepts a single SMTP session on l and sends the commands received, and the lines of the message,
+// once the session is over.
+func serveSMTP(l net.Listener) <-chan []string {
+	received := make(chan []string, 1)
+
+	go func() {
+		var lines []string
+		defer func() { received <- lines }()
+
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		tp := textproto.NewConn(conn)
+		defer tp.Close()
+
+		tp.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			lines = append(lines, line)
+
+			switch {
+			case strings.HasPrefix(line, "EHLO"):
+				tp.PrintfLine("250 localhost")
+			case line == "DATA":
+				tp.PrintfLine("354 go ahead")
+				data, err := tp.ReadDotLines()
+				if err != nil {
+					return
+				}
+				lines = append(lines, data...)
+				tp.PrintfLine("250 queued")
+			case line == "QUIT":
+				tp.PrintfLine("221 bye")
+				return
+			default:
+				tp.PrintfLine("250 ok")
+			}
+		}
+	}()
+
+	return received
+}
+
+func TestSend(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	received := serveSMTP(l)
+
+	s := &Sender{Addr: l.Addr().String(), From: "Snippetbox <noreply@snippetbox.example>"}
+	err = s.Send("carol@example.com", "Join Acme", "Hello,\n.\nJoin us.")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := strings.Join(<-received, "\n")
+	for _, want := range []string{
+		"MAIL FROM:<noreply@snippetbox.example>",
+		"RCPT TO:<carol@example.com>",
+		"Subject: Join Acme",
+		"Hello,\n.\nJoin us.",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("want session %q to contain %q", got, want)
+		}
+	}
+}
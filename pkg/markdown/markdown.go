@@ -0,0 +1,200 @@
+// Package markdown renders Markdown documents to HTML which is safe to embed in a page.
+//
+// Documents are parsed as CommonMark with the GitHub Flavored Markdown extensions (tables, task lists,
+// strikethrough and autolinks). Code fences are highlighted, and documents with several headings start with a
+// table of contents linking to them.
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/alecthomas/chroma"
+	chromahtml "github.com/alecthomas/chroma/formatters/html"
+	"github.com/alecthomas/chroma/lexers"
+	"github.com/alecthomas/chroma/styles"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+	"html"
+	"regexp"
+)
+
+// md converts Markdown to HTML. Raw HTML in documents is left out, so authors can't add elements clashing with
+// the page, like ids used by its scripts; the sanitizer catches anything else.
+var md = goldmark.New(
+	goldmark.WithExtensions(
+		extension.Linkify,
+		extension.Strikethrough,
+		extension.NewTable(extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute)),
+		extension.TaskList,
+	),
+	goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+	goldmark.WithRendererOptions(
+		renderer.WithNodeRenderers(util.Prioritized(&highlighter{}, 100)),
+	),
+)
+
+// policy is the allowlist of the HTML elements and attributes the rendered documents can contain: the ones
+// user generated content can safely hold, plus the classes of the highlighted code and the table of contents.
+var policy = func() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.RequireNoFollowOnLinks(true)
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^[a-z0-9 ]+$`)).OnElements("pre", "code", "span")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^toc$`)).OnElements("nav")
+	p.AllowElements("nav")
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").Matching(regexp.MustCompile(`^(|checked|disabled)$`)).OnElements("input")
+	return p
+}()
+
+// Render converts a Markdown document to sanitized HTML. The ids of the headings start with idPrefix, so several
+// documents can be shown on the same page, ex: "F1-" gives "F1-getting-started".
+func Render(source []byte, idPrefix string) ([]byte, error) {
+	ids := &prefixedIDs{IDs: parser.NewContext().IDs(), prefix: idPrefix}
+	ctx := parser.NewContext(parser.WithIDs(ids))
+
+	doc := md.Parser().Parse(text.NewReader(source), parser.WithContext(ctx))
+
+	var buf bytes.Buffer
+	writeTOC(&buf, headings(doc, source))
+
+	err := md.Renderer().Render(&buf, source, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return policy.SanitizeBytes(buf.Bytes()), nil
+}
+
+// prefixedIDs generates the ids of headings from their text, like goldmark does, with a prefix.
+type prefixedIDs struct {
+	parser.IDs
+	prefix string
+}
+
+func (ids *prefixedIDs) Generate(value []byte, kind ast.NodeKind) []byte {
+	return append([]byte(ids.prefix), ids.IDs.Generate(value, kind)...)
+}
+
+// heading is an entry of the table of contents.
+type heading struct {
+	level int
+	id    string
+	text  string
+}
+
+// headings returns the headings of a document, in order.
+func headings(doc ast.Node, source []byte) []heading {
+	var hs []heading
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		h, ok := n.(*ast.Heading)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+
+		id, _ := h.AttributeString("id")
+		idBytes, _ := id.([]byte)
+		hs = append(hs, heading{level: h.Level, id: string(idBytes), text: string(h.Text(source))})
+
+		return ast.WalkSkipChildren, nil
+	})
+
+	return hs
+}
+
+// writeTOC writes the table of contents of a document with several headings: nested lists of links to them,
+// following their levels.
+func writeTOC(buf *bytes.Buffer, hs []heading) {
+	if len(hs) < 2 {
+		return
+	}
+
+	top := hs[0].level
+	for _, h := range hs {
+		if h.level < top {
+			top = h.level
+		}
+	}
+
+	buf.WriteString(`<nav class="toc">`)
+	depth := -1
+	for _, h := range hs {
+		// A heading can only be nested one level deeper than the previous one, ex: a h4 right after a h2.
+		level := h.level - top
+		if level > depth+1 {
+			level = depth + 1
+		}
+
+		switch {
+		case level > depth:
+			buf.WriteString("<ul>")
+		case level == depth:
+			buf.WriteString("</li>")
+		default:
+			buf.WriteString("</li>")
+			for d := depth; d > level; d-- {
+				buf.WriteString("</ul></li>")
+			}
+		}
+		depth = level
+
+		fmt.Fprintf(buf, `<li><a href="#%s">%s</a>`, html.EscapeString(h.id), html.EscapeString(h.text))
+	}
+
+	buf.WriteString("</li>")
+	for d := depth; d > 0; d-- {
+		buf.WriteString("</ul></li>")
+	}
+	buf.WriteString("</ul></nav>")
+}
+
+// highlighter renders code fences with their code highlighted by chroma, using CSS classes rather than inline
+// styles so they survive the sanitizer.
+type highlighter struct{}
+
+// RegisterFuncs implements renderer.NodeRenderer.
+func (h *highlighter) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindFencedCodeBlock, h.renderFencedCodeBlock)
+}
+
+var formatter = chromahtml.New(chromahtml.WithClasses(true))
+
+func (h *highlighter) renderFencedCodeBlock(w util.BufWriter, source []byte, node ast.Node,
+	entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	n := node.(*ast.FencedCodeBlock)
+	var code bytes.Buffer
+	for i := 0; i < n.Lines().Len(); i++ {
+		line := n.Lines().At(i)
+		code.Write(line.Value(source))
+	}
+
+	// Fences without a language, or with an unknown one, are plain text.
+	var lexer chroma.Lexer
+	if language := n.Language(source); language != nil {
+		lexer = lexers.Get(string(language))
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, code.String())
+	if err != nil {
+		return ast.WalkStop, err
+	}
+
+	err = formatter.Format(w, styles.Fallback, iterator)
+	if err != nil {
+		return ast.WalkStop, err
+	}
+
+	return ast.WalkSkipChildren, nil
+}
@@ -0,0 +1,91 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name      string
+		source    string
+		want      []string
+		wantNotIn []string
+	}{
+		{
+			name:   "Table",
+			source: "| Name | Size |\n|:--|--:|\n| log | 12 |\n",
+			want:   []string{`<th align="left">Name</th>`, `<td align="right">12</td>`},
+		},
+		{
+			name:   "Task list",
+			source: "- [x] done\n- [ ] todo\n",
+			want:   []string{`<input checked="" disabled="" type="checkbox"> done`, `<input disabled="" type="checkbox"> todo`},
+		},
+		{
+			name:   "Strikethrough and autolink",
+			source: "~~old~~ https://example.com\n",
+			want:   []string{"<del>old</del>", `<a href="https://example.com" rel="nofollow">https://example.com</a>`},
+		},
+		{
+			name:   "Highlighted code",
+			source: "```go\nfmt.Println(\"hi\")\n```\n",
+			want:   []string{`<pre class="chroma">`, `<span class="nf">Println</span>`},
+		},
+		{
+			name:   "Unknown language",
+			source: "```nosuchlanguage\n<b>\n```\n",
+			want:   []string{`<pre class="chroma">`, "&lt;b&gt;"},
+		},
+		{
+			name:   "Table of contents",
+			source: "# Runbook\n\n## Restart\n\n### Check\n\n## Restart\n",
+			want: []string{
+				`<nav class="toc"><ul><li><a href="#F1-runbook" rel="nofollow">Runbook</a><ul>` +
+					`<li><a href="#F1-restart" rel="nofollow">Restart</a><ul>` +
+					`<li><a href="#F1-check" rel="nofollow">Check</a></li></ul></li>` +
+					`<li><a href="#F1-restart-1" rel="nofollow">Restart</a></li></ul></li></ul></nav>`,
+				`<h1 id="F1-runbook">Runbook</h1>`,
+				`<h2 id="F1-restart-1">Restart</h2>`,
+			},
+		},
+		{
+			name:      "Single heading",
+			source:    "# Notes\n\nText.\n",
+			want:      []string{`<h1 id="F1-notes">Notes</h1>`},
+			wantNotIn: []string{"<nav"},
+		},
+		{
+			name:      "Raw HTML",
+			source:    "<script>alert(1)</script>\n\nText <img src=x onerror=alert(1)>\n",
+			want:      []string{"<p>Text </p>"},
+			wantNotIn: []string{"<script", "<img", "alert"},
+		},
+		{
+			name:      "JavaScript link",
+			source:    "[click](javascript:alert(1))\n",
+			wantNotIn: []string{"javascript:", "href"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render([]byte(tt.source), "F1-")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, want := range tt.want {
+				if !strings.Contains(string(got), want) {
+					t.Errorf("want body to contain %q; got %q", want, got)
+				}
+			}
+
+			for _, notWant := range tt.wantNotIn {
+				if strings.Contains(string(got), notWant) {
+					t.Errorf("want body not to contain %q; got %q", notWant, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package mock
+
+import (
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"time"
+)
+
+var mockAuditEvent = &models.AuditEvent{
+	ID:      1,
+	UserID:  1,
+	Event:   "user.login",
+	Details: "alice@example.com",
+	IP:      "127.0.0.1",
+	Created: time.Now(),
+}
+
+// Inserted events are kept in Recorded.
+type AuditLogModel struct {
+	Recorded []*models.AuditEvent
+}
+
+func (m *AuditLogModel) Insert(userID int, event, ip, details string) error {
+	m.Recorded = append(m.Recorded, &models.AuditEvent{UserID: userID, Event: event, Details: details, IP: ip})
+	return nil
+}
+
+func (m *AuditLogModel) Search(filter models.AuditFilter, limit int) ([]*models.AuditEvent, error) {
+	return []*models.AuditEvent{mockAuditEvent}, nil
+}
+
+func (m *AuditLogModel) Each(filter models.AuditFilter, fn func(*models.AuditEvent) error) error {
+	return fn(mockAuditEvent)
+}
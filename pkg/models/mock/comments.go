@@ -0,0 +1,90 @@
+package mock
+
+import (
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"time"
+)
+
+// Alice commented on the first line of the first revision of the snippet 1 and Bob replied. Alice also
+// commented on the organization snippet 3.
+var mockComment = &models.Comment{
+	ID:        1,
+	SnippetID: 1,
+	UserID:    1,
+	UserName:  "Alice",
+	Revision:  1,
+	Lines:     models.LineRange{File: 1, Start: 1, End: 1},
+	Content:   "Lovely haiku.",
+	Created:   time.Now(),
+}
+
+var mockReply = &models.Comment{
+	ID:        2,
+	SnippetID: 1,
+	UserID:    2,
+	UserName:  "Bob",
+	ParentID:  1,
+	Revision:  1,
+	Content:   "Agreed!",
+	Created:   time.Now(),
+	Depth:     1,
+}
+
+var mockOrgComment = &models.Comment{
+	ID:        3,
+	SnippetID: 3,
+	UserID:    1,
+	UserName:  "Alice",
+	Revision:  1,
+	Content:   "Team only.",
+	Created:   time.Now(),
+}
+
+type CommentModel struct{}
+
+func (m *CommentModel) Insert(snippetID, revision, userID, parentID int, lines models.LineRange,
+	content string) (int, error) {
+	return 4, nil
+}
+
+func (m *CommentModel) Get(id int) (*models.Comment, error) {
+	switch id {
+	case 1:
+		return mockComment, nil
+	case 2:
+		return mockReply, nil
+	case 3:
+		return mockOrgComment, nil
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+
+func (m *CommentModel) ForSnippet(snippetID int) ([]*models.Comment, error) {
+	switch snippetID {
+	case 1:
+		return []*models.Comment{mockComment, mockReply}, nil
+	case 3:
+		return []*models.Comment{mockOrgComment}, nil
+	default:
+		return []*models.Comment{}, nil
+	}
+}
+
+func (m *CommentModel) Update(id int, content string) error {
+	switch id {
+	case 1, 2, 3:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+
+func (m *CommentModel) Delete(id int) error {
+	switch id {
+	case 1, 2, 3:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
@@ -0,0 +1,33 @@
+package mock
+
+import (
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"time"
+)
+
+type LoginAttemptModel struct{}
+
+func (m *LoginAttemptModel) Insert(email, ip string) (int, error) {
+	return 1, nil
+}
+
+func (m *LoginAttemptModel) Clear(email string) error {
+	return nil
+}
+
+func (m *LoginAttemptModel) ClearIP(ip string) error {
+	return nil
+}
+
+func (m *LoginAttemptModel) EmailFailures(email string, beforeID int, since time.Time) (*models.LoginFailures, error) {
+	switch email {
+	case "locked@example.com":
+		return &models.LoginFailures{Count: 10, Last: time.Now()}, nil
+	default:
+		return &models.LoginFailures{}, nil
+	}
+}
+
+func (m *LoginAttemptModel) IPFailures(ip string, beforeID int, since time.Time) (*models.LoginFailures, error) {
+	return &models.LoginFailures{}, nil
+}
@@ -0,0 +1,103 @@
+package mock
+
+import (
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"time"
+)
+
+// The organization 1 is owned by Alice, Bob has been invited to join it with the token "bob-invitation-token".
+var mockOrganization = &models.Organization{
+	ID:      1,
+	Name:    "Acme",
+	Created: time.Now(),
+	Role:    models.RoleOwner,
+}
+
+var mockInvitation = &models.Invitation{
+	ID:      1,
+	OrgID:   1,
+	OrgName: "Acme",
+	Email:   "bob@example.com",
+	Role:    models.RoleMember,
+	Created: time.Now(),
+}
+
+type OrganizationModel struct{}
+
+func (m *OrganizationModel) Insert(name string, ownerID int) (int, error) {
+	return 2, nil
+}
+
+func (m *OrganizationModel) Get(id, userID int) (*models.Organization, error) {
+	switch {
+	case id == 1 && userID == 1:
+		return mockOrganization, nil
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+
+func (m *OrganizationModel) ForUser(userID int) ([]*models.Organization, error) {
+	switch userID {
+	case 1:
+		return []*models.Organization{mockOrganization}, nil
+	default:
+		return []*models.Organization{}, nil
+	}
+}
+
+func (m *OrganizationModel) Members(orgID int) ([]*models.Membership, error) {
+	return []*models.Membership{{
+		OrgID:   1,
+		UserID:  1,
+		Name:    mockUser.Name,
+		Email:   mockUser.Email,
+		Role:    models.RoleOwner,
+		Created: time.Now(),
+	}}, nil
+}
+
+func (m *OrganizationModel) Invite(orgID int, email, role string, invitedBy int) (string, error) {
+	switch email {
+	case "alice@example.com", "bob@example.com":
+		return "", models.ErrDuplicateMember
+	default:
+		return "new-invitation-token", nil
+	}
+}
+
+func (m *OrganizationModel) Invitation(token string) (*models.Invitation, error) {
+	switch token {
+	case "bob-invitation-token":
+		return mockInvitation, nil
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+
+func (m *OrganizationModel) AcceptInvitation(token string, userID int) (int, error) {
+	switch token {
+	case "bob-invitation-token":
+		return 1, nil
+	default:
+		return 0, models.ErrNoRecord
+	}
+}
+
+func (m *OrganizationModel) DeclineInvitation(token string) error {
+	switch token {
+	case "bob-invitation-token":
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+
+func (m *OrganizationModel) RemoveMember(orgID, userID int) error {
+	switch {
+	case orgID == 1 && userID == 2:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
@@ -0,0 +1,21 @@
+package mock
+
+import (
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+)
+
+// The snippet 1 is the only one ranked, in every ranking.
+type RankingModel struct{}
+
+func (m *RankingModel) Refresh() error {
+	return nil
+}
+
+func (m *RankingModel) Get(name string, limit int) ([]*models.Snippet, error) {
+	switch name {
+	case models.RankingTrending, models.RankingWeek, models.RankingMonth, models.RankingAll:
+		return []*models.Snippet{mockSnippet}, nil
+	default:
+		return []*models.Snippet{}, nil
+	}
+}
@@ -0,0 +1,69 @@
+package mock
+
+import (
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"time"
+)
+
+var mockSession = &models.Session{
+	ID:        1,
+	UserID:    1,
+	IP:        "127.0.0.1",
+	UserAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:89.0) Gecko/20100101 Firefox/89.0",
+	Created:   time.Now(),
+	LastSeen:  time.Now(),
+	Expires:   time.Now().Add(12 * time.Hour),
+}
+
+var mockOtherSession = &models.Session{
+	ID:        2,
+	UserID:    2,
+	IP:        "127.0.0.1",
+	UserAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:89.0) Gecko/20100101 Firefox/89.0",
+	Created:   time.Now(),
+	LastSeen:  time.Now(),
+	Expires:   time.Now().Add(12 * time.Hour),
+}
+
+type SessionModel struct{}
+
+func (m *SessionModel) Insert(userID int, ip, userAgent string, lifetime time.Duration) (string, error) {
+	switch userID {
+	case 2:
+		return "other-token", nil
+	default:
+		return "valid-token", nil
+	}
+}
+
+func (m *SessionModel) Get(token string) (*models.Session, error) {
+	switch token {
+	case "valid-token":
+		return mockSession, nil
+	case "other-token":
+		return mockOtherSession, nil
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+
+func (m *SessionModel) Touch(id int, ip string) error {
+	return nil
+}
+
+func (m *SessionModel) List(userID int) ([]*models.Session, error) {
+	return []*models.Session{mockSession}, nil
+}
+
+func (m *SessionModel) Revoke(userID, id int) error {
+	switch {
+	case userID == 1 && id == 1:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+
+func (m *SessionModel) RevokeAll(userID int) error {
+	return nil
+}
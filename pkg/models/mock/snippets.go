@@ -5,29 +5,233 @@ import (
 	"time"
 )
 
+// mockSnippet was edited once, mockRevision is its first revision.
 var mockSnippet = &models.Snippet{
-	ID:      1,
-	Title:   "An old silent pond",
-	Content: "An old silent pond...",
-	Created: time.Now(),
-	Expires: time.Now(),
+	ID:       1,
+	UserID:   1,
+	Title:    "An old silent pond",
+	Created:  time.Now(),
+	Expires:  time.Now(),
+	Revision: 2,
+	Files: []*models.File{
+		{Position: 1, Name: "haiku.txt",
+			Content: "An old silent pond...\nA frog jumps into the pond,\nsplash! Silence again."},
+		{Position: 2, Name: "notes.md", Language: "markdown", Content: "Written by Basho."},
+	},
+}
+
+var mockRevision = &models.Revision{
+	SnippetID: 1,
+	Number:    1,
+	Title:     "An old pond",
+	Created:   time.Now(),
+	Files:     []*models.File{{Position: 1, Name: "haiku.txt", Content: "An old pond..."}},
+}
+
+// mockOrgSnippet is shared with the members of the organization 1.
+var mockOrgSnippet = &models.Snippet{
+	ID:       3,
+	UserID:   1,
+	OrgID:    1,
+	Title:    "Team notes",
+	Created:  time.Now(),
+	Expires:  time.Now(),
+	Revision: 1,
+	Files:    []*models.File{{Position: 1, Name: "notes.txt", Content: "Only for the team..."}},
+}
+
+// mockFork is a fork of mockSnippet.
+var mockFork = &models.Snippet{
+	ID:         4,
+	UserID:     2,
+	Title:      "An old silent pond (fork)",
+	Created:    time.Now(),
+	Expires:    time.Now(),
+	ForkedFrom: 1,
+	Revision:   1,
+	Files:      []*models.File{{Position: 1, Name: "haiku.txt", Content: "An old silent pond..."}},
+}
+
+// mockScheduled is published in an hour, only its author Alice can see it until then.
+var mockScheduled = &models.Snippet{
+	ID:        5,
+	UserID:    1,
+	Title:     "Announcement",
+	Created:   time.Now(),
+	Expires:   time.Now().Add(time.Hour + 7*24*time.Hour),
+	PublishAt: time.Now().Add(time.Hour),
+	Revision:  1,
+	Files:     []*models.File{{Position: 1, Name: "news.txt", Content: "Coming soon..."}},
 }
 
 type SnippetModel struct{}
 
-func (m *SnippetModel) Insert(title, content, expires string) (int, error) {
+func (m *SnippetModel) Insert(userID, orgID int, title string, files []*models.File, expires string,
+	publishAt time.Time) (int, error) {
 	return 2, nil
 }
 
-func (m *SnippetModel) Get(id int) (*models.Snippet, error) {
+func (m *SnippetModel) Get(id, viewerID int) (*models.Snippet, error) {
+	switch {
+	case id == 1:
+		return mockSnippet, nil
+	case id == 3 && viewerID == 1:
+		return mockOrgSnippet, nil
+	case id == 5 && viewerID == 1:
+		return mockScheduled, nil
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+
+// Find returns the snippets of Get without their files, like the model does.
+func (m *SnippetModel) Find(id, viewerID int) (*models.Snippet, error) {
+	s, err := m.Get(id, viewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	found := *s
+	found.Files = nil
+	return &found, nil
+}
+
+func (m *SnippetModel) Popular() ([]*models.Snippet, error) {
+	return []*models.Snippet{mockSnippet}, nil
+}
+
+func (m *SnippetModel) ByAuthor(userID, limit, offset int) ([]*models.Snippet, error) {
+	switch {
+	case userID == 1 && offset == 0:
+		return []*models.Snippet{mockSnippet}, nil
+	default:
+		return []*models.Snippet{}, nil
+	}
+}
+
+func (m *SnippetModel) ForOrg(orgID int) ([]*models.Snippet, error) {
+	switch orgID {
+	case 1:
+		return []*models.Snippet{mockOrgSnippet}, nil
+	default:
+		return []*models.Snippet{}, nil
+	}
+}
+
+func (m *SnippetModel) Scheduled(userID int) ([]*models.Snippet, error) {
+	switch userID {
+	case 1:
+		return []*models.Snippet{mockScheduled}, nil
+	default:
+		return []*models.Snippet{}, nil
+	}
+}
+
+// PublishDue returns a public and an organization snippet, as if they had just been published.
+func (m *SnippetModel) PublishDue() ([]*models.Snippet, error) {
+	return []*models.Snippet{mockSnippet, mockOrgSnippet}, nil
+}
+
+func (m *SnippetModel) Fork(id, userID int) (int, error) {
+	switch id {
+	case 1, 3:
+		return 4, nil
+	default:
+		return 0, models.ErrNoRecord
+	}
+}
+
+func (m *SnippetModel) Forks(id, viewerID int) ([]*models.Snippet, error) {
 	switch id {
 	case 1:
-		return mockSnippet, nil
+		return []*models.Snippet{mockFork}, nil
+	default:
+		return []*models.Snippet{}, nil
+	}
+}
+
+func (m *SnippetModel) Update(id int, title string, files []*models.File) (int, error) {
+	switch id {
+	case 1:
+		return 3, nil
+	case 3:
+		return 2, nil
+	default:
+		return 0, models.ErrNoRecord
+	}
+}
+
+func (m *SnippetModel) Revision(id, number int) (*models.Revision, error) {
+	switch {
+	case id == 1 && number == 1:
+		return mockRevision, nil
 	default:
 		return nil, models.ErrNoRecord
 	}
 }
 
+func (m *SnippetModel) FindRevision(id, number int) (*models.Revision, error) {
+	rev, err := m.Revision(id, number)
+	if err != nil {
+		return nil, err
+	}
+
+	found := *rev
+	found.Files = nil
+	return &found, nil
+}
+
+func (m *SnippetModel) EachFile(snippetID, revision int, fn func(*models.File) error) error {
+	var files []*models.File
+	switch {
+	case snippetID == 1 && revision == 1:
+		files = mockRevision.Files
+	case snippetID == 1 && revision == 2:
+		files = mockSnippet.Files
+	case snippetID == 3 && revision == 1:
+		files = mockOrgSnippet.Files
+	case snippetID == 4 && revision == 1:
+		files = mockFork.Files
+	case snippetID == 5 && revision == 1:
+		files = mockScheduled.Files
+	}
+
+	for _, f := range files {
+		err := fn(f)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *SnippetModel) Revisions(id int) ([]*models.Revision, error) {
+	switch id {
+	case 1:
+		return []*models.Revision{mockRevision}, nil
+	default:
+		return []*models.Revision{}, nil
+	}
+}
+
 func (m *SnippetModel) Latest() ([]*models.Snippet, error) {
 	return []*models.Snippet{mockSnippet}, nil
 }
+
+func (m *SnippetModel) Delete(id int) error {
+	switch id {
+	case 1:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+
+func (m *SnippetModel) DeleteExpired() (int, error) {
+	return 0, nil
+}
+
+func (m *SnippetModel) DeleteUnusedContents() (int, error) {
+	return 0, nil
+}
@@ -0,0 +1,29 @@
+package mock
+
+import (
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+)
+
+// Alice (ID 1) starred the snippet 1.
+type StarModel struct{}
+
+func (m *StarModel) Star(userID, snippetID int) error {
+	return nil
+}
+
+func (m *StarModel) Unstar(userID, snippetID int) error {
+	return nil
+}
+
+func (m *StarModel) IsStarred(userID, snippetID int) (bool, error) {
+	return userID == 1 && snippetID == 1, nil
+}
+
+func (m *StarModel) Starred(userID int) ([]*models.Snippet, error) {
+	switch userID {
+	case 1:
+		return []*models.Snippet{mockSnippet}, nil
+	default:
+		return []*models.Snippet{}, nil
+	}
+}
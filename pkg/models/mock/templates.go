@@ -0,0 +1,70 @@
+package mock
+
+import (
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"time"
+)
+
+// Alice (ID 1) has a personal template, and saved a template for the organization 1.
+var mockTemplate = &models.SnippetTemplate{
+	ID:      1,
+	UserID:  1,
+	Name:    "Incident report",
+	Title:   "Incident of {{date}}",
+	Expires: "7",
+	Created: time.Now(),
+	Files: []*models.File{
+		{Position: 1, Name: "report.md", Language: "markdown", Content: "# Incident of {{date}}\n\nReported by {{user}}."},
+	},
+}
+
+var mockOrgTemplate = &models.SnippetTemplate{
+	ID:      2,
+	UserID:  1,
+	OrgID:   1,
+	OrgName: "Acme",
+	Name:    "SQL query",
+	Title:   "Query",
+	Expires: "365",
+	Created: time.Now(),
+	Files: []*models.File{
+		{Position: 1, Name: "query.sql", Language: "sql", Content: "SELECT 1;"},
+		{Position: 2, Name: "schema.png", Content: "\x89PNG\r\n\x1a\n", Binary: true},
+	},
+}
+
+type SnippetTemplateModel struct{}
+
+func (m *SnippetTemplateModel) Insert(userID, orgID int, name, title string, files []*models.File,
+	expires string) (int, error) {
+	return 3, nil
+}
+
+func (m *SnippetTemplateModel) Get(id, userID int) (*models.SnippetTemplate, error) {
+	switch {
+	case id == 1 && userID == 1:
+		return mockTemplate, nil
+	case id == 2 && userID == 1:
+		return mockOrgTemplate, nil
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+
+func (m *SnippetTemplateModel) ForUser(userID int) ([]*models.SnippetTemplate, error) {
+	switch userID {
+	case 1:
+		return []*models.SnippetTemplate{mockTemplate, mockOrgTemplate}, nil
+	default:
+		return []*models.SnippetTemplate{}, nil
+	}
+}
+
+func (m *SnippetTemplateModel) Delete(id int) error {
+	switch id {
+	case 1, 2:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
@@ -11,23 +11,34 @@ var mockUser = &models.User{
 	Email:   "alice@example.com",
 	Created: time.Now(),
 	Active:  true,
+	IsAdmin: true,
+}
+
+var mockOtherUser = &models.User{
+	ID:      2,
+	Name:    "Bob",
+	Email:   "bob@example.com",
+	Created: time.Now(),
+	Active:  true,
 }
 
 type UserModel struct{}
 
-func (m *UserModel) Insert(name, email, password string) error {
+func (m *UserModel) Insert(name, email, password string) (int, error) {
 	switch email {
 	case "dupe@example.com":
-		return models.ErrDuplicateEmail
+		return 0, models.ErrDuplicateEmail
 	default:
-		return nil
+		return 2, nil
 	}
 }
 
 func (m *UserModel) Authenticate(email, password string) (int, error) {
 	switch email {
-	case "alice@example.com":
+	case "alice@example.com", "locked@example.com":
 		return 1, nil
+	case "bob@example.com":
+		return 2, nil
 	default:
 		return 0, models.ErrInvalidCredentials
 	}
@@ -37,7 +48,53 @@ func (m *UserModel) Get(id int) (*models.User, error) {
 	switch id {
 	case 1:
 		return mockUser, nil
+	case 2:
+		return mockOtherUser, nil
 	default:
 		return nil, models.ErrNoRecord
 	}
 }
+
+func (m *UserModel) Search(query string) ([]*models.User, error) {
+	return []*models.User{mockUser, mockOtherUser}, nil
+}
+
+func (m *UserModel) SetActive(id int, active bool) error {
+	switch id {
+	case 1, 2:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+
+func (m *UserModel) GetByEmail(email string) (*models.User, error) {
+	switch email {
+	case "alice@example.com":
+		return mockUser, nil
+	case "bob@example.com":
+		return mockOtherUser, nil
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
+
+func (m *UserModel) Provision(name, email string) (int, error) {
+	switch email {
+	case "dupe@example.com":
+		return 0, models.ErrDuplicateEmail
+	default:
+		return 2, nil
+	}
+}
+
+func (m *UserModel) ChangePassword(id int, currentPassword, newPassword string) error {
+	switch {
+	case id != 1 && id != 2:
+		return models.ErrNoRecord
+	case currentPassword != "validPa$$word":
+		return models.ErrInvalidCredentials
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,34 @@
+package mock
+
+import (
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"time"
+)
+
+// The snippet 1 was viewed 3 times today, twice coming from news.example. Recorded counts are kept in Recorded.
+type ViewModel struct {
+	Recorded []*models.ViewCount
+}
+
+func (m *ViewModel) Record(counts []*models.ViewCount) error {
+	m.Recorded = append(m.Recorded, counts...)
+	return nil
+}
+
+func (m *ViewModel) Daily(snippetID int, since time.Time) ([]*models.DailyViews, error) {
+	if snippetID != 1 {
+		return []*models.DailyViews{}, nil
+	}
+
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	return []*models.DailyViews{{Day: today, Views: 3}}, nil
+}
+
+func (m *ViewModel) Referrers(snippetID int, since time.Time, limit int) ([]*models.Referrer, error) {
+	if snippetID != 1 {
+		return []*models.Referrer{}, nil
+	}
+
+	return []*models.Referrer{{Host: "news.example", Views: 2}, {Host: "", Views: 1}}, nil
+}
@@ -9,14 +9,67 @@ var (
 	ErrNoRecord           = errors.New("models: no matching record found")
 	ErrInvalidCredentials = errors.New("models: invalid credentials")
 	ErrDuplicateEmail     = errors.New("models: duplicate email")
+	ErrDuplicateMember    = errors.New("models: already a member or invited")
 )
 
+// Snippet is a set of files shared by a user. UserID is zero for snippets created before snippets had authors.
+// OrgID is zero for public snippets, otherwise only the members of that organization can see the snippet.
+// Stars is the number of users who starred the snippet. ForkedFrom is the ID of the snippet this one is a copy
+// of, zero if it isn't a fork. Revision is the number of the current revision of the content, starting at 1 and
+// increased every time the snippet is edited, and Updated is when it was last edited, zero if it never was.
+// PublishAt is when a scheduled snippet is published, zero once it is: until then only its author can see it.
+// Files holds the files of the current revision. It is only set when a single snippet is fetched.
 type Snippet struct {
+	ID         int
+	UserID     int
+	OrgID      int
+	Title      string
+	Created    time.Time
+	Updated    time.Time
+	Expires    time.Time
+	PublishAt  time.Time
+	Stars      int
+	ForkedFrom int
+	Revision   int
+	Files      []*File
+}
+
+// File is a named file of a snippet. Position is the place of the file in the snippet, starting at 1.
+// Language is the language the content is written in, empty for plain text. Binary files, like images, hold
+// their raw bytes in Content rather than UTF-8 text.
+type File struct {
+	Position int
+	Name     string
+	Language string
+	Content  string
+	Binary   bool
+}
+
+// SnippetTemplate is a skeleton new snippets can start from, saved from a snippet. OrgID is zero for the
+// personal templates of the user UserID, otherwise every member of that organization can use it, and OrgName is
+// its name. Expires is the lifetime of the snippets created from it, in days. The title and the content of the
+// files can hold placeholders, ex: {{date}}, expanded when a snippet is created from the template.
+// Files is only set when a single template is fetched.
+type SnippetTemplate struct {
 	ID      int
+	UserID  int
+	OrgID   int
+	OrgName string
+	Name    string
 	Title   string
-	Content string
+	Expires string
 	Created time.Time
-	Expires time.Time
+	Files   []*File
+}
+
+// Revision is an earlier version of the title and files of a snippet, replaced when the snippet was edited.
+// Created is when that version was written. Files is only set when a single revision is fetched.
+type Revision struct {
+	SnippetID int
+	Number    int
+	Title     string
+	Created   time.Time
+	Files     []*File
 }
 
 type User struct {
@@ -26,4 +79,134 @@ type User struct {
 	HashedPassword []byte
 	Created        time.Time
 	Active         bool
+	IsAdmin        bool
+}
+
+// LoginFailures summarises the failed login attempts recorded against an email address or IP address.
+type LoginFailures struct {
+	Count int
+	Last  time.Time
+}
+
+// Session is a server-side login session. The client only holds an opaque token identifying it.
+type Session struct {
+	ID        int
+	UserID    int
+	IP        string
+	UserAgent string
+	Created   time.Time
+	LastSeen  time.Time
+	Expires   time.Time
 }
+
+// AuditEvent is an entry of the audit log. UserID is zero when the event wasn't triggered by a logged in user.
+type AuditEvent struct {
+	ID      int       `json:"id"`
+	UserID  int       `json:"user_id,omitempty"`
+	Event   string    `json:"event"`
+	Details string    `json:"details"`
+	IP      string    `json:"ip"`
+	Created time.Time `json:"created"`
+}
+
+// AuditFilter restricts the audit events returned by a query. Zero fields don't filter anything.
+type AuditFilter struct {
+	UserID int
+	Event  string
+	From   time.Time
+	To     time.Time
+}
+
+// Comment is a comment on a snippet. ParentID is the ID of the comment it replies to, zero for top-level
+// comments. Deleted comments keep their place in the thread but lose their content.
+// Revision is the revision of the snippet the comment was written on. Lines is the range of lines of a file of
+// that revision the comment is about, zero for comments on the whole snippet.
+// Depth is the nesting level of the comment in its thread, set when comments are fetched threaded.
+type Comment struct {
+	ID        int
+	SnippetID int
+	UserID    int
+	UserName  string
+	ParentID  int
+	Revision  int
+	Lines     LineRange
+	Content   string
+	Created   time.Time
+	Updated   time.Time
+	Deleted   bool
+	Depth     int
+}
+
+// LineRange is a range of lines of the file at position File of a snippet, from Start to End included. Lines are
+// numbered from 1, the zero value is an empty range.
+type LineRange struct {
+	File  int
+	Start int
+	End   int
+}
+
+// Roles of the members of an organization. Owners manage the membership, members only share snippets.
+const (
+	RoleOwner  = "owner"
+	RoleMember = "member"
+)
+
+// Organization is a group of users sharing snippets. Role is the role of the user the organization was fetched
+// for.
+type Organization struct {
+	ID      int
+	Name    string
+	Created time.Time
+	Role    string
+}
+
+// Membership is a user belonging to an organization.
+type Membership struct {
+	OrgID   int
+	UserID  int
+	Name    string
+	Email   string
+	Role    string
+	Created time.Time
+}
+
+// Invitation is a pending invitation to join an organization, sent to an email address.
+type Invitation struct {
+	ID      int
+	OrgID   int
+	OrgName string
+	Email   string
+	Role    string
+	Created time.Time
+}
+
+// ViewCount is a number of views of a snippet on a day, coming from the site of Referrer: the host name of the
+// page linking to the snippet, empty when unknown.
+type ViewCount struct {
+	SnippetID int
+	Day       time.Time
+	Referrer  string
+	Views     int
+}
+
+// DailyViews is the number of views of a snippet on a day.
+type DailyViews struct {
+	Day   time.Time
+	Views int
+}
+
+// Referrer is the number of views of a snippet coming from a site, Host is empty for direct visits and "other" for
+// the sites past the number counted separately.
+type Referrer struct {
+	Host  string
+	Views int
+}
+
+// Rankings of the public snippets, by their views and stars: the trending ranking favors the recent ones, the
+// others count them during the last week, the last month or ever.
+const (
+	RankingTrending = "trending"
+	RankingWeek     = "week"
+	RankingMonth    = "month"
+	RankingAll      = "all"
+)
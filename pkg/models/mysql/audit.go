@@ -0,0 +1,92 @@
+package mysql
+
+import (
+	"database/sql"
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"strings"
+)
+
+// AuditLogModel gives access to the audit log. The log is append-only: entries can be inserted and queried but
+// never updated or deleted, which the database enforces with triggers.
+type AuditLogModel struct {
+	DB *sql.DB
+}
+
+// Insert appends an event to the audit log. A zero userID is stored as NULL.
+func (m *AuditLogModel) Insert(userID int, event, ip, details string) error {
+	stmt := `INSERT INTO audit_log (user_id, event, details, ip, created)
+	VALUES(NULLIF(?, 0), ?, ?, ?, UTC_TIMESTAMP())`
+
+	_, err := m.DB.Exec(stmt, userID, event, details, ip)
+	return err
+}
+
+// Search returns the most recent events matching a filter, the newest first. At most limit events are returned.
+func (m *AuditLogModel) Search(filter models.AuditFilter, limit int) ([]*models.AuditEvent, error) {
+	events := []*models.AuditEvent{}
+
+	err := m.query(filter, limit, func(e *models.AuditEvent) error {
+		events = append(events, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// Each calls fn for every event matching a filter, the newest first, without holding them all in memory.
+// It stops at the first error returned by fn.
+func (m *AuditLogModel) Each(filter models.AuditFilter, fn func(*models.AuditEvent) error) error {
+	return m.query(filter, 0, fn)
+}
+
+func (m *AuditLogModel) query(filter models.AuditFilter, limit int, fn func(*models.AuditEvent) error) error {
+	// Build the WHERE clause from the fields of the filter which are set.
+	conditions := []string{"TRUE"}
+	args := []interface{}{}
+	if filter.UserID != 0 {
+		conditions = append(conditions, "user_id = ?")
+		args = append(args, filter.UserID)
+	}
+	if filter.Event != "" {
+		conditions = append(conditions, "event = ?")
+		args = append(args, filter.Event)
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "created >= ?")
+		args = append(args, filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "created < ?")
+		args = append(args, filter.To.UTC())
+	}
+
+	stmt := `SELECT id, COALESCE(user_id, 0), event, details, ip, created FROM audit_log
+	WHERE ` + strings.Join(conditions, " AND ") + ` ORDER BY created DESC, id DESC`
+	if limit > 0 {
+		stmt += ` LIMIT ?`
+		args = append(args, limit)
+	}
+
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e := &models.AuditEvent{}
+		err := rows.Scan(&e.ID, &e.UserID, &e.Event, &e.Details, &e.IP, &e.Created)
+		if err != nil {
+			return err
+		}
+
+		if err = fn(e); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
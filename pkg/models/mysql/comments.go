@@ -0,0 +1,181 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+)
+
+// CommentModel manages the threaded comments on snippets.
+type CommentModel struct {
+	DB *sql.DB
+}
+
+// maxCommentDepth is the deepest nesting level reported for a comment. Deeper replies are shown at this level
+// so long discussions don't drift off the page.
+const maxCommentDepth = 5
+
+const commentColumns = `c.id, c.snippet_id, c.user_id, u.name, COALESCE(c.parent_id, 0), c.revision,
+COALESCE(c.line_file, 0), COALESCE(c.line_start, 0), COALESCE(c.line_end, 0), c.content, c.created, c.updated,
+c.deleted`
+
+func scanComment(row scanner) (*models.Comment, error) {
+	c := &models.Comment{}
+	var updated sql.NullTime
+	err := row.Scan(&c.ID, &c.SnippetID, &c.UserID, &c.UserName, &c.ParentID, &c.Revision, &c.Lines.File,
+		&c.Lines.Start, &c.Lines.End, &c.Content, &c.Created, &updated, &c.Deleted)
+	if err != nil {
+		return nil, err
+	}
+	c.Updated = updated.Time
+
+	return c, nil
+}
+
+// Insert adds a comment of a user on a revision of a snippet and returns its ID. parentID is the ID of the comment
+// it replies to, 0 for a top-level comment. lines is the range of lines of a file of the revision the comment is
+// about, the zero LineRange for a comment on the whole snippet.
+// The caller is responsible for checking the user can see the snippet, the parent is a comment on it and the
+// lines exist in the revision.
+func (m *CommentModel) Insert(snippetID, revision, userID, parentID int, lines models.LineRange,
+	content string) (int, error) {
+	stmt := `INSERT INTO comments (snippet_id, revision, user_id, parent_id, line_file, line_start, line_end, content,
+	created) VALUES(?, ?, ?, ?, ?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	result, err := m.DB.Exec(stmt, snippetID, revision, userID, nullID(parentID), nullID(lines.File),
+		nullID(lines.Start), nullID(lines.End), content)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// Get returns a comment. Deleted comments are returned too, with an empty content.
+func (m *CommentModel) Get(id int) (*models.Comment, error) {
+	stmt := `SELECT ` + commentColumns + ` FROM comments c JOIN users u ON u.id = c.user_id WHERE c.id = ?`
+
+	c, err := scanComment(m.DB.QueryRow(stmt, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNoRecord
+		} else {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// ForSnippet returns the comments on a snippet threaded: every comment is followed by its replies, and their
+// Depth is set.
+func (m *CommentModel) ForSnippet(snippetID int) ([]*models.Comment, error) {
+	stmt := `SELECT ` + commentColumns + ` FROM comments c JOIN users u ON u.id = c.user_id
+	WHERE c.snippet_id = ? ORDER BY c.created, c.id`
+
+	rows, err := m.DB.Query(stmt, snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []*models.Comment{}
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		comments = append(comments, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return thread(comments), nil
+}
+
+// thread orders comments sorted by creation date so that every comment is followed by its replies, and sets
+// their Depth. Replies to a comment which isn't in the list are treated as top-level comments.
+func thread(comments []*models.Comment) []*models.Comment {
+	ids := map[int]bool{}
+	for _, c := range comments {
+		ids[c.ID] = true
+	}
+
+	var roots []*models.Comment
+	replies := map[int][]*models.Comment{}
+	for _, c := range comments {
+		if c.ParentID == 0 || !ids[c.ParentID] {
+			roots = append(roots, c)
+		} else {
+			replies[c.ParentID] = append(replies[c.ParentID], c)
+		}
+	}
+
+	threaded := make([]*models.Comment, 0, len(comments))
+	var walk func(c *models.Comment, depth int)
+	walk = func(c *models.Comment, depth int) {
+		if depth > maxCommentDepth {
+			depth = maxCommentDepth
+		}
+		c.Depth = depth
+		threaded = append(threaded, c)
+
+		for _, reply := range replies[c.ID] {
+			walk(reply, depth+1)
+		}
+	}
+	for _, c := range roots {
+		walk(c, 0)
+	}
+
+	return threaded
+}
+
+// Update replaces the content of a comment. Deleted comments can't be updated, they return ErrNoRecord.
+func (m *CommentModel) Update(id int, content string) error {
+	stmt := `UPDATE comments SET content = ?, updated = UTC_TIMESTAMP() WHERE id = ? AND deleted = FALSE`
+
+	result, err := m.DB.Exec(stmt, content, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrNoRecord
+	}
+
+	return nil
+}
+
+// Delete deletes a comment. The comment keeps its place so the replies to it still make sense, but its content
+// is erased.
+func (m *CommentModel) Delete(id int) error {
+	stmt := `UPDATE comments SET content = '', deleted = TRUE WHERE id = ? AND deleted = FALSE`
+
+	result, err := m.DB.Exec(stmt, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrNoRecord
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package mysql
+
+import (
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"reflect"
+	"testing"
+)
+
+func TestThread(t *testing.T) {
+	// Comments sorted by creation date: 1 <- 3 <- 4, 2 <- 5, and 6 replying to a comment which isn't listed.
+	comments := []*models.Comment{
+		{ID: 1},
+		{ID: 2},
+		{ID: 3, ParentID: 1},
+		{ID: 4, ParentID: 3},
+		{ID: 5, ParentID: 2},
+		{ID: 6, ParentID: 99},
+	}
+
+	var gotIDs, gotDepths []int
+	for _, c := range thread(comments) {
+		gotIDs = append(gotIDs, c.ID)
+		gotDepths = append(gotDepths, c.Depth)
+	}
+
+	wantIDs := []int{1, 3, 4, 2, 5, 6}
+	wantDepths := []int{0, 1, 2, 0, 1, 0}
+	if !reflect.DeepEqual(gotIDs, wantIDs) {
+		t.Errorf("want order %v; got %v", wantIDs, gotIDs)
+	}
+	if !reflect.DeepEqual(gotDepths, wantDepths) {
+		t.Errorf("want depths %v; got %v", wantDepths, gotDepths)
+	}
+}
+
+func TestThreadMaxDepth(t *testing.T) {
+	var comments []*models.Comment
+	for i := 1; i <= maxCommentDepth+3; i++ {
+		comments = append(comments, &models.Comment{ID: i, ParentID: i - 1})
+	}
+
+	threaded := thread(comments)
+	if got := threaded[len(threaded)-1].Depth; got != maxCommentDepth {
+		t.Errorf("want depth %d; got %d", maxCommentDepth, got)
+	}
+}
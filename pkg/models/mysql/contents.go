@@ -0,0 +1,262 @@
+package mysql
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"github.com/luca0x333/go-snippetbox/pkg/storage"
+)
+
+// errNoBlobStore is returned when a content is in the blob store but none is configured.
+var errNoBlobStore = errors.New("mysql: content stored in a blob store, but there is none")
+
+// contentHash returns the key of a content in the contents table: its SHA-256 hash, hex encoded. It matches
+// SHA2(content, 256) in MySQL.
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// contentKey returns the key of the blob holding a content in the blob store.
+func contentKey(hash string) string {
+	return "contents/" + hash
+}
+
+// contentStore stores the contents of the files of snippets and templates, which refer to them by hash.
+// Contents larger than blobThreshold go to the blob store, if there is one.
+type contentStore struct {
+	db            *sql.DB
+	blobs         storage.BlobStore
+	blobThreshold int
+}
+
+// contents returns the store of the contents of the files of snippets.
+func (m *SnippetModel) contents() *contentStore {
+	return &contentStore{db: m.DB, blobs: m.Blobs, blobThreshold: m.BlobThreshold}
+}
+
+// insert stores a content unless the same content is already stored, and returns its hash.
+// Storing it locks its row until the transaction ends, so DeleteUnusedContents can't delete it, or its blob,
+// before the file referring to it is inserted.
+func (cs *contentStore) insert(tx *sql.Tx, content string) (string, error) {
+	hash := contentHash(content)
+
+	var exists bool
+	err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM contents WHERE hash = ?)`, hash).Scan(&exists)
+	if err != nil {
+		return "", err
+	}
+
+	// A content already stored is kept as it is. Should it be deleted in the meantime, it is stored again in the
+	// contents table, which is always safe.
+	var key sql.NullString
+	data := content
+	if !exists && cs.blobs != nil && len(content) > cs.blobThreshold {
+		key = sql.NullString{String: contentKey(hash), Valid: true}
+		content = ""
+	}
+
+	stmt := `INSERT INTO contents (hash, content, blob_key) VALUES(?, ?, ?) ON DUPLICATE KEY UPDATE hash = hash`
+	_, err = tx.Exec(stmt, hash, content, key)
+	if err != nil {
+		return "", err
+	}
+
+	// The blob is stored once the row is locked: DeleteUnusedContents checks the row before deleting a blob.
+	if key.Valid {
+		err = cs.blobs.Put(key.String, []byte(data))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return hash, nil
+}
+
+// insertFile stores the content of a file with insert, and returns its hash.
+func (cs *contentStore) insertFile(tx *sql.Tx, f *models.File) (string, error) {
+	// The content column holds text, binary files are stored base64 encoded.
+	content := f.Content
+	if f.Binary {
+		content = base64.StdEncoding.EncodeToString([]byte(f.Content))
+	}
+
+	return cs.insert(tx, content)
+}
+
+// queryFiles returns the files selected by a query, with their content whether it is stored in the contents
+// table or in the blob store. The query must select the position, name and language of the files, the content
+// and blob_key of their content, then whether they are binary.
+func (cs *contentStore) queryFiles(stmt string, args ...interface{}) ([]*models.File, error) {
+	rows, err := cs.db.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := []*models.File{}
+	var keys []sql.NullString
+	for rows.Next() {
+		f := &models.File{}
+		var key sql.NullString
+		err := rows.Scan(&f.Position, &f.Name, &f.Language, &f.Content, &key, &f.Binary)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, f)
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// The blobs are fetched once the rows are read, so the connection isn't held while waiting for the store.
+	for i, f := range files {
+		if keys[i].Valid {
+			f.Content, err = cs.getBlob(keys[i].String)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if f.Binary {
+			content, err := base64.StdEncoding.DecodeString(f.Content)
+			if err != nil {
+				return nil, err
+			}
+			f.Content = string(content)
+		}
+	}
+
+	return files, nil
+}
+
+// read returns a content, whether it is stored in the contents table or in the blob store.
+func (cs *contentStore) read(hash string) (string, error) {
+	var content string
+	var key sql.NullString
+	err := cs.db.QueryRow(`SELECT content, blob_key FROM contents WHERE hash = ?`, hash).Scan(&content, &key)
+	if err != nil {
+		return "", err
+	}
+
+	if key.Valid {
+		return cs.getBlob(key.String)
+	}
+
+	return content, nil
+}
+
+// getBlob returns a content stored in the blob store.
+func (cs *contentStore) getBlob(key string) (string, error) {
+	if cs.blobs == nil {
+		return "", errNoBlobStore
+	}
+
+	data, err := cs.blobs.Get(key)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// DeleteUnusedContents deletes the contents no file of a snippet or template refers to anymore, left behind by
+// deleted snippets and templates, with their blobs, and returns how many were deleted.
+// The blobs are only deleted once the rows are, so a failure never leaves a row without its blob, only blobs
+// without rows.
+func (m *SnippetModel) DeleteUnusedContents() (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt := `SELECT hash, blob_key FROM contents
+	WHERE NOT EXISTS (SELECT 1 FROM snippet_files f WHERE f.content_hash = contents.hash)
+	AND NOT EXISTS (SELECT 1 FROM snippet_template_files f WHERE f.content_hash = contents.hash) FOR UPDATE`
+
+	rows, err := tx.Query(stmt)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var hashes []string
+	blobs := make(map[string]string)
+	for rows.Next() {
+		var hash string
+		var key sql.NullString
+		err := rows.Scan(&hash, &key)
+		if err != nil {
+			return 0, err
+		}
+
+		hashes = append(hashes, hash)
+		if key.Valid {
+			blobs[hash] = key.String
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	rows.Close()
+
+	if len(blobs) > 0 && m.Blobs == nil {
+		return 0, errNoBlobStore
+	}
+
+	for _, hash := range hashes {
+		_, err = tx.Exec(`DELETE FROM contents WHERE hash = ?`, hash)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	for hash, key := range blobs {
+		err = m.deleteBlob(hash, key)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(hashes), nil
+}
+
+// deleteBlob deletes the blob of a content deleted from the contents table, unless the content has been stored
+// again since. The locking read waits for a snippet storing the same content, and stops others from storing it
+// until the blob is deleted.
+func (m *SnippetModel) deleteBlob(hash, key string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var stored string
+	err = tx.QueryRow(`SELECT hash FROM contents WHERE hash = ? FOR UPDATE`, hash).Scan(&stored)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	err = m.Blobs.Delete(key)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,261 @@
+package mysql
+
+import (
+	"errors"
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"github.com/luca0x333/go-snippetbox/pkg/storage"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestContentHash(t *testing.T) {
+	// The hash of the empty string, as returned by SELECT SHA2('', 256).
+	want := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	if got := contentHash(""); got != want {
+		t.Errorf("want %q; got %q", want, got)
+	}
+}
+
+func TestSnippetModelContents(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	snippets := SnippetModel{DB: db}
+
+	countContents := func() int {
+		var n int
+		err := db.QueryRow(`SELECT COUNT(*) FROM contents`).Scan(&n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	// The same content is stored once, whichever snippet or file it belongs to.
+	first, err := snippets.Insert(1, 0, "First", textFiles("port: 4000", "port: 4000"), "7", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := snippets.Insert(1, 0, "Second", textFiles("port: 4000", "debug: true"), "7", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := countContents()
+
+	s, err := snippets.Get(second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Files) != 2 || s.Files[0].Content != "port: 4000" || s.Files[1].Content != "debug: true" {
+		t.Errorf("want the contents of the second snippet; got %d files", len(s.Files))
+	}
+
+	// Contents still used by a snippet are kept.
+	err = snippets.Delete(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := snippets.DeleteUnusedContents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 || countContents() != before {
+		t.Errorf("want no content deleted; got %d", n)
+	}
+
+	err = snippets.Delete(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err = snippets.DeleteUnusedContents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || countContents() != before-2 {
+		t.Errorf("want the 2 contents of the snippets deleted; got %d", n)
+	}
+}
+
+func TestSnippetModelTemplateContents(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	snippets := SnippetModel{DB: db}
+	templates := SnippetTemplateModel{DB: db}
+
+	// A template saved from a snippet shares its contents.
+	id, err := snippets.Insert(1, 0, "Config", textFiles("port: 4000"), "7", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	templateID, err := templates.Insert(1, 0, "Config", "Config", textFiles("port: 4000"), "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Contents still used by a template are kept once the snippet is purged.
+	err = snippets.Delete(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := snippets.DeleteUnusedContents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("want no content deleted; got %d", n)
+	}
+
+	tmpl, err := templates.Get(templateID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tmpl.Files) != 1 || tmpl.Files[0].Content != "port: 4000" {
+		t.Errorf("want the content of the template; got %v", tmpl.Files)
+	}
+
+	err = templates.Delete(templateID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err = snippets.DeleteUnusedContents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("want the content of the template deleted; got %d", n)
+	}
+}
+
+func TestSnippetModelBlobs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	dir, err := ioutil.TempDir("", "blobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	blobs := &storage.Local{Dir: dir}
+	snippets := SnippetModel{DB: db, Blobs: blobs, BlobThreshold: 16}
+
+	large := strings.Repeat("port: 4000\n", 10)
+	id, err := snippets.Insert(1, 0, "Config", textFiles("small", large), "7", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the large content is in the blob store.
+	key := contentKey(contentHash(large))
+	if _, err := blobs.Get(key); err != nil {
+		t.Errorf("want the large content in the blob store; got %v", err)
+	}
+	if _, err := blobs.Get(contentKey(contentHash("small"))); err != storage.ErrNotFound {
+		t.Errorf("want the small content in the database; got %v", err)
+	}
+
+	s, err := snippets.Get(id, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Files) != 2 || s.Files[0].Content != "small" || s.Files[1].Content != large {
+		t.Errorf("want both contents back; got %d files", len(s.Files))
+	}
+
+	// EachFile reads them one at a time, from either store.
+	var contents []string
+	err = snippets.EachFile(id, s.Revision, func(f *models.File) error {
+		contents = append(contents, f.Content)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contents) != 2 || contents[0] != "small" || contents[1] != large {
+		t.Errorf("want both contents read in order; got %d contents", len(contents))
+	}
+
+	// Purging the snippet deletes its blobs.
+	err = snippets.Delete(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = snippets.DeleteUnusedContents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := blobs.Get(key); err != storage.ErrNotFound {
+		t.Errorf("want the blob deleted; got %v", err)
+	}
+}
+
+// failingDeletes is a blob store whose deletions fail.
+type failingDeletes struct {
+	storage.BlobStore
+}
+
+func (failingDeletes) Delete(key string) error {
+	return errors.New("storage: unavailable")
+}
+
+func TestSnippetModelDeleteUnusedContentsFailure(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	dir, err := ioutil.TempDir("", "blobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	blobs := &storage.Local{Dir: dir}
+	snippets := SnippetModel{DB: db, Blobs: failingDeletes{blobs}, BlobThreshold: 16}
+
+	large := strings.Repeat("port: 4000\n", 10)
+	id, err := snippets.Insert(1, 0, "Config", textFiles(large), "7", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = snippets.Delete(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = snippets.DeleteUnusedContents()
+	if err == nil {
+		t.Fatal("want an error deleting the blob")
+	}
+
+	// The row is deleted before the blob, so no content is left without its blob: only the blob is left.
+	var n int
+	err = db.QueryRow(`SELECT COUNT(*) FROM contents WHERE hash = ?`, contentHash(large)).Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("want the content deleted; got %d rows", n)
+	}
+	if _, err := blobs.Get(contentKey(contentHash(large))); err != nil {
+		t.Errorf("want the blob left; got %v", err)
+	}
+}
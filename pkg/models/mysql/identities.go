@@ -0,0 +1,37 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+)
+
+// IdentityModel links users to their accounts at external identity providers.
+type IdentityModel struct {
+	DB *sql.DB
+}
+
+// Insert links the account identified by an issuer and a subject to a user.
+func (m *IdentityModel) Insert(issuer, subject string, userID int) error {
+	stmt := `INSERT INTO identities (user_id, issuer, subject, created) VALUES(?, ?, ?, UTC_TIMESTAMP())`
+
+	_, err := m.DB.Exec(stmt, userID, issuer, subject)
+	return err
+}
+
+// Get returns the ID of the user linked to the account identified by an issuer and a subject.
+func (m *IdentityModel) Get(issuer, subject string) (int, error) {
+	stmt := `SELECT user_id FROM identities WHERE issuer = ? AND subject = ?`
+
+	var userID int
+	err := m.DB.QueryRow(stmt, issuer, subject).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, models.ErrNoRecord
+		} else {
+			return 0, err
+		}
+	}
+
+	return userID, nil
+}
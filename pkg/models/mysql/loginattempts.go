@@ -0,0 +1,84 @@
+package mysql
+
+import (
+	"database/sql"
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"time"
+)
+
+type LoginAttemptModel struct {
+	DB *sql.DB
+}
+
+// Insert records a login attempt for an email address coming from an IP address, and returns its ID.
+// Attempts are recorded before the credentials are verified and count as failures until they are cleared,
+// so concurrent attempts count against each other.
+func (m *LoginAttemptModel) Insert(email, ip string) (int, error) {
+	stmt := `INSERT INTO login_attempts (email, ip, created) VALUES(?, ?, UTC_TIMESTAMP())`
+
+	result, err := m.DB.Exec(stmt, email, ip)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// Clear marks every attempt recorded for an email address as cleared, so they no longer count towards a
+// lockout. It is called after a successful login and when an admin unlocks an account.
+// The rows are kept for the record.
+func (m *LoginAttemptModel) Clear(email string) error {
+	stmt := `UPDATE login_attempts SET cleared = TRUE WHERE email = ? AND cleared = FALSE`
+
+	_, err := m.DB.Exec(stmt, email)
+	return err
+}
+
+// ClearIP marks every attempt coming from an IP address as cleared for the backoff of that address, after a
+// successful login from it: a shared address isn't slowed down for everyone by a single client. The attempts
+// still count for the email addresses they targeted.
+func (m *LoginAttemptModel) ClearIP(ip string) error {
+	stmt := `UPDATE login_attempts SET ip_cleared = TRUE WHERE ip = ? AND ip_cleared = FALSE`
+
+	_, err := m.DB.Exec(stmt, ip)
+	return err
+}
+
+// EmailFailures returns the uncleared attempts recorded for an email address since a point in time, before the
+// attempt identified by beforeID.
+func (m *LoginAttemptModel) EmailFailures(email string, beforeID int, since time.Time) (*models.LoginFailures,
+	error) {
+	stmt := `SELECT COUNT(*), MAX(created) FROM login_attempts
+	WHERE email = ? AND cleared = FALSE AND id < ? AND created > ?`
+
+	return m.failures(stmt, email, beforeID, since)
+}
+
+// IPFailures returns the uncleared attempts coming from an IP address since a point in time, before the attempt
+// identified by beforeID, whatever the email address they targeted.
+func (m *LoginAttemptModel) IPFailures(ip string, beforeID int, since time.Time) (*models.LoginFailures, error) {
+	stmt := `SELECT COUNT(*), MAX(created) FROM login_attempts
+	WHERE ip = ? AND ip_cleared = FALSE AND id < ? AND created > ?`
+
+	return m.failures(stmt, ip, beforeID, since)
+}
+
+func (m *LoginAttemptModel) failures(stmt, key string, beforeID int, since time.Time) (*models.LoginFailures,
+	error) {
+	f := &models.LoginFailures{}
+
+	// MAX() returns NULL when there is no matching row.
+	var last sql.NullTime
+	err := m.DB.QueryRow(stmt, key, beforeID, since.UTC()).Scan(&f.Count, &last)
+	if err != nil {
+		return nil, err
+	}
+	f.Last = last.Time
+
+	return f, nil
+}
@@ -0,0 +1,110 @@
+package mysql
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginAttemptModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	m := LoginAttemptModel{db}
+	since := time.Now().Add(-time.Hour)
+
+	// Three concurrent attempts: each one only counts the attempts recorded before it.
+	var ids []int
+	for _, ip := range []string{"192.0.2.1", "192.0.2.1", "192.0.2.2"} {
+		id, err := m.Insert("alice@example.com", ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	for i, id := range ids {
+		f, err := m.EmailFailures("alice@example.com", id, since)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Count != i {
+			t.Errorf("want %d failures before attempt %d; got %d", i, i+1, f.Count)
+		}
+	}
+
+	next := ids[len(ids)-1] + 1
+	f, err := m.IPFailures("192.0.2.1", next, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Count != 2 || f.Last.IsZero() {
+		t.Errorf("want 2 failures from 192.0.2.1; got %+v", f)
+	}
+
+	// Attempts older than since don't count.
+	f, err = m.EmailFailures("alice@example.com", next, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Count != 0 || !f.Last.IsZero() {
+		t.Errorf("want no recent failures; got %+v", f)
+	}
+
+	// A successful login from 192.0.2.1 for bob clears the backoff of the address, but not the failures against
+	// alice.
+	id, err := m.Insert("bob@example.com", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Clear("bob@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.ClearIP("192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next = id + 1
+
+	f, err = m.IPFailures("192.0.2.1", next, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Count != 0 {
+		t.Errorf("want no failures from 192.0.2.1 after a login; got %d", f.Count)
+	}
+
+	f, err = m.EmailFailures("alice@example.com", next, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Count != 3 {
+		t.Errorf("want 3 failures against alice after a login from her address; got %d", f.Count)
+	}
+
+	// Clearing an email address, ex: when an admin unlocks the account, only clears its attempts.
+	err = m.Clear("alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err = m.EmailFailures("alice@example.com", next, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Count != 0 {
+		t.Errorf("want no failures against alice once cleared; got %d", f.Count)
+	}
+
+	f, err = m.IPFailures("192.0.2.2", next, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Count != 1 {
+		t.Errorf("want 1 failure from 192.0.2.2; got %d", f.Count)
+	}
+}
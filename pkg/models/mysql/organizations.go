@@ -0,0 +1,252 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/go-sql-driver/mysql"
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+)
+
+// OrganizationModel manages organizations, their members and the invitations to join them.
+type OrganizationModel struct {
+	DB *sql.DB
+}
+
+// Insert creates an organization owned by a user and returns its ID.
+func (m *OrganizationModel) Insert(name string, ownerID int) (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt := `INSERT INTO organizations (name, created) VALUES(?, UTC_TIMESTAMP())`
+	result, err := tx.Exec(stmt, name)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	stmt = `INSERT INTO memberships (org_id, user_id, role, created) VALUES(?, ?, ?, UTC_TIMESTAMP())`
+	_, err = tx.Exec(stmt, id, ownerID, models.RoleOwner)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), tx.Commit()
+}
+
+// Get returns an organization with the role of a user in it.
+// If the organization doesn't exist or the user isn't a member, it returns ErrNoRecord.
+func (m *OrganizationModel) Get(id, userID int) (*models.Organization, error) {
+	stmt := `SELECT o.id, o.name, o.created, m.role FROM organizations o
+	JOIN memberships m ON m.org_id = o.id WHERE o.id = ? AND m.user_id = ?`
+
+	o := &models.Organization{}
+	err := m.DB.QueryRow(stmt, id, userID).Scan(&o.ID, &o.Name, &o.Created, &o.Role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNoRecord
+		} else {
+			return nil, err
+		}
+	}
+
+	return o, nil
+}
+
+// ForUser returns the organizations a user is a member of, sorted by name.
+func (m *OrganizationModel) ForUser(userID int) ([]*models.Organization, error) {
+	stmt := `SELECT o.id, o.name, o.created, m.role FROM organizations o
+	JOIN memberships m ON m.org_id = o.id WHERE m.user_id = ? ORDER BY o.name`
+
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []*models.Organization{}
+	for rows.Next() {
+		o := &models.Organization{}
+		err := rows.Scan(&o.ID, &o.Name, &o.Created, &o.Role)
+		if err != nil {
+			return nil, err
+		}
+
+		orgs = append(orgs, o)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return orgs, nil
+}
+
+// Members returns the members of an organization, owners first.
+func (m *OrganizationModel) Members(orgID int) ([]*models.Membership, error) {
+	stmt := `SELECT m.org_id, m.user_id, u.name, u.email, m.role, m.created FROM memberships m
+	JOIN users u ON u.id = m.user_id WHERE m.org_id = ? ORDER BY m.role = ? DESC, u.name`
+
+	rows, err := m.DB.Query(stmt, orgID, models.RoleOwner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*models.Membership{}
+	for rows.Next() {
+		ms := &models.Membership{}
+		err := rows.Scan(&ms.OrgID, &ms.UserID, &ms.Name, &ms.Email, &ms.Role, &ms.Created)
+		if err != nil {
+			return nil, err
+		}
+
+		members = append(members, ms)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// Invite invites an email address to join an organization with a role, and returns the token of the invitation.
+// Whoever holds the token can accept the invitation, so it must only be sent to that address.
+// If the address already belongs to a member or has already been invited, it returns ErrDuplicateMember.
+func (m *OrganizationModel) Invite(orgID int, email, role string, invitedBy int) (string, error) {
+	var exists bool
+	stmt := `SELECT EXISTS(SELECT 1 FROM memberships m JOIN users u ON u.id = m.user_id
+	WHERE m.org_id = ? AND u.email = ?)`
+	err := m.DB.QueryRow(stmt, orgID, email).Scan(&exists)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return "", models.ErrDuplicateMember
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	stmt = `INSERT INTO invitations (org_id, email, role, token_hash, invited_by, created)
+	VALUES(?, ?, ?, ?, ?, UTC_TIMESTAMP())`
+	_, err = m.DB.Exec(stmt, orgID, email, role, hashToken(token), invitedBy)
+	if err != nil {
+		var mySQLError *mysql.MySQLError
+		if errors.As(err, &mySQLError) {
+			if mySQLError.Number == 1062 {
+				return "", models.ErrDuplicateMember
+			}
+		}
+		return "", err
+	}
+
+	return token, nil
+}
+
+// Invitation returns the pending invitation identified by a token.
+// If there is no such invitation, it returns ErrNoRecord.
+func (m *OrganizationModel) Invitation(token string) (*models.Invitation, error) {
+	stmt := `SELECT i.id, i.org_id, o.name, i.email, i.role, i.created FROM invitations i
+	JOIN organizations o ON o.id = i.org_id WHERE i.token_hash = ?`
+
+	i := &models.Invitation{}
+	err := m.DB.QueryRow(stmt, hashToken(token)).Scan(&i.ID, &i.OrgID, &i.OrgName, &i.Email, &i.Role, &i.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNoRecord
+		} else {
+			return nil, err
+		}
+	}
+
+	return i, nil
+}
+
+// AcceptInvitation makes a user a member of the organization the invitation identified by a token was sent for,
+// and returns the ID of the organization. The invitation is deleted, so a token can only be used once.
+// If there is no such invitation, it returns ErrNoRecord.
+func (m *OrganizationModel) AcceptInvitation(token string, userID int) (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id, orgID int
+	var role string
+	stmt := `SELECT id, org_id, role FROM invitations WHERE token_hash = ? FOR UPDATE`
+	err = tx.QueryRow(stmt, hashToken(token)).Scan(&id, &orgID, &role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, models.ErrNoRecord
+		} else {
+			return 0, err
+		}
+	}
+
+	// A user who joined in the meantime, for example through another invitation, keeps their role.
+	stmt = `INSERT IGNORE INTO memberships (org_id, user_id, role, created) VALUES(?, ?, ?, UTC_TIMESTAMP())`
+	_, err = tx.Exec(stmt, orgID, userID, role)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM invitations WHERE id = ?`, id)
+	if err != nil {
+		return 0, err
+	}
+
+	return orgID, tx.Commit()
+}
+
+// DeclineInvitation deletes the invitation identified by a token.
+// If there is no such invitation, it returns ErrNoRecord.
+func (m *OrganizationModel) DeclineInvitation(token string) error {
+	stmt := `DELETE FROM invitations WHERE token_hash = ?`
+
+	result, err := m.DB.Exec(stmt, hashToken(token))
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrNoRecord
+	}
+
+	return nil
+}
+
+// RemoveMember removes a member from an organization. Owners can't be removed, so an organization always keeps
+// its owner; removing one returns ErrNoRecord like a user who isn't a member.
+func (m *OrganizationModel) RemoveMember(orgID, userID int) error {
+	stmt := `DELETE FROM memberships WHERE org_id = ? AND user_id = ? AND role <> ?`
+
+	result, err := m.DB.Exec(stmt, orgID, userID, models.RoleOwner)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrNoRecord
+	}
+
+	return nil
+}
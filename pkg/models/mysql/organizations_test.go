@@ -0,0 +1,159 @@
+package mysql
+
+import (
+	"errors"
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"testing"
+)
+
+func TestOrganizationModelInvitations(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	users := UserModel{DB: db}
+	m := OrganizationModel{db}
+
+	// Alice owns Acme and invites Bob.
+	bobID, err := users.Insert("Bob", "bob@example.com", "validPa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orgID, err := m.Insert("Acme", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := m.Invite(orgID, "bob@example.com", models.RoleMember, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only a hash of the token is stored.
+	var stored int
+	err = db.QueryRow("SELECT COUNT(*) FROM invitations WHERE token_hash = ?", token).Scan(&stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored != 0 {
+		t.Errorf("want the token stored hashed")
+	}
+
+	// Members and pending invitations can't be invited again.
+	for _, email := range []string{"bob@example.com", "alice@example.com"} {
+		_, err := m.Invite(orgID, email, models.RoleMember, 1)
+		if !errors.Is(err, models.ErrDuplicateMember) {
+			t.Errorf("want %v inviting %s; got %v", models.ErrDuplicateMember, email, err)
+		}
+	}
+
+	i, err := m.Invitation(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.OrgID != orgID || i.OrgName != "Acme" || i.Email != "bob@example.com" || i.Role != models.RoleMember {
+		t.Errorf("want the invitation of bob to Acme; got %+v", i)
+	}
+	if _, err := m.Invitation("unknown"); !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("want %v for an unknown token; got %v", models.ErrNoRecord, err)
+	}
+
+	got, err := m.AcceptInvitation(token, bobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != orgID {
+		t.Errorf("want organization %d; got %d", orgID, got)
+	}
+
+	o, err := m.Get(orgID, bobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Role != models.RoleMember {
+		t.Errorf("want bob to be a %s; got %s", models.RoleMember, o.Role)
+	}
+
+	// The token can only be used once.
+	if _, err := m.AcceptInvitation(token, bobID); !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("want %v accepting twice; got %v", models.ErrNoRecord, err)
+	}
+	if _, err := m.Invitation(token); !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("want %v once accepted; got %v", models.ErrNoRecord, err)
+	}
+	if err := m.DeclineInvitation(token); !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("want %v declining once accepted; got %v", models.ErrNoRecord, err)
+	}
+
+	// A declined invitation can't be accepted.
+	token, err = m.Invite(orgID, "carol@example.com", models.RoleMember, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.DeclineInvitation(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.AcceptInvitation(token, bobID); !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("want %v accepting a declined invitation; got %v", models.ErrNoRecord, err)
+	}
+}
+
+func TestOrganizationModelRemoveMember(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	users := UserModel{DB: db}
+	m := OrganizationModel{db}
+
+	bobID, err := users.Insert("Bob", "bob@example.com", "validPa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orgID, err := m.Insert("Acme", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := m.Invite(orgID, "bob@example.com", models.RoleMember, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.AcceptInvitation(token, bobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		userID    int
+		wantError error
+	}{
+		{"Owner", 1, models.ErrNoRecord},
+		{"Member", bobID, nil},
+		{"Removed member", bobID, models.ErrNoRecord},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := m.RemoveMember(orgID, tt.userID)
+			if !errors.Is(err, tt.wantError) {
+				t.Errorf("want %v; got %v", tt.wantError, err)
+			}
+		})
+	}
+
+	members, err := m.Members(orgID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 1 || members[0].UserID != 1 || members[0].Role != models.RoleOwner {
+		t.Errorf("want the owner left alone; got %+v", members)
+	}
+}
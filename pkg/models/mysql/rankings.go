@@ -0,0 +1,156 @@
+package mysql
+
+import (
+	"database/sql"
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"strings"
+	"time"
+)
+
+// RankingModel ranks the public snippets by their views and stars. Ranking them means aggregating every view and
+// star, so the rankings are computed from time to time by Refresh and stored in the snippet_rankings table, which
+// pages read.
+type RankingModel struct {
+	DB *sql.DB
+}
+
+const (
+	// rankingSize is the number of snippets kept in each ranking.
+	rankingSize = 100
+	// starWeight is the number of views a star is worth.
+	starWeight = 10
+	// The trending ranking counts the views and stars of the last trendingWindow, and they count half as much
+	// every trendingHalfLife.
+	trendingWindow   = 7 * 24 * time.Hour
+	trendingHalfLife = 24 * time.Hour
+)
+
+// ranking counts the views and stars of the snippets since a time, the zero time to count them all. If halfLife
+// is set, they count less as they get older.
+type ranking struct {
+	name     string
+	since    time.Time
+	halfLife time.Duration
+}
+
+// rankedSnippet is a snippet and its score in a ranking.
+type rankedSnippet struct {
+	id    int
+	score float64
+}
+
+// Refresh computes every ranking again and replaces the stored ones at once.
+func (m *RankingModel) Refresh() error {
+	now := time.Now().UTC()
+	rankings := []ranking{
+		{models.RankingTrending, now.Add(-trendingWindow), trendingHalfLife},
+		{models.RankingWeek, now.AddDate(0, 0, -7), 0},
+		{models.RankingMonth, now.AddDate(0, -1, 0), 0},
+		{models.RankingAll, time.Time{}, 0},
+	}
+
+	// The aggregates are computed before the transaction, so they don't hold it open.
+	ranked := make(map[string][]rankedSnippet)
+	for _, r := range rankings {
+		snippets, err := m.compute(r, now)
+		if err != nil {
+			return err
+		}
+		ranked[r.name] = snippets
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, r := range rankings {
+		_, err = tx.Exec(`DELETE FROM snippet_rankings WHERE ranking = ?`, r.name)
+		if err != nil {
+			return err
+		}
+
+		snippets := ranked[r.name]
+		if len(snippets) == 0 {
+			continue
+		}
+
+		stmt := `INSERT INTO snippet_rankings (ranking, position, snippet_id, score) VALUES` +
+			strings.TrimSuffix(strings.Repeat(`(?, ?, ?, ?),`, len(snippets)), ",")
+
+		var args []interface{}
+		for i, s := range snippets {
+			args = append(args, r.name, i+1, s.id, s.score)
+		}
+
+		_, err = tx.Exec(stmt, args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// compute returns the snippets with the best scores in a ranking, the best first. Each view scores 1 and each star
+// starWeight, decayed by their age at now when the ranking has a half-life.
+func (m *RankingModel) compute(r ranking, now time.Time) ([]rankedSnippet, error) {
+	viewScore, starScore := `views`, `?`
+	viewWhere, starWhere := ``, ``
+	var viewArgs, starArgs []interface{}
+	starArgs = append(starArgs, starWeight)
+
+	if r.halfLife > 0 {
+		viewScore += ` * POW(0.5, TIMESTAMPDIFF(SECOND, day, ?) / ?)`
+		starScore += ` * POW(0.5, TIMESTAMPDIFF(SECOND, created, ?) / ?)`
+		viewArgs = append(viewArgs, now, r.halfLife.Seconds())
+		starArgs = append(starArgs, now, r.halfLife.Seconds())
+	}
+
+	if !r.since.IsZero() {
+		viewWhere, starWhere = ` WHERE day >= ?`, ` WHERE created >= ?`
+		viewArgs = append(viewArgs, r.since.Format("2006-01-02"))
+		starArgs = append(starArgs, r.since)
+	}
+
+	stmt := `SELECT snippets.id, SUM(events.score) AS total FROM (
+		SELECT snippet_id, ` + viewScore + ` AS score FROM snippet_views` + viewWhere + `
+		UNION ALL
+		SELECT snippet_id, ` + starScore + ` FROM stars` + starWhere + `
+	) AS events
+	JOIN snippets ON snippets.id = events.snippet_id
+	WHERE snippets.expires > UTC_TIMESTAMP() AND snippets.org_id IS NULL AND ` + published + `
+	GROUP BY snippets.id ORDER BY total DESC, snippets.id DESC LIMIT ?`
+
+	args := append(append(viewArgs, starArgs...), rankingSize)
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snippets []rankedSnippet
+	for rows.Next() {
+		var s rankedSnippet
+		err = rows.Scan(&s.id, &s.score)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	return snippets, rows.Err()
+}
+
+// Get returns the snippets of a ranking as of its last refresh, the best first, at most limit of them. Snippets
+// which expired or were deleted since are left out.
+func (m *RankingModel) Get(name string, limit int) ([]*models.Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + ` FROM snippet_rankings
+	JOIN snippets ON snippets.id = snippet_rankings.snippet_id
+	WHERE snippet_rankings.ranking = ? AND snippets.expires > UTC_TIMESTAMP() AND snippets.org_id IS NULL AND ` +
+		published + `
+	ORDER BY snippet_rankings.position LIMIT ?`
+
+	return querySnippets(m.DB, stmt, name, limit)
+}
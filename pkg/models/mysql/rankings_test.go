@@ -0,0 +1,110 @@
+package mysql
+
+import (
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"testing"
+	"time"
+)
+
+func TestRankingModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	snippets := SnippetModel{DB: db}
+	stars := StarModel{db}
+	views := ViewModel{db}
+	rankings := RankingModel{db}
+
+	var ids []int
+	for _, title := range []string{"Old favorite", "Rising", "Starred", "Private"} {
+		orgID := 0
+		if title == "Private" {
+			orgID = 1
+		}
+		id, err := snippets.Insert(1, orgID, title, textFiles(title), "365", time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	old, rising, starred, private := ids[0], ids[1], ids[2], ids[3]
+
+	// The old favorite was viewed a lot three weeks ago, the rising snippet a little today, and the starred snippet
+	// has a star, worth 10 views. Views of today count at least half in the trending ranking, so the rising
+	// snippet stays ahead. The snippet of the organization is never ranked.
+	today := time.Now().UTC()
+	err := views.Record([]*models.ViewCount{
+		{SnippetID: old, Day: today.AddDate(0, 0, -21), Views: 100},
+		{SnippetID: rising, Day: today, Views: 30},
+		{SnippetID: private, Day: today, Views: 1000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = stars.Star(2, starred)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = rankings.Refresh()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ranking string
+		want    []int
+	}{
+		{models.RankingTrending, []int{rising, starred}},
+		{models.RankingWeek, []int{rising, starred}},
+		{models.RankingMonth, []int{old, rising, starred}},
+		{models.RankingAll, []int{old, rising, starred}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ranking, func(t *testing.T) {
+			ranked, err := rankings.Get(tt.ranking, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []int
+			for _, s := range ranked {
+				got = append(got, s.ID)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("want %v; got %v", tt.want, got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("want %v; got %v", tt.want, got)
+					break
+				}
+			}
+		})
+	}
+
+	// Rankings are replaced on refresh, and deleted snippets leave them.
+	err = snippets.Delete(rising)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = rankings.Refresh()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ranked, err := rankings.Get(models.RankingTrending, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ranked) != 1 || ranked[0].ID != starred {
+		t.Errorf("want only the starred snippet; got %d snippets", len(ranked))
+	}
+}
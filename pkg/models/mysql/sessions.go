@@ -0,0 +1,144 @@
+package mysql
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"time"
+	"unicode/utf8"
+)
+
+type SessionModel struct {
+	DB *sql.DB
+}
+
+// newToken returns 32 random bytes encoded in a URL safe string.
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the hex encoded SHA-256 hash of a session or invitation token.
+// Only the hash is stored so a leaked database dump can't be used to hijack sessions or accept invitations.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Insert creates a new session for a user and returns the opaque token identifying it.
+func (m *SessionModel) Insert(userID int, ip, userAgent string, lifetime time.Duration) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	// Truncate the user agent so it fits in the column.
+	if utf8.RuneCountInString(userAgent) > 255 {
+		userAgent = string([]rune(userAgent)[:255])
+	}
+
+	stmt := `INSERT INTO user_sessions (token_hash, user_id, ip, user_agent, created, last_seen, expires)
+	VALUES(?, ?, ?, ?, UTC_TIMESTAMP(), UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? SECOND))`
+
+	_, err = m.DB.Exec(stmt, hashToken(token), userID, ip, userAgent, int(lifetime.Seconds()))
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// Get returns the session identified by a token.
+// If the session has been revoked or has expired, it returns ErrNoRecord.
+func (m *SessionModel) Get(token string) (*models.Session, error) {
+	stmt := `SELECT id, user_id, ip, user_agent, created, last_seen, expires FROM user_sessions
+	WHERE token_hash = ? AND revoked = FALSE AND expires > UTC_TIMESTAMP()`
+
+	s := &models.Session{}
+	err := m.DB.QueryRow(stmt, hashToken(token)).Scan(&s.ID, &s.UserID, &s.IP, &s.UserAgent, &s.Created,
+		&s.LastSeen, &s.Expires)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNoRecord
+		} else {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// Touch records that a session has just been used from an IP address.
+func (m *SessionModel) Touch(id int, ip string) error {
+	stmt := `UPDATE user_sessions SET last_seen = UTC_TIMESTAMP(), ip = ? WHERE id = ?`
+
+	_, err := m.DB.Exec(stmt, ip, id)
+	return err
+}
+
+// List returns the active sessions of a user, the most recently used first.
+func (m *SessionModel) List(userID int) ([]*models.Session, error) {
+	stmt := `SELECT id, user_id, ip, user_agent, created, last_seen, expires FROM user_sessions
+	WHERE user_id = ? AND revoked = FALSE AND expires > UTC_TIMESTAMP() ORDER BY last_seen DESC`
+
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*models.Session{}
+	for rows.Next() {
+		s := &models.Session{}
+		err := rows.Scan(&s.ID, &s.UserID, &s.IP, &s.UserAgent, &s.Created, &s.LastSeen, &s.Expires)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// Revoke revokes a session belonging to a user.
+// If the user has no active session with that ID, it returns ErrNoRecord.
+func (m *SessionModel) Revoke(userID, id int) error {
+	stmt := `UPDATE user_sessions SET revoked = TRUE WHERE id = ? AND user_id = ? AND revoked = FALSE`
+
+	result, err := m.DB.Exec(stmt, id, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrNoRecord
+	}
+
+	return nil
+}
+
+// RevokeAll revokes every session of a user, logging them out everywhere.
+func (m *SessionModel) RevokeAll(userID int) error {
+	stmt := `UPDATE user_sessions SET revoked = TRUE WHERE user_id = ? AND revoked = FALSE`
+
+	_, err := m.DB.Exec(stmt, userID)
+	return err
+}
@@ -0,0 +1,90 @@
+package mysql
+
+import (
+	"errors"
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"testing"
+	"time"
+)
+
+func TestSessionModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	m := SessionModel{db}
+
+	active, err := m.Insert(1, "192.0.2.1", "Firefox", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A negative lifetime makes a session which has already expired.
+	expired, err := m.Insert(1, "192.0.2.1", "Firefox", -time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := m.Insert(1, "192.0.2.2", "Chrome", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := m.Get(revoked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Revoke(1, s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		token     string
+		wantError error
+	}{
+		{"Active", active, nil},
+		{"Expired", expired, models.ErrNoRecord},
+		{"Revoked", revoked, models.ErrNoRecord},
+		{"Unknown token", "unknown", models.ErrNoRecord},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := m.Get(tt.token)
+			if !errors.Is(err, tt.wantError) {
+				t.Errorf("want %v; got %v", tt.wantError, err)
+			}
+			if err == nil && (s.UserID != 1 || s.UserAgent != "Firefox") {
+				t.Errorf("want the session of user 1; got %+v", s)
+			}
+		})
+	}
+
+	// Only the active session is listed.
+	sessions, err := m.List(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].IP != "192.0.2.1" {
+		t.Errorf("want the active session listed; got %+v", sessions)
+	}
+
+	// A revoked session can't be revoked again, nor can the session of another user.
+	if err := m.Revoke(1, s.ID); !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("want %v revoking a revoked session; got %v", models.ErrNoRecord, err)
+	}
+	if err := m.Revoke(2, sessions[0].ID); !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("want %v revoking the session of another user; got %v", models.ErrNoRecord, err)
+	}
+
+	err = m.RevokeAll(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Get(active); !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("want %v once every session is revoked; got %v", models.ErrNoRecord, err)
+	}
+}
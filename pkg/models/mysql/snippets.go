@@ -2,22 +2,197 @@ package mysql
 
 import (
 	"database/sql"
+	"encoding/base64"
 	"errors"
 	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"github.com/luca0x333/go-snippetbox/pkg/storage"
+	"time"
 )
 
 type SnippetModel struct {
 	DB *sql.DB
+	// Blobs, if set, stores the file contents larger than BlobThreshold bytes, the contents table then only keeps
+	// the key of their blob.
+	Blobs         storage.BlobStore
+	BlobThreshold int
 }
 
-// Insert will insert a new snippet into the database.
-func (m *SnippetModel) Insert(title, content, expires string) (int, error) {
+// snippetColumns are the columns scanned by scanSnippet, qualified so they can be used in joins.
+const snippetColumns = `snippets.id, COALESCE(snippets.user_id, 0), COALESCE(snippets.org_id, 0), snippets.title,
+snippets.created, snippets.updated, snippets.expires, snippets.publish_at, snippets.stars,
+COALESCE(snippets.forked_from, 0), snippets.revision`
+
+// visibleTo restricts a query on snippets to the ones a user can see: public snippets and the snippets of the
+// organizations they are a member of, once they are published unless the user is their author. It takes the user
+// ID twice as parameters, 0 for anonymous users.
+const visibleTo = `(snippets.publish_at IS NULL OR snippets.user_id = ?) AND (snippets.org_id IS NULL OR
+snippets.org_id IN (SELECT org_id FROM memberships WHERE user_id = ?))`
+
+// published restricts a query on snippets to the published ones, for the lists of snippets.
+const published = `snippets.publish_at IS NULL`
+
+// scanner is implemented by both *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanSnippet copies the snippetColumns of a row into a new Snippet.
+func scanSnippet(row scanner) (*models.Snippet, error) {
+	s := &models.Snippet{}
+	var updated, publishAt sql.NullTime
+	err := row.Scan(&s.ID, &s.UserID, &s.OrgID, &s.Title, &s.Created, &updated, &s.Expires, &publishAt, &s.Stars,
+		&s.ForkedFrom, &s.Revision)
+	if err != nil {
+		return nil, err
+	}
+	s.Updated = updated.Time
+	s.PublishAt = publishAt.Time
+
+	return s, nil
+}
+
+// querySnippets runs a query selecting snippetColumns and returns the snippets.
+func querySnippets(db *sql.DB, stmt string, args ...interface{}) ([]*models.Snippet, error) {
+	rows, err := db.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Initialize an empty slice to hold the models.Snippets objects.
+	snippets := []*models.Snippet{}
+
+	// Iterate through the rows.
+	for rows.Next() {
+		s, err := scanSnippet(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		snippets = append(snippets, s)
+	}
+
+	// When the rows.Next() loop has finished we call rows.Err() to retrieve any
+	// error that was encountered during the iteration.
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// nullID converts a zero ID to NULL. It suits any number where zero means none, like line numbers.
+func nullID(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
+
+// insertFiles stores the files of a revision of a snippet. Their positions follow their order in files.
+// Their content is stored in the contents table, so files with the same content share it.
+func (m *SnippetModel) insertFiles(tx *sql.Tx, snippetID, revision int, files []*models.File) error {
+	stmt := `INSERT INTO snippet_files (snippet_id, revision, position, name, language, content_hash, is_binary)
+	VALUES(?, ?, ?, ?, ?, ?, ?)`
+
+	for i, f := range files {
+		hash, err := m.contents().insertFile(tx, f)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(stmt, snippetID, revision, i+1, f.Name, f.Language, hash, f.Binary)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// queryFiles returns the files of a revision of a snippet, in order, with their content.
+func (m *SnippetModel) queryFiles(snippetID, revision int) ([]*models.File, error) {
+	stmt := `SELECT f.position, f.name, f.language, c.content, c.blob_key, f.is_binary FROM snippet_files f
+	JOIN contents c ON c.hash = f.content_hash WHERE f.snippet_id = ? AND f.revision = ? ORDER BY f.position`
+
+	return m.contents().queryFiles(stmt, snippetID, revision)
+}
+
+// EachFile calls fn for every file of a revision of a snippet, in order, with its content. The contents are read
+// one at a time, as fn is called, so they are never all held in memory. It stops at the first error returned by
+// fn.
+func (m *SnippetModel) EachFile(snippetID, revision int, fn func(*models.File) error) error {
+	stmt := `SELECT position, name, language, content_hash, is_binary FROM snippet_files
+	WHERE snippet_id = ? AND revision = ? ORDER BY position`
+
+	rows, err := m.DB.Query(stmt, snippetID, revision)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var files []*models.File
+	var hashes []string
+	for rows.Next() {
+		f := &models.File{}
+		var hash string
+		err := rows.Scan(&f.Position, &f.Name, &f.Language, &hash, &f.Binary)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, f)
+		hashes = append(hashes, hash)
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	// The connection isn't held while fn runs, ex: while an archive is sent to a slow client.
+	rows.Close()
+
+	// files only holds the metadata: each file is passed to fn as a copy with its content, which can be collected
+	// once fn returns.
+	for i, f := range files {
+		file := *f
+		file.Content, err = m.contents().read(hashes[i])
+		if err != nil {
+			return err
+		}
+
+		if file.Binary {
+			content, err := base64.StdEncoding.DecodeString(file.Content)
+			if err != nil {
+				return err
+			}
+			file.Content = string(content)
+		}
+
+		err = fn(&file)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Insert will insert a new snippet written by a user, with its files, into the database.
+// If orgID isn't zero, the snippet is only visible to the members of that organization. If publishAt isn't zero,
+// the snippet is scheduled: only its author can see it until PublishDue publishes it, and its lifetime starts
+// then.
+func (m *SnippetModel) Insert(userID, orgID int, title string, files []*models.File, expires string,
+	publishAt time.Time) (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
 	// SQL statement.
-	stmt := `INSERT INTO snippets (title, content, created, expires)
-	VALUES(?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))`
+	stmt := `INSERT INTO snippets (user_id, org_id, title, created, expires, publish_at)
+	VALUES(?, ?, ?, UTC_TIMESTAMP(), DATE_ADD(COALESCE(?, UTC_TIMESTAMP()), INTERVAL ? DAY), ?)`
 
 	// type result interface
-	result, err := m.DB.Exec(stmt, title, content, expires)
+	at := sql.NullTime{Time: publishAt.UTC(), Valid: !publishAt.IsZero()}
+	result, err := tx.Exec(stmt, nullID(userID), nullID(orgID), title, at, expires, at)
 	if err != nil {
 		return 0, err
 	}
@@ -27,25 +202,95 @@ func (m *SnippetModel) Insert(title, content, expires string) (int, error) {
 		return 0, err
 	}
 
+	// The first revision of a snippet is revision 1.
+	err = m.insertFiles(tx, int(id), 1, files)
+	if err != nil {
+		return 0, err
+	}
+
 	// id is type int64, convert it to int before return it
-	return int(id), nil
+	return int(id), tx.Commit()
 }
 
-// Get will return a specific snippet based on its id.
-func (m *SnippetModel) Get(id int) (*models.Snippet, error) {
-	// SQL statement.
-	stmt := `SELECT id, title, content, created, expires FROM snippets
-	WHERE expires > UTC_TIMESTAMP() AND id = ?`
+// Fork copies the current revision of a snippet into a new snippet owned by a user and returns its ID.
+// The fork is shared with the same organization as the original and has the same lifetime. Forks of scheduled
+// snippets are published at the same time.
+// The caller is responsible for checking the user can see the original snippet.
+func (m *SnippetModel) Fork(id, userID int) (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
 
-	// QueryRow() returns a pointer to a sql.Row object which // holds the result from the database.
-	row := m.DB.QueryRow(stmt, id)
+	stmt := `INSERT INTO snippets (user_id, org_id, title, created, expires, publish_at, forked_from)
+	SELECT ?, org_id, title, UTC_TIMESTAMP(),
+	DATE_ADD(UTC_TIMESTAMP(), INTERVAL TIMESTAMPDIFF(SECOND, created, expires) SECOND), publish_at, id
+	FROM snippets WHERE id = ? AND expires > UTC_TIMESTAMP()`
 
-	// Initialize a pointer to a new zeroed Snippet struct.
-	s := &models.Snippet{}
+	result, err := tx.Exec(stmt, userID, id)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, models.ErrNoRecord
+	}
+
+	forkID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	stmt = `INSERT INTO snippet_files (snippet_id, revision, position, name, language, content_hash, is_binary)
+	SELECT ?, 1, f.position, f.name, f.language, f.content_hash, f.is_binary FROM snippet_files f
+	JOIN snippets s ON s.id = f.snippet_id AND s.revision = f.revision WHERE s.id = ?`
+	_, err = tx.Exec(stmt, forkID, id)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(forkID), tx.Commit()
+}
+
+// Forks returns the forks of a snippet which the user viewerID can see, the most recently created first.
+func (m *SnippetModel) Forks(id, viewerID int) ([]*models.Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets
+	WHERE snippets.expires > UTC_TIMESTAMP() AND snippets.forked_from = ? AND ` + visibleTo + `
+	ORDER BY snippets.created DESC`
+
+	return querySnippets(m.DB, stmt, id, viewerID, viewerID)
+}
+
+// Get will return a specific snippet based on its id, if the user viewerID can see it.
+// viewerID is 0 for anonymous users. Snippets the user can't see are reported as ErrNoRecord, so their
+// existence isn't revealed.
+func (m *SnippetModel) Get(id, viewerID int) (*models.Snippet, error) {
+	s, err := m.Find(id, viewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Files, err = m.queryFiles(s.ID, s.Revision)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
 
-	// Use Scan() to copy the value from sql.Row to the corresponding field in the
-	// Snippet struct 's'.
-	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+// Find is like Get, but doesn't fetch the files of the snippet: EachFile reads them one at a time.
+func (m *SnippetModel) Find(id, viewerID int) (*models.Snippet, error) {
+	// SQL statement.
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets
+	WHERE snippets.expires > UTC_TIMESTAMP() AND snippets.id = ? AND ` + visibleTo
+
+	// QueryRow() returns a pointer to a sql.Row object which // holds the result from the database.
+	s, err := scanSnippet(m.DB.QueryRow(stmt, id, viewerID, viewerID))
 	if err != nil {
 		// Is() reports whether any error in err's chain matches target.
 		// ErrNoRows is returned by Scan when QueryRow doesn't return a
@@ -60,39 +305,273 @@ func (m *SnippetModel) Get(id int) (*models.Snippet, error) {
 	return s, nil
 }
 
-// Latest will return the 10 most recently created snippets.
+// Update replaces the title and files of a snippet with a new revision and returns its number. The replaced
+// version is kept and can be fetched with Revision. If the snippet doesn't exist or has expired, it returns
+// ErrNoRecord.
+// The caller is responsible for checking the user is allowed to edit the snippet.
+func (m *SnippetModel) Update(id int, title string, files []*models.File) (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var revision int
+	stmt := `SELECT revision FROM snippets WHERE id = ? AND expires > UTC_TIMESTAMP() FOR UPDATE`
+	err = tx.QueryRow(stmt, id).Scan(&revision)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, models.ErrNoRecord
+		} else {
+			return 0, err
+		}
+	}
+
+	// The files of the replaced revision stay in snippet_files, only its title and date need to be kept.
+	stmt = `INSERT INTO snippet_revisions (snippet_id, revision, title, created)
+	SELECT id, revision, title, COALESCE(updated, created) FROM snippets WHERE id = ?`
+	_, err = tx.Exec(stmt, id)
+	if err != nil {
+		return 0, err
+	}
+
+	err = m.insertFiles(tx, id, revision+1, files)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt = `UPDATE snippets SET title = ?, revision = ?, updated = UTC_TIMESTAMP() WHERE id = ?`
+	_, err = tx.Exec(stmt, title, revision+1, id)
+	if err != nil {
+		return 0, err
+	}
+
+	return revision + 1, tx.Commit()
+}
+
+// Revision returns an earlier revision of a snippet with its files. The current revision isn't stored as a
+// Revision, asking for it returns ErrNoRecord like a revision which doesn't exist.
+// The caller is responsible for checking the user can see the snippet.
+func (m *SnippetModel) Revision(id, number int) (*models.Revision, error) {
+	rev, err := m.FindRevision(id, number)
+	if err != nil {
+		return nil, err
+	}
+
+	rev.Files, err = m.queryFiles(id, number)
+	if err != nil {
+		return nil, err
+	}
+
+	return rev, nil
+}
+
+// FindRevision is like Revision, but doesn't fetch the files of the revision: EachFile reads them one at a time.
+func (m *SnippetModel) FindRevision(id, number int) (*models.Revision, error) {
+	stmt := `SELECT snippet_id, revision, title, created FROM snippet_revisions WHERE snippet_id = ? AND revision = ?`
+
+	rev := &models.Revision{}
+	err := m.DB.QueryRow(stmt, id, number).Scan(&rev.SnippetID, &rev.Number, &rev.Title, &rev.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNoRecord
+		} else {
+			return nil, err
+		}
+	}
+
+	return rev, nil
+}
+
+// Revisions returns the earlier revisions of a snippet, the most recent first. Their files aren't fetched.
+// The caller is responsible for checking the user can see the snippet.
+func (m *SnippetModel) Revisions(id int) ([]*models.Revision, error) {
+	stmt := `SELECT snippet_id, revision, title, created FROM snippet_revisions
+	WHERE snippet_id = ? ORDER BY revision DESC`
+
+	rows, err := m.DB.Query(stmt, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*models.Revision{}
+	for rows.Next() {
+		rev := &models.Revision{}
+		err := rows.Scan(&rev.SnippetID, &rev.Number, &rev.Title, &rev.Created)
+		if err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, rev)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// Latest will return the 10 most recently created public snippets.
 func (m *SnippetModel) Latest() ([]*models.Snippet, error) {
 	// SQL statement.
-	stmt := `SELECT id, title, content, created, expires FROM snippets 
-	WHERE expires > UTC_TIMESTAMP() ORDER BY created DESC LIMIT 10`
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets
+	WHERE snippets.expires > UTC_TIMESTAMP() AND snippets.org_id IS NULL AND ` + published + `
+	ORDER BY snippets.created DESC LIMIT 10`
+
+	return querySnippets(m.DB, stmt)
+}
 
-	rows, err := m.DB.Query(stmt)
+// Popular will return the 10 public snippets with the most stars.
+func (m *SnippetModel) Popular() ([]*models.Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets
+	WHERE snippets.expires > UTC_TIMESTAMP() AND snippets.org_id IS NULL AND ` + published + `
+	ORDER BY snippets.stars DESC, snippets.created DESC LIMIT 10`
+
+	return querySnippets(m.DB, stmt)
+}
+
+// ByAuthor returns a page of the public snippets of a user, the most recently created first.
+// It skips offset snippets and returns at most limit of them.
+func (m *SnippetModel) ByAuthor(userID, limit, offset int) ([]*models.Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets
+	WHERE snippets.expires > UTC_TIMESTAMP() AND snippets.user_id = ? AND snippets.org_id IS NULL AND ` + published + `
+	ORDER BY snippets.created DESC, snippets.id DESC LIMIT ? OFFSET ?`
+
+	return querySnippets(m.DB, stmt, userID, limit, offset)
+}
+
+// ForOrg returns the snippets shared with an organization, the most recently created first.
+// The caller is responsible for checking the user is a member of the organization.
+func (m *SnippetModel) ForOrg(orgID int) ([]*models.Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets
+	WHERE snippets.expires > UTC_TIMESTAMP() AND snippets.org_id = ? AND ` + published + `
+	ORDER BY snippets.created DESC`
+
+	return querySnippets(m.DB, stmt, orgID)
+}
+
+// Scheduled returns the snippets of a user waiting to be published, the next one to be published first.
+func (m *SnippetModel) Scheduled(userID int) ([]*models.Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets
+	WHERE snippets.expires > UTC_TIMESTAMP() AND snippets.user_id = ? AND snippets.publish_at IS NOT NULL
+	ORDER BY snippets.publish_at, snippets.id`
+
+	return querySnippets(m.DB, stmt, userID)
+}
+
+// PublishDue publishes the scheduled snippets whose time has come and returns them. They count as created when
+// they are published, so they show up among the latest snippets.
+func (m *SnippetModel) PublishDue() ([]*models.Snippet, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Use the same cutoff for both statements, and lock the rows, so every snippet is returned once.
+	cutoff := time.Now().UTC()
+
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets WHERE snippets.publish_at <= ? FOR UPDATE`
+	rows, err := tx.Query(stmt, cutoff)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	// Initialize an empty slice to hold the models.Snippets objects.
 	snippets := []*models.Snippet{}
-
-	// Iterate through the rows.
 	for rows.Next() {
-		// Create a new empty Snippet
-		s := &models.Snippet{}
-
-		err := rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+		s, err := scanSnippet(rows)
 		if err != nil {
 			return nil, err
 		}
 
+		s.Created, s.PublishAt = s.PublishAt, time.Time{}
 		snippets = append(snippets, s)
 	}
 
-	// When the rows.Next() loop has finished we call rows.Err() to retrieve any
-	// error that was encountered during the iteration.
 	if err = rows.Err(); err != nil {
 		return nil, err
 	}
+	rows.Close()
 
-	return snippets, nil
+	// MySQL assigns the columns from left to right, created gets publish_at before it is cleared.
+	stmt = `UPDATE snippets SET created = publish_at, publish_at = NULL WHERE publish_at <= ?`
+	_, err = tx.Exec(stmt, cutoff)
+	if err != nil {
+		return nil, err
+	}
+
+	return snippets, tx.Commit()
+}
+
+// snippetDependents are the tables holding rows which belong to a snippet, in a snippet_id column.
+// They are deleted along with the snippet.
+var snippetDependents = []string{"stars", "comments", "snippet_views", "snippet_rankings", "snippet_revisions",
+	"snippet_files"}
+
+// Delete removes a snippet and everything belonging to it. If there is no snippet with that ID, it returns
+// ErrNoRecord.
+func (m *SnippetModel) Delete(id int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM snippets WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrNoRecord
+	}
+
+	for _, table := range snippetDependents {
+		_, err = tx.Exec(`DELETE FROM `+table+` WHERE snippet_id = ?`, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteExpired removes the expired snippets and everything belonging to them, and returns how many snippets
+// were removed.
+func (m *SnippetModel) DeleteExpired() (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Use the same cutoff for every statement, so no snippet expires half way through.
+	cutoff := time.Now().UTC()
+
+	for _, table := range snippetDependents {
+		stmt := `DELETE FROM ` + table + ` WHERE snippet_id IN (SELECT id FROM snippets WHERE expires <= ?)`
+		_, err = tx.Exec(stmt, cutoff)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	result, err := tx.Exec(`DELETE FROM snippets WHERE expires <= ?`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), tx.Commit()
 }
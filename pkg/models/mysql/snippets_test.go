@@ -0,0 +1,330 @@
+package mysql
+
+import (
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"testing"
+	"time"
+)
+
+func TestSnippetModelVisibility(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	snippets := SnippetModel{DB: db}
+	orgs := OrganizationModel{db}
+
+	// Alice (ID 1) owns an organization, user 2 isn't a member.
+	orgID, err := orgs.Insert("Acme", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicID, err := snippets.Insert(1, 0, "Public", textFiles("Everyone can see this"), "7", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateID, err := snippets.Insert(1, orgID, "Private", textFiles("Only for Acme"), "7", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		snippetID int
+		viewerID  int
+		wantError error
+	}{
+		{"Public snippet, anonymous", publicID, 0, nil},
+		{"Public snippet, member", publicID, 1, nil},
+		{"Organization snippet, anonymous", privateID, 0, models.ErrNoRecord},
+		{"Organization snippet, non-member", privateID, 2, models.ErrNoRecord},
+		{"Organization snippet, member", privateID, 1, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := snippets.Get(tt.snippetID, tt.viewerID)
+
+			if err != tt.wantError {
+				t.Errorf("want %v; got %v", tt.wantError, err)
+			}
+		})
+	}
+
+	// Only public snippets are listed on the home page.
+	latest, err := snippets.Latest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(latest) != 1 || latest[0].ID != publicID {
+		t.Errorf("want only snippet %d; got %v", publicID, latest)
+	}
+
+	shared, err := snippets.ForOrg(orgID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shared) != 1 || shared[0].ID != privateID {
+		t.Errorf("want only snippet %d; got %v", privateID, shared)
+	}
+}
+
+func TestSnippetModelUpdate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	snippets := SnippetModel{DB: db}
+
+	id, err := snippets.Insert(1, 0, "First", textFiles("First content"), "7", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revision, err := snippets.Update(id, "Second", textFiles("Second content", "Another file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revision != 2 {
+		t.Errorf("want revision 2; got %d", revision)
+	}
+
+	s, err := snippets.Get(id, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Revision != 2 || s.Title != "Second" || len(s.Files) != 2 || s.Files[0].Content != "Second content" ||
+		s.Files[1].Position != 2 {
+		t.Errorf("want the second revision with 2 files; got %d %q with %d files", s.Revision, s.Title, len(s.Files))
+	}
+
+	// The first revision is kept.
+	rev, err := snippets.Revision(id, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev.Title != "First" || len(rev.Files) != 1 || rev.Files[0].Content != "First content" {
+		t.Errorf("want the first revision; got %q with %d files", rev.Title, len(rev.Files))
+	}
+
+	_, err = snippets.Revision(id, 2)
+	if err != models.ErrNoRecord {
+		t.Errorf("want %v for the current revision; got %v", models.ErrNoRecord, err)
+	}
+
+	revisions, err := snippets.Revisions(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 1 || revisions[0].Number != 1 {
+		t.Errorf("want the first revision only; got %d revisions", len(revisions))
+	}
+
+	_, err = snippets.Update(id+1, "Missing", textFiles("Missing content"))
+	if err != models.ErrNoRecord {
+		t.Errorf("want %v; got %v", models.ErrNoRecord, err)
+	}
+}
+
+func TestSnippetModelFork(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	snippets := SnippetModel{DB: db}
+
+	id, err := snippets.Insert(1, 0, "Original", textFiles("First content"), "7", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = snippets.Update(id, "Original", textFiles("Dockerfile", "Script"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	forkID, err := snippets.Fork(id, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The fork starts at revision 1 with the files of the current revision.
+	fork, err := snippets.Get(forkID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fork.Revision != 1 || len(fork.Files) != 2 || fork.Files[1].Content != "Script" {
+		t.Errorf("want a fork with the 2 current files; got revision %d with %d files", fork.Revision,
+			len(fork.Files))
+	}
+}
+
+func TestSnippetModelBinaryFiles(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	snippets := SnippetModel{DB: db}
+
+	content := "\x89PNG\r\n\x1a\n\x00\xff"
+	files := []*models.File{{Name: "image.png", Content: content, Binary: true}}
+	id, err := snippets.Insert(1, 0, "Image", files, "7", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := snippets.Get(id, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Files) != 1 || !s.Files[0].Binary || s.Files[0].Content != content {
+		t.Errorf("want the binary file back unchanged; got %+v", s.Files)
+	}
+
+	err = snippets.EachFile(id, s.Revision, func(f *models.File) error {
+		if !f.Binary || f.Content != content {
+			t.Errorf("want the binary file read unchanged; got %+v", f)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSnippetModelScheduled(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	snippets := SnippetModel{DB: db}
+
+	later := time.Now().Add(time.Hour).Truncate(time.Second)
+	laterID, err := snippets.Insert(1, 0, "Announcement", textFiles("Coming soon"), "7", later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A snippet scheduled in the past is published by the next run of the scheduler.
+	dueAt := time.Now().Add(-time.Minute).Truncate(time.Second)
+	dueID, err := snippets.Insert(1, 0, "Release notes", textFiles("Out now"), "7", dueAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		snippetID int
+		viewerID  int
+		wantError error
+	}{
+		{"Anonymous", laterID, 0, models.ErrNoRecord},
+		{"Other user", laterID, 2, models.ErrNoRecord},
+		{"Author", laterID, 1, nil},
+		{"Due, before publishing", dueID, 0, models.ErrNoRecord},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := snippets.Get(tt.snippetID, tt.viewerID)
+
+			if err != tt.wantError {
+				t.Errorf("want %v; got %v", tt.wantError, err)
+			}
+		})
+	}
+
+	latest, err := snippets.Latest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(latest) != 0 {
+		t.Errorf("want no published snippet; got %v", latest)
+	}
+
+	scheduled, err := snippets.Scheduled(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scheduled) != 2 || scheduled[0].ID != dueID || !scheduled[1].PublishAt.Equal(later) {
+		t.Errorf("want snippets %d and %d scheduled; got %v", dueID, laterID, scheduled)
+	}
+
+	published, err := snippets.PublishDue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(published) != 1 || published[0].ID != dueID || !published[0].Created.Equal(dueAt) {
+		t.Fatalf("want snippet %d published; got %v", dueID, published)
+	}
+
+	s, err := snippets.Get(dueID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.PublishAt.IsZero() || !s.Created.Equal(dueAt) || !s.Expires.Equal(dueAt.Add(7*24*time.Hour)) {
+		t.Errorf("want snippet created at %v, expiring 7 days later; got %+v", dueAt, s)
+	}
+
+	// Snippets are only published once.
+	published, err = snippets.PublishDue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(published) != 0 {
+		t.Errorf("want no snippet published again; got %v", published)
+	}
+}
+
+func TestSnippetModelDeleteExpired(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	snippets := SnippetModel{DB: db}
+	comments := CommentModel{db}
+
+	id, err := snippets.Insert(1, 0, "Expired", textFiles("Gone soon"), "7", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	commentID, err := comments.Insert(id, 1, 1, 0, models.LineRange{}, "A comment")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Exec("UPDATE snippets SET expires = DATE_SUB(UTC_TIMESTAMP(), INTERVAL 1 MINUTE) WHERE id = ?", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := snippets.DeleteExpired()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("want 1 purged snippet; got %d", n)
+	}
+
+	_, err = comments.Get(commentID)
+	if err != models.ErrNoRecord {
+		t.Errorf("want %v for the comment; got %v", models.ErrNoRecord, err)
+	}
+}
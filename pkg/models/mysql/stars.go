@@ -0,0 +1,75 @@
+package mysql
+
+import (
+	"database/sql"
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+)
+
+// StarModel records the snippets users starred. The number of stars of each snippet is kept up to date in the
+// snippets table, so snippets can be sorted by popularity without counting the stars.
+type StarModel struct {
+	DB *sql.DB
+}
+
+// Star stars a snippet for a user. Starring a snippet twice has no effect.
+// The caller is responsible for checking the user can see the snippet.
+func (m *StarModel) Star(userID, snippetID int) error {
+	return m.update(`INSERT IGNORE INTO stars (user_id, snippet_id, created) VALUES(?, ?, UTC_TIMESTAMP())`,
+		`UPDATE snippets SET stars = stars + 1 WHERE id = ?`, userID, snippetID)
+}
+
+// Unstar removes the star of a user from a snippet. Unstarring a snippet which isn't starred has no effect.
+func (m *StarModel) Unstar(userID, snippetID int) error {
+	return m.update(`DELETE FROM stars WHERE user_id = ? AND snippet_id = ?`,
+		`UPDATE snippets SET stars = stars - 1 WHERE id = ?`, userID, snippetID)
+}
+
+// update runs a statement changing the stars table and, in the same transaction, the statement updating the
+// count of stars if a star was actually added or removed.
+func (m *StarModel) update(stmt, countStmt string, userID, snippetID int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(stmt, userID, snippetID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return nil
+	}
+
+	_, err = tx.Exec(countStmt, snippetID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// IsStarred reports whether a user starred a snippet.
+func (m *StarModel) IsStarred(userID, snippetID int) (bool, error) {
+	stmt := `SELECT EXISTS(SELECT 1 FROM stars WHERE user_id = ? AND snippet_id = ?)`
+
+	var starred bool
+	err := m.DB.QueryRow(stmt, userID, snippetID).Scan(&starred)
+	return starred, err
+}
+
+// Starred returns the snippets starred by a user, the most recently starred first.
+// Snippets the user can no longer see, for example because they left an organization, are left out.
+func (m *StarModel) Starred(userID int) ([]*models.Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + ` FROM stars
+	JOIN snippets ON snippets.id = stars.snippet_id
+	WHERE stars.user_id = ? AND snippets.expires > UTC_TIMESTAMP() AND ` + visibleTo + `
+	ORDER BY stars.created DESC`
+
+	return querySnippets(m.DB, stmt, userID, userID, userID)
+}
@@ -0,0 +1,64 @@
+package mysql
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStarModelCount(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	snippets := SnippetModel{DB: db}
+	stars := StarModel{db}
+
+	id, err := snippets.Insert(1, 0, "Popular", textFiles("Everyone likes this"), "7", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Starring twice or unstarring a snippet which isn't starred must not change the count.
+	steps := []struct {
+		name      string
+		userID    int
+		star      bool
+		wantStars int
+	}{
+		{"Star", 1, true, 1},
+		{"Star again", 1, true, 1},
+		{"Other user", 2, true, 2},
+		{"Unstar", 1, false, 1},
+		{"Unstar again", 1, false, 1},
+	}
+
+	for _, step := range steps {
+		if step.star {
+			err = stars.Star(step.userID, id)
+		} else {
+			err = stars.Unstar(step.userID, id)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s, err := snippets.Get(id, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Stars != step.wantStars {
+			t.Errorf("%s: want %d stars; got %d", step.name, step.wantStars, s.Stars)
+		}
+	}
+
+	starred, err := stars.Starred(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(starred) != 1 || starred[0].ID != id {
+		t.Errorf("want only snippet %d; got %v", id, starred)
+	}
+}
@@ -0,0 +1,170 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"github.com/luca0x333/go-snippetbox/pkg/storage"
+)
+
+// SnippetTemplateModel manages the templates new snippets can start from. The contents of their files are stored
+// with the ones of the snippets, Blobs and BlobThreshold must be set like in SnippetModel.
+type SnippetTemplateModel struct {
+	DB            *sql.DB
+	Blobs         storage.BlobStore
+	BlobThreshold int
+}
+
+// contents returns the store of the contents of the files of templates, shared with the snippets.
+func (m *SnippetTemplateModel) contents() *contentStore {
+	return &contentStore{db: m.DB, blobs: m.Blobs, blobThreshold: m.BlobThreshold}
+}
+
+// templateColumns are the columns scanned by scanTemplate.
+const templateColumns = `t.id, t.user_id, COALESCE(t.org_id, 0), COALESCE(o.name, ''), t.name, t.title, t.expires,
+t.created`
+
+// templateUsableBy restricts a query on templates to the ones a user can use: their personal templates and the
+// templates of the organizations they are a member of. It takes the user ID twice as parameters.
+const templateUsableBy = `((t.org_id IS NULL AND t.user_id = ?) OR t.org_id IN
+(SELECT org_id FROM memberships WHERE user_id = ?))`
+
+// scanTemplate copies the templateColumns of a row into a new SnippetTemplate.
+func scanTemplate(row scanner) (*models.SnippetTemplate, error) {
+	t := &models.SnippetTemplate{}
+	err := row.Scan(&t.ID, &t.UserID, &t.OrgID, &t.OrgName, &t.Name, &t.Title, &t.Expires, &t.Created)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Insert saves a template written by a user, with its files, and returns its ID. If orgID isn't zero, the
+// template is shared with the members of that organization. expires is the lifetime of the snippets created from
+// it, in days.
+func (m *SnippetTemplateModel) Insert(userID, orgID int, name, title string, files []*models.File,
+	expires string) (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt := `INSERT INTO snippet_templates (user_id, org_id, name, title, expires, created)
+	VALUES(?, ?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	result, err := tx.Exec(stmt, userID, nullID(orgID), name, title, expires)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	stmt = `INSERT INTO snippet_template_files (template_id, position, name, language, content_hash, is_binary)
+	VALUES(?, ?, ?, ?, ?, ?)`
+
+	// Like the files of snippets, the files of templates share the contents table.
+	for i, f := range files {
+		hash, err := m.contents().insertFile(tx, f)
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = tx.Exec(stmt, id, i+1, f.Name, f.Language, hash, f.Binary)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return int(id), tx.Commit()
+}
+
+// Get returns a template with its files, if the user userID can use it. Templates the user can't use are
+// reported as ErrNoRecord, so their existence isn't revealed.
+func (m *SnippetTemplateModel) Get(id, userID int) (*models.SnippetTemplate, error) {
+	stmt := `SELECT ` + templateColumns + ` FROM snippet_templates t LEFT JOIN organizations o ON o.id = t.org_id
+	WHERE t.id = ? AND ` + templateUsableBy
+
+	t, err := scanTemplate(m.DB.QueryRow(stmt, id, userID, userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNoRecord
+		} else {
+			return nil, err
+		}
+	}
+
+	stmt = `SELECT f.position, f.name, f.language, c.content, c.blob_key, f.is_binary FROM snippet_template_files f
+	JOIN contents c ON c.hash = f.content_hash WHERE f.template_id = ? ORDER BY f.position`
+
+	t.Files, err = m.contents().queryFiles(stmt, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// ForUser returns the templates a user can use, without their files: their personal templates first, then the
+// templates of their organizations, sorted by organization and name.
+func (m *SnippetTemplateModel) ForUser(userID int) ([]*models.SnippetTemplate, error) {
+	stmt := `SELECT ` + templateColumns + ` FROM snippet_templates t LEFT JOIN organizations o ON o.id = t.org_id
+	WHERE ` + templateUsableBy + ` ORDER BY t.org_id IS NOT NULL, o.name, t.name, t.id`
+
+	rows, err := m.DB.Query(stmt, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []*models.SnippetTemplate{}
+	for rows.Next() {
+		t, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		templates = append(templates, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return templates, nil
+}
+
+// Delete removes a template and its files, whose contents are left to DeleteUnusedContents. If there is no
+// template with that ID, it returns ErrNoRecord.
+// The caller is responsible for checking the user is allowed to delete the template.
+func (m *SnippetTemplateModel) Delete(id int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM snippet_templates WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrNoRecord
+	}
+
+	_, err = tx.Exec(`DELETE FROM snippet_template_files WHERE template_id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
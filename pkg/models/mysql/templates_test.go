@@ -0,0 +1,88 @@
+package mysql
+
+import (
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"testing"
+)
+
+func TestSnippetTemplateModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	templates := SnippetTemplateModel{DB: db}
+	orgs := OrganizationModel{db}
+
+	// Alice (ID 1) owns an organization, user 2 isn't a member.
+	orgID, err := orgs.Insert("Acme", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := []*models.File{
+		{Name: "report.md", Language: "markdown", Content: "# Incident of {{date}}"},
+		{Name: "logo.png", Content: "\x89PNG\x00", Binary: true},
+	}
+	personalID, err := templates.Insert(2, 0, "Query", "Query of {{date}}", textFiles("SELECT 1;"), "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orgTemplateID, err := templates.Insert(1, orgID, "Incident", "Incident {{date}}", files, "365")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		templateID int
+		userID     int
+		wantError  error
+	}{
+		{"Personal template, author", personalID, 2, nil},
+		{"Personal template, other user", personalID, 1, models.ErrNoRecord},
+		{"Organization template, member", orgTemplateID, 1, nil},
+		{"Organization template, non-member", orgTemplateID, 2, models.ErrNoRecord},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := templates.Get(tt.templateID, tt.userID)
+
+			if err != tt.wantError {
+				t.Errorf("want %v; got %v", tt.wantError, err)
+			}
+		})
+	}
+
+	tmpl, err := templates.Get(orgTemplateID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tmpl.OrgName != "Acme" || tmpl.Expires != "365" || tmpl.Title != "Incident {{date}}" {
+		t.Errorf("want template of Acme expiring after 365 days; got %+v", tmpl)
+	}
+	if len(tmpl.Files) != 2 || tmpl.Files[0].Content != files[0].Content || tmpl.Files[1].Content != files[1].Content ||
+		!tmpl.Files[1].Binary {
+		t.Errorf("want the files of the template; got %v", tmpl.Files)
+	}
+
+	list, err := templates.ForUser(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].ID != personalID {
+		t.Errorf("want only template %d; got %v", personalID, list)
+	}
+
+	err = templates.Delete(personalID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = templates.Get(personalID, 2)
+	if err != models.ErrNoRecord {
+		t.Errorf("want %v after deleting; got %v", models.ErrNoRecord, err)
+	}
+}
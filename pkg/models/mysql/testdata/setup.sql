@@ -1,20 +1,32 @@
 CREATE TABLE snippets (
     id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER,
+    org_id INTEGER,
     title VARCHAR(100) NOT NULL,
-    content TEXT NOT NULL,
     created DATETIME NOT NULL,
-    expires DATETIME NOT NULL
+    expires DATETIME NOT NULL,
+    stars INTEGER NOT NULL DEFAULT 0,
+    forked_from INTEGER,
+    revision INTEGER NOT NULL DEFAULT 1,
+    updated DATETIME,
+    publish_at DATETIME
 );
 
 CREATE INDEX idx_snippets_created ON snippets(created);
+CREATE INDEX idx_snippets_stars ON snippets(stars, created);
+CREATE INDEX idx_snippets_forked_from ON snippets(forked_from);
+CREATE INDEX idx_snippets_org_id ON snippets(org_id, created);
+CREATE INDEX idx_snippets_user_id ON snippets(user_id, created);
+CREATE INDEX idx_snippets_publish_at ON snippets(publish_at);
 
 CREATE TABLE users (
     id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
     name VARCHAR(255) NOT NULL,
     email VARCHAR(255) NOT NULL,
-    hashed_password CHAR(60) NOT NULL,
+    hashed_password VARCHAR(255) NOT NULL,
     created DATETIME NOT NULL,
-    active BOOLEAN NOT NULL DEFAULT TRUE
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    is_admin BOOLEAN NOT NULL DEFAULT FALSE
 );
 
 ALTER TABLE users ADD CONSTRAINT users_uc_email UNIQUE (email);
@@ -25,3 +37,184 @@ INSERT INTO users (name, email, hashed_password, created) VALUES (
     '$2a$12$NuTjWXm3KKntReFwyBVHyuf/to.HEwTy.eS206TNfkGfr6HzGJSWG',
     '2018-12-23 17:25:22'
 );
+
+CREATE TABLE login_attempts (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    email VARCHAR(255) NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    created DATETIME NOT NULL,
+    cleared BOOLEAN NOT NULL DEFAULT FALSE,
+    ip_cleared BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX idx_login_attempts_email ON login_attempts(email, created);
+CREATE INDEX idx_login_attempts_ip ON login_attempts(ip, created);
+
+CREATE TABLE user_sessions (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    token_hash CHAR(64) NOT NULL,
+    user_id INTEGER NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    user_agent VARCHAR(255) NOT NULL,
+    created DATETIME NOT NULL,
+    last_seen DATETIME NOT NULL,
+    expires DATETIME NOT NULL,
+    revoked BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+ALTER TABLE user_sessions ADD CONSTRAINT user_sessions_uc_token_hash UNIQUE (token_hash);
+CREATE INDEX idx_user_sessions_user_id ON user_sessions(user_id, last_seen);
+
+CREATE TABLE audit_log (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER,
+    event VARCHAR(50) NOT NULL,
+    details VARCHAR(255) NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    created DATETIME NOT NULL
+);
+
+CREATE INDEX idx_audit_log_created ON audit_log(created);
+
+CREATE INDEX idx_audit_log_user_id ON audit_log(user_id, created);
+CREATE INDEX idx_audit_log_event ON audit_log(event, created);
+
+-- The audit log is append-only.
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
+
+CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
+
+CREATE TABLE identities (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    issuer VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    created DATETIME NOT NULL
+);
+
+ALTER TABLE identities ADD CONSTRAINT identities_uc_issuer_subject UNIQUE (issuer, subject);
+
+CREATE TABLE organizations (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    name VARCHAR(100) NOT NULL,
+    created DATETIME NOT NULL
+);
+
+CREATE TABLE memberships (
+    org_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    role VARCHAR(10) NOT NULL,
+    created DATETIME NOT NULL,
+    PRIMARY KEY (org_id, user_id)
+);
+
+CREATE INDEX idx_memberships_user_id ON memberships(user_id);
+
+CREATE TABLE invitations (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    org_id INTEGER NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    role VARCHAR(10) NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    invited_by INTEGER NOT NULL,
+    created DATETIME NOT NULL
+);
+
+ALTER TABLE invitations ADD CONSTRAINT invitations_uc_org_id_email UNIQUE (org_id, email);
+ALTER TABLE invitations ADD CONSTRAINT invitations_uc_token_hash UNIQUE (token_hash);
+
+CREATE TABLE stars (
+    user_id INTEGER NOT NULL,
+    snippet_id INTEGER NOT NULL,
+    created DATETIME NOT NULL,
+    PRIMARY KEY (user_id, snippet_id)
+);
+
+CREATE INDEX idx_stars_snippet_id ON stars(snippet_id);
+
+CREATE TABLE comments (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    snippet_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    parent_id INTEGER,
+    revision INTEGER NOT NULL DEFAULT 1,
+    line_file INTEGER,
+    line_start INTEGER,
+    line_end INTEGER,
+    content TEXT NOT NULL,
+    created DATETIME NOT NULL,
+    updated DATETIME,
+    deleted BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX idx_comments_snippet_id ON comments(snippet_id, created);
+
+CREATE TABLE snippet_revisions (
+    snippet_id INTEGER NOT NULL,
+    revision INTEGER NOT NULL,
+    title VARCHAR(100) NOT NULL,
+    created DATETIME NOT NULL,
+    PRIMARY KEY (snippet_id, revision)
+);
+
+CREATE TABLE snippet_files (
+    snippet_id INTEGER NOT NULL,
+    revision INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    language VARCHAR(20) NOT NULL,
+    content_hash CHAR(64) NOT NULL,
+    is_binary BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (snippet_id, revision, position)
+);
+
+CREATE INDEX idx_snippet_files_content_hash ON snippet_files(content_hash);
+
+CREATE TABLE contents (
+    hash CHAR(64) NOT NULL PRIMARY KEY,
+    content MEDIUMTEXT NOT NULL,
+    blob_key VARCHAR(100)
+);
+
+CREATE TABLE snippet_templates (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    org_id INTEGER,
+    name VARCHAR(100) NOT NULL,
+    title VARCHAR(100) NOT NULL,
+    expires INTEGER NOT NULL,
+    created DATETIME NOT NULL
+);
+
+CREATE INDEX idx_snippet_templates_user_id ON snippet_templates(user_id);
+CREATE INDEX idx_snippet_templates_org_id ON snippet_templates(org_id);
+
+CREATE TABLE snippet_template_files (
+    template_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    language VARCHAR(20) NOT NULL,
+    content_hash CHAR(64) NOT NULL,
+    is_binary BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (template_id, position)
+);
+
+CREATE INDEX idx_snippet_template_files_content_hash ON snippet_template_files(content_hash);
+
+CREATE TABLE snippet_views (
+    snippet_id INTEGER NOT NULL,
+    day DATE NOT NULL,
+    referrer VARCHAR(255) NOT NULL DEFAULT '',
+    views INTEGER NOT NULL,
+    PRIMARY KEY (snippet_id, day, referrer)
+);
+
+CREATE TABLE snippet_rankings (
+    ranking VARCHAR(20) NOT NULL,
+    position INTEGER NOT NULL,
+    snippet_id INTEGER NOT NULL,
+    score DOUBLE NOT NULL,
+    PRIMARY KEY (ranking, position)
+);
@@ -1,3 +1,35 @@
+DROP TABLE snippet_rankings;
+
+DROP TABLE snippet_views;
+
+DROP TABLE snippet_template_files;
+
+DROP TABLE snippet_templates;
+
+DROP TABLE contents;
+
+DROP TABLE snippet_files;
+
+DROP TABLE snippet_revisions;
+
+DROP TABLE comments;
+
+DROP TABLE stars;
+
+DROP TABLE invitations;
+
+DROP TABLE memberships;
+
+DROP TABLE organizations;
+
+DROP TABLE identities;
+
+DROP TABLE audit_log;
+
+DROP TABLE user_sessions;
+
+DROP TABLE login_attempts;
+
 DROP TABLE users;
 
 DROP TABLE snippets;
@@ -2,6 +2,8 @@ package mysql
 
 import (
 	"database/sql"
+	"fmt"
+	"github.com/luca0x333/go-snippetbox/pkg/models"
 	"io/ioutil"
 	"testing"
 )
@@ -42,3 +44,13 @@ func newTestDB(t *testing.T) (*sql.DB, func()) {
 		db.Close()
 	}
 }
+
+// textFiles returns plain text files holding the given contents, named "file1.txt", "file2.txt" and so on.
+func textFiles(contents ...string) []*models.File {
+	var files []*models.File
+	for i, content := range contents {
+		files = append(files, &models.File{Name: fmt.Sprintf("file%d.txt", i+1), Content: content})
+	}
+
+	return files
+}
@@ -1,51 +1,99 @@
 package mysql
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"encoding/base64"
 	"errors"
 	"github.com/go-sql-driver/mysql"
+	"github.com/luca0x333/go-snippetbox/pkg/auth"
 	"github.com/luca0x333/go-snippetbox/pkg/models"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/luca0x333/go-snippetbox/pkg/passwords"
+	"log"
 	"strings"
 )
 
 type UserModel struct {
 	DB *sql.DB
+	// Authenticators are the external credential backends, ex: an LDAP directory, tried by Authenticate before the
+	// local passwords. The failures of a backend are logged to ErrorLog and don't prevent local logins.
+	Authenticators []auth.Authenticator
+	ErrorLog       *log.Logger
 }
 
-// Inset adds a new record to the users table.
-func (m *UserModel) Insert(name, email, password string) error {
-	// Create a bcrypt hash of the plain-text password.
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+// Insert adds a new record to the users table and returns its ID.
+func (m *UserModel) Insert(name, email, password string) (int, error) {
+	// Create an argon2id hash of the plain-text password.
+	hashedPassword, err := passwords.Hash(password)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	stmt := `INSERT INTO users (name, email, hashed_password, created) VALUES(?, ?, ?, UTC_TIMESTAMP())`
 
 	// Use Exec() method to insert the user details and hashed password into the users table.
-	_, err = m.DB.Exec(stmt, name, email, string(hashedPassword))
+	result, err := m.DB.Exec(stmt, name, email, hashedPassword)
 	if err != nil {
 		// We check with errors.As() if the error is type *mysql.MySQLError.
 		// If it does we check if the error is related to "users_uc_email" and return ErrDuplicateEmail.
 		var mySQLError *mysql.MySQLError
 		if errors.As(err, &mySQLError) {
 			if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "users_uc_email") {
-				return models.ErrDuplicateEmail
+				return 0, models.ErrDuplicateEmail
 			}
 		}
-		return err
+		return 0, err
 	}
 
-	return nil
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
 }
 
-// Authenticate verify an user exist in the database.
+// Provision adds a user who authenticates with an external identity provider and returns its ID.
+// The user gets a random password so it can't be used to log in with the login form.
+func (m *UserModel) Provision(name, email string) (int, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return 0, err
+	}
+
+	return m.Insert(name, email, base64.RawStdEncoding.EncodeToString(b))
+}
+
+// Authenticate checks an email and a password against the external authenticators first, if any, then against
+// the local passwords, and returns the ID of the matching user.
+// It returns ErrInvalidCredentials if no backend accepts the credentials.
 func (m *UserModel) Authenticate(email, password string) (int, error) {
+	if len(m.Authenticators) == 0 {
+		return m.authenticateLocal(email, password)
+	}
+
+	authenticators := append([]auth.Authenticator{}, m.Authenticators...)
+	chain := &auth.Chain{Authenticators: append(authenticators, localPasswords{m}), ErrorLog: m.ErrorLog}
+	return chain.Authenticate(email, password)
+}
+
+// localPasswords authenticates users against the password hashes of the users table.
+type localPasswords struct {
+	m *UserModel
+}
+
+// Authenticate implements auth.Authenticator.
+func (l localPasswords) Authenticate(email, password string) (int, error) {
+	return l.m.authenticateLocal(email, password)
+}
+
+// authenticateLocal verify an user exist in the database.
+func (m *UserModel) authenticateLocal(email, password string) (int, error) {
 	// Get id and hashed password associated witn an email.
 	// If the email doesn't exist or the user is not active, we returns ErrInvalidCredentials error.
 	var id int
-	var hashedPassword []byte
+	var hashedPassword string
 	stmt := "SELECT id, hashed_password FROM users WHERE email = ? AND active = TRUE"
 	row := m.DB.QueryRow(stmt, email)
 	// Scan copies the columns from the matched row into the values
@@ -61,25 +109,155 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 
 	// Check if the hashed password the the plain-text password match.
 	// If they don't we return ErrInvalidCredentials error.
-	err = bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
+	needsRehash, err := passwords.Compare(hashedPassword, password)
 	if err != nil {
-		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		if errors.Is(err, passwords.ErrMismatch) {
 			return 0, models.ErrInvalidCredentials
 		} else {
 			return 0, err
 		}
 	}
 
+	// The password is only available in plain text now, so this is when a hash using an outdated algorithm
+	// or cost gets replaced.
+	if needsRehash {
+		err = m.rehash(id, hashedPassword, password)
+		if err != nil {
+			return 0, err
+		}
+	}
+
 	// Return user ID
 	return id, nil
 }
 
+// ChangePassword replaces the password of a user after checking their current password.
+// It returns ErrInvalidCredentials if the current password is wrong.
+func (m *UserModel) ChangePassword(id int, currentPassword, newPassword string) error {
+	var hashedPassword string
+	stmt := "SELECT hashed_password FROM users WHERE id = ?"
+	err := m.DB.QueryRow(stmt, id).Scan(&hashedPassword)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrNoRecord
+		} else {
+			return err
+		}
+	}
+
+	_, err = passwords.Compare(hashedPassword, currentPassword)
+	if err != nil {
+		if errors.Is(err, passwords.ErrMismatch) {
+			return models.ErrInvalidCredentials
+		} else {
+			return err
+		}
+	}
+
+	newHash, err := passwords.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	stmt = `UPDATE users SET hashed_password = ? WHERE id = ?`
+
+	_, err = m.DB.Exec(stmt, newHash, id)
+	return err
+}
+
+// rehash replaces the stored hash of a user's password with a fresh one.
+// The update is skipped if the stored hash has changed since it was read, so a password changed in the meantime
+// is never overwritten.
+func (m *UserModel) rehash(id int, oldHash, password string) error {
+	newHash, err := passwords.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	stmt := `UPDATE users SET hashed_password = ? WHERE id = ? AND hashed_password = ?`
+
+	_, err = m.DB.Exec(stmt, newHash, id, oldHash)
+	return err
+}
+
 // Get fetch details for a specific user.
 func (m *UserModel) Get(id int) (*models.User, error) {
 	u := &models.User{}
 
-	stmt := `SELECT id, name, email, created, active FROM users WHERE id = ?`
-	err := m.DB.QueryRow(stmt, id).Scan(&u.ID, &u.Name, &u.Email, &u.Created, &u.Active)
+	stmt := `SELECT id, name, email, created, active, is_admin FROM users WHERE id = ?`
+	err := m.DB.QueryRow(stmt, id).Scan(&u.ID, &u.Name, &u.Email, &u.Created, &u.Active, &u.IsAdmin)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNoRecord
+		} else {
+			return nil, err
+		}
+	}
+
+	return u, nil
+}
+
+// Search returns the users whose name or email contains a query string, the most recently created first.
+// An empty query matches every user. At most 50 users are returned.
+func (m *UserModel) Search(query string) ([]*models.User, error) {
+	stmt := `SELECT id, name, email, created, active, is_admin FROM users
+	WHERE name LIKE ? OR email LIKE ? ORDER BY created DESC LIMIT 50`
+
+	// Escape the LIKE wildcards so they are matched literally.
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(query) + "%"
+
+	rows, err := m.DB.Query(stmt, pattern, pattern)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*models.User{}
+	for rows.Next() {
+		u := &models.User{}
+		err := rows.Scan(&u.ID, &u.Name, &u.Email, &u.Created, &u.Active, &u.IsAdmin)
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// SetActive activates or deactivates a user. Deactivated users can't log in and their sessions stop working.
+func (m *UserModel) SetActive(id int, active bool) error {
+	stmt := `UPDATE users SET active = ? WHERE id = ?`
+
+	result, err := m.DB.Exec(stmt, active, id)
+	if err != nil {
+		return err
+	}
+
+	// RowsAffected counts the rows which actually changed, so check the user exists separately.
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		_, err = m.Get(id)
+		return err
+	}
+
+	return nil
+}
+
+// GetByEmail fetch details for the user with a specific email.
+func (m *UserModel) GetByEmail(email string) (*models.User, error) {
+	u := &models.User{}
+
+	stmt := `SELECT id, name, email, created, active, is_admin FROM users WHERE email = ?`
+	err := m.DB.QueryRow(stmt, email).Scan(&u.ID, &u.Name, &u.Email, &u.Created, &u.Active, &u.IsAdmin)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, models.ErrNoRecord
@@ -1,8 +1,12 @@
 package mysql
 
 import (
+	"errors"
+	"github.com/luca0x333/go-snippetbox/pkg/auth"
 	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"golang.org/x/crypto/bcrypt"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -54,7 +58,7 @@ func TestUserModel(t *testing.T) {
 			defer teardown()
 
 			// Create a new instance of the UserModel.
-			m := UserModel{db}
+			m := UserModel{DB: db}
 
 			// Call the UserModel.Get() method and check that the return value
 			// and error match the expected values for the sub-test.
@@ -70,3 +74,137 @@ func TestUserModel(t *testing.T) {
 		})
 	}
 }
+
+func TestUserModelAuthenticateRehash(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	m := UserModel{DB: db}
+
+	// Store a legacy bcrypt hash, as created before argon2id was introduced.
+	legacy, err := bcrypt.GenerateFromPassword([]byte("pa$$word"), 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("UPDATE users SET hashed_password = ? WHERE id = 1", string(legacy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.Authenticate("alice@example.com", "wrong")
+	if err != models.ErrInvalidCredentials {
+		t.Errorf("want %v; got %v", models.ErrInvalidCredentials, err)
+	}
+
+	id, err := m.Authenticate("alice@example.com", "pa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 {
+		t.Errorf("want ID 1; got %d", id)
+	}
+
+	var hashedPassword string
+	err = db.QueryRow("SELECT hashed_password FROM users WHERE id = 1").Scan(&hashedPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hashedPassword, "$argon2id$") {
+		t.Errorf("want an argon2id hash; got %q", hashedPassword)
+	}
+
+	// The upgraded hash still works.
+	_, err = m.Authenticate("alice@example.com", "pa$$word")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUserModelInsert(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	m := UserModel{DB: db}
+
+	id, err := m.Insert("Bob", "bob@example.com", "validPa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := m.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != "bob@example.com" {
+		t.Errorf("want the new user with ID %d; got %+v", id, user)
+	}
+
+	_, err = m.Insert("Bob", "bob@example.com", "validPa$$word")
+	if err != models.ErrDuplicateEmail {
+		t.Errorf("want %v; got %v", models.ErrDuplicateEmail, err)
+	}
+}
+
+// fakeDirectory accepts "carol@example.com" with the password "directory", and fails for "down@example.com" as
+// an unreachable server would.
+type fakeDirectory struct{}
+
+func (fakeDirectory) Authenticate(email, password string) (int, error) {
+	switch {
+	case email == "carol@example.com" && password == "directory":
+		return 7, nil
+	case email == "down@example.com":
+		return 0, errors.New("directory unreachable")
+	default:
+		return 0, models.ErrInvalidCredentials
+	}
+}
+
+func TestUserModelAuthenticateDirectory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	m := UserModel{DB: db, Authenticators: []auth.Authenticator{fakeDirectory{}}}
+
+	_, err := m.Insert("Dave", "down@example.com", "validPa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		email     string
+		password  string
+		wantID    int
+		wantError error
+	}{
+		{"Directory user", "carol@example.com", "directory", 7, nil},
+		{"Wrong directory password", "carol@example.com", "wrong", 0, models.ErrInvalidCredentials},
+		{"Local user while the directory is down", "down@example.com", "validPa$$word", 2, nil},
+		{"Wrong local password", "down@example.com", "wrong", 0, models.ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := m.Authenticate(tt.email, tt.password)
+			if err != tt.wantError {
+				t.Errorf("want %v; got %v", tt.wantError, err)
+			}
+			if id != tt.wantID {
+				t.Errorf("want ID %d; got %d", tt.wantID, id)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package mysql
+
+import (
+	"database/sql"
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"strings"
+	"time"
+)
+
+// ViewModel keeps the number of views of the snippets, per day and per referrer. Views are recorded in batches
+// aggregated by the application, not one at a time.
+type ViewModel struct {
+	DB *sql.DB
+}
+
+// viewBatchSize is the maximum number of rows inserted by a single statement.
+const viewBatchSize = 500
+
+// Record adds counts of views to the totals. Counts for the same snippet, day and referrer are summed.
+func (m *ViewModel) Record(counts []*models.ViewCount) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for len(counts) > 0 {
+		batch := counts
+		if len(batch) > viewBatchSize {
+			batch = batch[:viewBatchSize]
+		}
+		counts = counts[len(batch):]
+
+		stmt := `INSERT INTO snippet_views (snippet_id, day, referrer, views) VALUES` +
+			strings.TrimSuffix(strings.Repeat(`(?, ?, ?, ?),`, len(batch)), ",") +
+			` ON DUPLICATE KEY UPDATE views = views + VALUES(views)`
+
+		var args []interface{}
+		for _, c := range batch {
+			args = append(args, c.SnippetID, c.Day.UTC().Format("2006-01-02"), c.Referrer, c.Views)
+		}
+
+		_, err = tx.Exec(stmt, args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Daily returns the number of views of a snippet on each day since a date, oldest first. Days without views are
+// left out.
+func (m *ViewModel) Daily(snippetID int, since time.Time) ([]*models.DailyViews, error) {
+	stmt := `SELECT day, SUM(views) FROM snippet_views WHERE snippet_id = ? AND day >= ?
+	GROUP BY day ORDER BY day`
+
+	rows, err := m.DB.Query(stmt, snippetID, since.UTC().Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := []*models.DailyViews{}
+	for rows.Next() {
+		d := &models.DailyViews{}
+		err = rows.Scan(&d.Day, &d.Views)
+		if err != nil {
+			return nil, err
+		}
+		days = append(days, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return days, nil
+}
+
+// Referrers returns the sites which brought the most views to a snippet since a date, at most limit of them.
+func (m *ViewModel) Referrers(snippetID int, since time.Time, limit int) ([]*models.Referrer, error) {
+	stmt := `SELECT referrer, SUM(views) AS total FROM snippet_views WHERE snippet_id = ? AND day >= ?
+	GROUP BY referrer ORDER BY total DESC, referrer LIMIT ?`
+
+	rows, err := m.DB.Query(stmt, snippetID, since.UTC().Format("2006-01-02"), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	referrers := []*models.Referrer{}
+	for rows.Next() {
+		r := &models.Referrer{}
+		err = rows.Scan(&r.Host, &r.Views)
+		if err != nil {
+			return nil, err
+		}
+		referrers = append(referrers, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return referrers, nil
+}
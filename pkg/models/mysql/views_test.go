@@ -0,0 +1,69 @@
+package mysql
+
+import (
+	"github.com/luca0x333/go-snippetbox/pkg/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestViewModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	views := ViewModel{db}
+
+	monday := time.Date(2021, 3, 15, 0, 0, 0, 0, time.UTC)
+	tuesday := monday.AddDate(0, 0, 1)
+
+	// The second batch adds to the counts of the first one.
+	batches := [][]*models.ViewCount{
+		{
+			{SnippetID: 1, Day: monday, Referrer: "", Views: 2},
+			{SnippetID: 1, Day: monday, Referrer: "news.example", Views: 5},
+			{SnippetID: 2, Day: monday, Referrer: "", Views: 7},
+		},
+		{
+			{SnippetID: 1, Day: monday, Referrer: "", Views: 1},
+			{SnippetID: 1, Day: tuesday, Referrer: "blog.example", Views: 1},
+		},
+	}
+	for _, batch := range batches {
+		err := views.Record(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	daily, err := views.Daily(1, monday)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(daily) != 2 || !daily[0].Day.Equal(monday) || daily[0].Views != 8 || daily[1].Views != 1 {
+		t.Errorf("want 8 views on monday and 1 on tuesday; got %+v", daily)
+	}
+
+	daily, err = views.Daily(1, tuesday)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(daily) != 1 || !daily[0].Day.Equal(tuesday) {
+		t.Errorf("want only tuesday; got %+v", daily)
+	}
+
+	referrers, err := views.Referrers(1, monday, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*models.Referrer{{Host: "news.example", Views: 5}, {Host: "", Views: 3}}
+	if !reflect.DeepEqual(referrers, want) {
+		t.Errorf("want %+v; got %+v", want, referrers)
+	}
+}
@@ -0,0 +1,48 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"math/big"
+)
+
+// jsonWebKey is an RSA public key from a JWKS, as described in RFC 7517.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// verify checks an RS256 signature of a signing input.
+func (k *jsonWebKey) verify(signingInput string, signature []byte) error {
+	pub, err := k.publicKey()
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256([]byte(signingInput))
+	return rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], signature)
+}
+
+func (k *jsonWebKey) publicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, err
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 || exponent.Int64() < 2 {
+		return nil, errors.New("oidc: invalid RSA exponent")
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
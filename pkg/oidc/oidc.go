@@ -0,0 +1,341 @@
+// Package oidc implements the parts of OpenID Connect needed to log users in with an external identity
+// provider: discovery, the authorization code flow with PKCE, and the validation of RS256 signed ID tokens
+// against the provider's JWKS.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("oidc: invalid ID token")
+	ErrUnknownKey   = errors.New("oidc: ID token signed with an unknown key")
+)
+
+// Config holds the settings of the OpenID Connect client registered with the provider.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// Scopes defaults to "openid email profile".
+	Scopes []string
+	// HTTPClient defaults to a client with a 10 seconds timeout.
+	HTTPClient *http.Client
+}
+
+// Claims are the claims of a validated ID token used to identify the user.
+type Claims struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Provider is an OpenID Connect provider discovered from its issuer URL.
+type Provider struct {
+	config                Config
+	authorizationEndpoint string
+	tokenEndpoint         string
+	jwksURI               string
+
+	mu   sync.Mutex
+	keys map[string]*jsonWebKey
+}
+
+// NewProvider fetches the discovery document of the issuer and returns the matching Provider.
+func NewProvider(ctx context.Context, config Config) (*Provider, error) {
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	var doc struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+	wellKnown := strings.TrimSuffix(config.Issuer, "/") + "/.well-known/openid-configuration"
+	err := getJSON(ctx, config.HTTPClient, wellKnown, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	// The issuer in the document must be the one we asked for, otherwise tokens would never validate.
+	if doc.Issuer != config.Issuer {
+		return nil, fmt.Errorf("oidc: issuer mismatch, want %q got %q", config.Issuer, doc.Issuer)
+	}
+
+	return &Provider{
+		config:                config,
+		authorizationEndpoint: doc.AuthorizationEndpoint,
+		tokenEndpoint:         doc.TokenEndpoint,
+		jwksURI:               doc.JWKSURI,
+	}, nil
+}
+
+// RandomString returns a random URL safe string suitable for a state, a nonce or a PKCE code verifier.
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// codeChallenge returns the S256 PKCE code challenge of a code verifier.
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the URL of the provider's authorization endpoint the user must be redirected to.
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.config.ClientID)
+	v.Set("redirect_uri", p.config.RedirectURL)
+	v.Set("scope", strings.Join(p.config.Scopes, " "))
+	v.Set("state", state)
+	v.Set("nonce", nonce)
+	v.Set("code_challenge", codeChallenge(verifier))
+	v.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(p.authorizationEndpoint, "?") {
+		sep = "&"
+	}
+
+	return p.authorizationEndpoint + sep + v.Encode()
+}
+
+// Exchange trades an authorization code for tokens at the token endpoint and returns the raw ID token.
+// The ID token still has to be validated with Verify.
+func (p *Provider) Exchange(ctx context.Context, code, verifier string) (string, error) {
+	v := url.Values{}
+	v.Set("grant_type", "authorization_code")
+	v.Set("code", code)
+	v.Set("redirect_uri", p.config.RedirectURL)
+	v.Set("code_verifier", verifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenEndpoint, strings.NewReader(v.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+
+	rs, err := p.config.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer rs.Body.Close()
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	err = json.NewDecoder(io.LimitReader(rs.Body, 1<<20)).Decode(&token)
+	if err != nil {
+		return "", fmt.Errorf("oidc: token response: %w", err)
+	}
+
+	if rs.StatusCode != http.StatusOK || token.Error != "" {
+		return "", fmt.Errorf("oidc: token endpoint returned %d: %s %s", rs.StatusCode, token.Error,
+			token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return "", errors.New("oidc: token response without id_token")
+	}
+
+	return token.IDToken, nil
+}
+
+// Verify validates the signature and the claims of an ID token and returns the claims identifying the user.
+func (p *Provider) Verify(ctx context.Context, rawIDToken, nonce string) (*Claims, error) {
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	err := decodeSegment(parts[0], &header)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	// Only accept RS256: letting the token pick its algorithm is how "alg: none" attacks happen.
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, header.Alg)
+	}
+
+	key, err := p.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	err = key.verify(parts[0]+"."+parts[1], signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	}
+
+	var claims struct {
+		Issuer        string          `json:"iss"`
+		Subject       string          `json:"sub"`
+		Audience      audience        `json:"aud"`
+		Expiry        int64           `json:"exp"`
+		Nonce         string          `json:"nonce"`
+		Email         string          `json:"email"`
+		EmailVerified json.RawMessage `json:"email_verified"`
+		Name          string          `json:"name"`
+	}
+	err = decodeSegment(parts[1], &claims)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	switch {
+	case claims.Issuer != p.config.Issuer:
+		return nil, fmt.Errorf("%w: wrong issuer", ErrInvalidToken)
+	case !claims.Audience.contains(p.config.ClientID):
+		return nil, fmt.Errorf("%w: wrong audience", ErrInvalidToken)
+	case time.Now().Add(-time.Minute).After(time.Unix(claims.Expiry, 0)):
+		return nil, fmt.Errorf("%w: expired", ErrInvalidToken)
+	case claims.Nonce != nonce:
+		return nil, fmt.Errorf("%w: wrong nonce", ErrInvalidToken)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidToken)
+	}
+
+	// Some providers send email_verified as a string.
+	verified := string(claims.EmailVerified)
+
+	return &Claims{
+		Issuer:        claims.Issuer,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: verified == "true" || verified == `"true"`,
+		Name:          claims.Name,
+	}, nil
+}
+
+// key returns the key with a given ID from the provider's JWKS. The key set is cached and fetched again when
+// a token refers to a key we don't know, which is how providers rotate their keys.
+func (p *Provider) key(ctx context.Context, kid string) (*jsonWebKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	var set struct {
+		Keys []*jsonWebKey `json:"keys"`
+	}
+	err := getJSON(ctx, p.config.HTTPClient, p.jwksURI, &set)
+	if err != nil {
+		return nil, err
+	}
+
+	p.keys = map[string]*jsonWebKey{}
+	for _, key := range set.Keys {
+		if key.Kty == "RSA" && (key.Use == "" || key.Use == "sig") {
+			p.keys[key.Kid] = key
+		}
+	}
+
+	key, ok := p.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	return key, nil
+}
+
+// audience is the "aud" claim, which can be a single string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		*a = audience{s}
+		return nil
+	}
+
+	var ss []string
+	err := json.Unmarshal(b, &ss)
+	if err != nil {
+		return err
+	}
+	*a = ss
+
+	return nil
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// decodeSegment decodes a base64url encoded JSON segment of a JWT into v.
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+// getJSON fetches a URL and decodes the JSON response into v.
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	rs, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rs.Body.Close()
+
+	if rs.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, rs.Body)
+		return fmt.Errorf("oidc: GET %s returned %d", url, rs.StatusCode)
+	}
+
+	return json.NewDecoder(io.LimitReader(rs.Body, 1<<20)).Decode(v)
+}
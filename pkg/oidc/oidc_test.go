@@ -0,0 +1,152 @@
+package oidc
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"github.com/luca0x333/go-snippetbox/pkg/oidc/oidctest"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestProvider starts a fake identity provider and returns a Provider discovered from it.
+func newTestProvider(t *testing.T) (*Provider, *oidctest.Server) {
+	idp := oidctest.NewServer("snippetbox", "secret", oidctest.User{
+		Subject:       "alice",
+		Email:         "alice@example.com",
+		EmailVerified: true,
+		Name:          "Alice Jones",
+	})
+
+	p, err := NewProvider(context.Background(), Config{
+		Issuer:       idp.Issuer(),
+		ClientID:     "snippetbox",
+		ClientSecret: "secret",
+		RedirectURL:  "https://snippetbox.example.com/user/login/sso/callback",
+	})
+	if err != nil {
+		idp.Close()
+		t.Fatal(err)
+	}
+
+	return p, idp
+}
+
+// authorize follows the authorization URL and returns the code and state sent back to the redirect URL.
+func authorize(t *testing.T, authURL string) (string, string) {
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	rs, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+
+	location, err := url.Parse(rs.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	p, idp := newTestProvider(t)
+	defer idp.Close()
+
+	ctx := context.Background()
+	code, state := authorize(t, p.AuthCodeURL("state", "nonce", "verifier"))
+	if state != "state" {
+		t.Errorf("want state %q; got %q", "state", state)
+	}
+
+	// A wrong code verifier must be refused: that's the point of PKCE.
+	_, err := p.Exchange(ctx, code, "wrong-verifier")
+	if err == nil {
+		t.Error("want an error for a wrong code verifier")
+	}
+
+	code, _ = authorize(t, p.AuthCodeURL("state", "nonce", "verifier"))
+	rawIDToken, err := p.Exchange(ctx, code, "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := p.Verify(ctx, rawIDToken, "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Claims{
+		Issuer:        idp.Issuer(),
+		Subject:       "alice",
+		Email:         "alice@example.com",
+		EmailVerified: true,
+		Name:          "Alice Jones",
+	}
+	if *claims != want {
+		t.Errorf("want %+v; got %+v", want, *claims)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	p, idp := newTestProvider(t)
+	defer idp.Close()
+
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":   idp.Issuer(),
+			"sub":   "alice",
+			"aud":   "snippetbox",
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"nonce": "nonce",
+		}
+	}
+	with := func(key string, value interface{}) string {
+		claims := valid()
+		claims[key] = value
+		return idp.Sign(claims)
+	}
+
+	// An unsigned token claiming to use the "none" algorithm.
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"iss":"` + idp.Issuer() + `","sub":"alice"}`))
+
+	// A valid token with a tampered payload.
+	parts := strings.Split(idp.Sign(valid()), ".")
+	parts[1] = payload
+
+	tests := []struct {
+		name      string
+		token     string
+		wantError error
+	}{
+		{"Valid", idp.Sign(valid()), nil},
+		{"Audience array", with("aud", []string{"other", "snippetbox"}), nil},
+		{"Wrong issuer", with("iss", "https://evil.example.com"), ErrInvalidToken},
+		{"Wrong audience", with("aud", "other"), ErrInvalidToken},
+		{"Expired", with("exp", time.Now().Add(-time.Hour).Unix()), ErrInvalidToken},
+		{"Wrong nonce", with("nonce", "other"), ErrInvalidToken},
+		{"Missing subject", with("sub", ""), ErrInvalidToken},
+		{"Algorithm none", header + "." + payload + ".", ErrInvalidToken},
+		{"Tampered payload", strings.Join(parts, "."), ErrInvalidToken},
+		{"Malformed", "not-a-token", ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := p.Verify(context.Background(), tt.token, "nonce")
+
+			if !errors.Is(err, tt.wantError) {
+				t.Errorf("want %v; got %v", tt.wantError, err)
+			}
+		})
+	}
+}
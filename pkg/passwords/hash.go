@@ -0,0 +1,131 @@
+// Package passwords hashes and verifies user passwords.
+//
+// New hashes use argon2id, encoded in the PHC string format:
+//
+//	$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+//
+// Legacy bcrypt hashes are still verified, and Compare reports when a hash should be replaced so that stored
+// passwords are upgraded the next time their owner logs in.
+package passwords
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+var (
+	// ErrMismatch is returned by Compare when the password doesn't match the hash.
+	ErrMismatch = errors.New("passwords: hash and password don't match")
+	// ErrUnknownFormat is returned by Compare when the hash isn't a supported argon2id or bcrypt hash.
+	ErrUnknownFormat = errors.New("passwords: unknown hash format")
+)
+
+// Params are the argon2id cost parameters.
+type Params struct {
+	Memory      uint32 // in KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultParams are the parameters used for new hashes. Hashes created with weaker parameters are reported as
+// needing a rehash.
+var DefaultParams = Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Hash returns a PHC formatted argon2id hash of password using DefaultParams.
+func Hash(password string) (string, error) {
+	return hash(password, DefaultParams)
+}
+
+func hash(password string, p Params) (string, error) {
+	salt := make([]byte, p.SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.Memory, p.Iterations,
+		p.Parallelism, base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Compare checks password against an argon2id or bcrypt hash. It returns ErrMismatch if they don't match.
+// When they do, needsRehash reports whether the hash uses an outdated algorithm or weaker parameters than
+// DefaultParams and should be replaced by a fresh Hash of the password.
+func Compare(hashed, password string) (needsRehash bool, err error) {
+	switch {
+	case strings.HasPrefix(hashed, "$argon2id$"):
+		return compareArgon2id(hashed, password)
+	case strings.HasPrefix(hashed, "$2a$"), strings.HasPrefix(hashed, "$2b$"), strings.HasPrefix(hashed, "$2y$"):
+		err := bcrypt.CompareHashAndPassword([]byte(hashed), []byte(password))
+		if err != nil {
+			if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				return false, ErrMismatch
+			}
+			return false, err
+		}
+
+		// Any bcrypt hash is outdated.
+		return true, nil
+	default:
+		return false, ErrUnknownFormat
+	}
+}
+
+func compareArgon2id(hashed, password string) (bool, error) {
+	// The hash splits into "", "argon2id", "v=19", "m=...,t=...,p=...", salt and key.
+	parts := strings.Split(hashed, "$")
+	if len(parts) != 6 {
+		return false, ErrUnknownFormat
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return false, ErrUnknownFormat
+	}
+
+	var p Params
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism)
+	if err != nil || p.Iterations == 0 || p.Parallelism == 0 {
+		return false, ErrUnknownFormat
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, ErrUnknownFormat
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return false, ErrUnknownFormat
+	}
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+
+	other := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return false, ErrMismatch
+	}
+
+	return weaker(p, DefaultParams), nil
+}
+
+// weaker reports whether any of the parameters of p is weaker than the matching one of target.
+func weaker(p, target Params) bool {
+	return p.Memory < target.Memory || p.Iterations < target.Iterations || p.Parallelism < target.Parallelism ||
+		p.SaltLength < target.SaltLength || p.KeyLength < target.KeyLength
+}
@@ -0,0 +1,59 @@
+package passwords
+
+import (
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	current, err := Hash("pa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(current, "$argon2id$v=19$m=65536,t=3,p=2$") {
+		t.Fatalf("unexpected hash format %q", current)
+	}
+
+	weak, err := hash("pa$$word", Params{Memory: 16 * 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	legacy, err := bcrypt.GenerateFromPassword([]byte("pa$$word"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		hash            string
+		password        string
+		wantNeedsRehash bool
+		wantError       error
+	}{
+		{"Current argon2id", current, "pa$$word", false, nil},
+		{"Weak argon2id", weak, "pa$$word", true, nil},
+		{"Bcrypt", string(legacy), "pa$$word", true, nil},
+		{"Wrong password", current, "password", false, ErrMismatch},
+		{"Wrong bcrypt password", string(legacy), "password", false, ErrMismatch},
+		{"Unknown algorithm", "$argon2i$v=19$m=65536,t=3,p=2$c2FsdA$a2V5", "pa$$word", false, ErrUnknownFormat},
+		{"Wrong version", strings.Replace(current, "v=19", "v=16", 1), "pa$$word", false, ErrUnknownFormat},
+		{"Malformed", "$argon2id$v=19$m=65536,t=3,p=2$c2FsdA", "pa$$word", false, ErrUnknownFormat},
+		{"Empty", "", "pa$$word", false, ErrUnknownFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			needsRehash, err := Compare(tt.hash, tt.password)
+
+			if !errors.Is(err, tt.wantError) {
+				t.Errorf("want %v; got %v", tt.wantError, err)
+			}
+			if needsRehash != tt.wantNeedsRehash {
+				t.Errorf("want needsRehash %t; got %t", tt.wantNeedsRehash, needsRehash)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package passwords
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Reasons a password is refused by a Policy, worded to be shown next to the password field of a form.
+const (
+	ReasonBreached     = "This password has appeared in a data breach, please choose another one"
+	ReasonPersonalInfo = "This password must not contain your name or email address"
+	ReasonGuessable    = "This password is too easy to guess, try a longer one or mix different kinds of characters"
+)
+
+// Policy decides which passwords users are allowed to choose.
+// The zero value accepts every password.
+type Policy struct {
+	// Breached, if not nil, is a corpus of breached passwords which are refused.
+	Breached *Corpus
+	// RejectPersonalInfo refuses passwords containing the user's name or email address.
+	RejectPersonalInfo bool
+	// MinEntropy is the minimum estimated entropy of a password, in bits.
+	MinEntropy float64
+}
+
+// Check returns the reasons why password is refused, or none if it is accepted.
+// The personal values, such as the user's name and email address, are used by the RejectPersonalInfo rule.
+// The error is only set if the breached password corpus can't be read.
+func (p *Policy) Check(password string, personal ...string) ([]string, error) {
+	var reasons []string
+
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return nil, err
+		}
+		if breached {
+			reasons = append(reasons, ReasonBreached)
+		}
+	}
+
+	if p.RejectPersonalInfo && containsPersonalInfo(password, personal) {
+		reasons = append(reasons, ReasonPersonalInfo)
+	}
+
+	if p.MinEntropy > 0 && Entropy(password) < p.MinEntropy {
+		reasons = append(reasons, ReasonGuessable)
+	}
+
+	return reasons, nil
+}
+
+// minPersonalLength is the length under which personal words are ignored, so a user called "Al" may still use
+// "always" in their password.
+const minPersonalLength = 3
+
+// containsPersonalInfo reports whether password contains, ignoring case, any of the personal values or any of
+// their words. Email addresses are checked as a whole and by their local part.
+func containsPersonalInfo(password string, personal []string) bool {
+	password = strings.ToLower(password)
+
+	for _, value := range personal {
+		value = strings.ToLower(strings.TrimSpace(value))
+
+		words := []string{value}
+		if i := strings.LastIndex(value, "@"); i >= 0 {
+			words = append(words, value[:i])
+		} else {
+			words = append(words, strings.FieldsFunc(value, func(r rune) bool {
+				return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+			})...)
+		}
+
+		for _, w := range words {
+			if len([]rune(w)) >= minPersonalLength && strings.Contains(password, w) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Entropy estimates the entropy of a password in bits, as the number of characters times the bits needed to
+// pick each one from the pool of the kinds of characters used (lower case, upper case, digits, symbols and
+// anything else).
+// Characters repeating the previous one or continuing a sequence, like "aaa" or "1234", barely count.
+func Entropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	var effective float64
+	var prev rune
+	var step int
+
+	for i, r := range []rune(password) {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+
+		d := int(r - prev)
+		switch {
+		case i == 0:
+			effective++
+		case d == 0 || (i > 1 && d == step && (d == 1 || d == -1)):
+			effective += 0.25
+		default:
+			effective++
+		}
+		prev, step = r, d
+	}
+
+	pool := 0
+	for _, c := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if c.used {
+			pool += c.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+
+	return effective * math.Log2(float64(pool))
+}
+
+// Corpus is a corpus of breached passwords stored as a directory of files in the Have I Been Pwned range format.
+// Each file is named after the first 5 hexadecimal characters of the SHA-1 hash of the passwords it holds and
+// contains a line per password with the remaining 35 characters of the hash and how many times it was seen:
+//
+//	0018A45C4D1DEF81644B54AB7F969B88D65:21
+//
+// Lines with a count of 0 are padding and are ignored.
+type Corpus struct {
+	Dir string
+}
+
+// Contains reports whether password is in the corpus. A missing range file means no password in that range
+// was breached.
+func (c *Corpus) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	f, err := os.Open(filepath.Join(c.Dir, prefix))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		i := strings.IndexByte(line, ':')
+		if i < 0 || !strings.EqualFold(line[:i], suffix) {
+			continue
+		}
+
+		count, err := strconv.Atoi(line[i+1:])
+		if err != nil {
+			return false, err
+		}
+
+		return count > 0, nil
+	}
+
+	return false, scanner.Err()
+}
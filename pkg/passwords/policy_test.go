@@ -0,0 +1,76 @@
+package passwords
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	policy := &Policy{
+		Breached:           &Corpus{Dir: "./testdata/breached"},
+		RejectPersonalInfo: true,
+		MinEntropy:         40,
+	}
+
+	tests := []struct {
+		name        string
+		password    string
+		wantReasons []string
+	}{
+		{"Valid", "validPa$$word", nil},
+		{"Breached", "password1234", []string{ReasonBreached}},
+		{"Padding line", "padded-password", nil},
+		{"Name", "xX-AliceJones-Xx", []string{ReasonPersonalInfo}},
+		{"Email local part", "ajones-rules-2020", []string{ReasonPersonalInfo}},
+		{"Repeated characters", "aaaaaaaaaaaaaaaa", []string{ReasonGuessable}},
+		{"Sequence", "abcdefghijklmnop", []string{ReasonGuessable}},
+		{"Repeated name", "alicealicealice", []string{ReasonPersonalInfo}},
+		{"Personal and guessable", "jones111111", []string{ReasonPersonalInfo, ReasonGuessable}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reasons, err := policy.Check(tt.password, "Alice Jones", "ajones@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(reasons, tt.wantReasons) {
+				t.Errorf("want %q; got %q", tt.wantReasons, reasons)
+			}
+		})
+	}
+}
+
+func TestPolicyZeroValue(t *testing.T) {
+	reasons, err := (&Policy{}).Check("a", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reasons != nil {
+		t.Errorf("want no reasons; got %q", reasons)
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	tests := []struct {
+		password string
+		want     float64
+	}{
+		{"", 0},
+		{"aaaa", 1.75 * 4.700439718141092},
+		{"abcd", 2.5 * 4.700439718141092},
+		{"dcba", 2.5 * 4.700439718141092},
+		{"a1B$", 4 * 6.569855608330948},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			got := Entropy(tt.password)
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("want %v; got %v", tt.want, got)
+			}
+		})
+	}
+}
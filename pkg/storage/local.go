@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Local stores blobs as files of a directory, the slashes of keys making subdirectories.
+type Local struct {
+	Dir string
+}
+
+// path returns the path of the file of the blob stored under key. Keys which could point outside the directory
+// are refused.
+func (l *Local) path(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || strings.HasPrefix(key, "../") ||
+		key == ".." || strings.Contains(key, `\`) {
+		return "", fmt.Errorf("storage: invalid key %q", key)
+	}
+
+	return filepath.Join(l.Dir, filepath.FromSlash(key)), nil
+}
+
+// Put implements BlobStore. The blob is written to a temporary file first, so readers never see half of it.
+func (l *Local) Put(key string, data []byte) error {
+	name, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(name), 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(name), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(data)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), name)
+}
+
+// Get implements BlobStore.
+func (l *Local) Get(key string) ([]byte, error) {
+	name, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+
+	return data, err
+}
+
+// Delete implements BlobStore.
+func (l *Local) Delete(key string) error {
+	name, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
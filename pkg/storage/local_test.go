@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestLocal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	testBlobStore(t, &Local{Dir: dir})
+}
+
+func TestLocalInvalidKeys(t *testing.T) {
+	store := &Local{Dir: "/nonexistent"}
+
+	for _, key := range []string{"", "/etc/passwd", "../secret", "contents/../../secret", "contents//abc", `a\b`} {
+		t.Run(key, func(t *testing.T) {
+			err := store.Put(key, []byte("data"))
+			if err == nil {
+				t.Error("want an error")
+			}
+		})
+	}
+}
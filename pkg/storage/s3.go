@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3 stores blobs as objects of a bucket of an S3 compatible object store, like Amazon S3 or MinIO.
+// Requests are signed with AWS Signature Version 4 and use path-style URLs: Endpoint/Bucket/key.
+type S3 struct {
+	Endpoint  string // ex: "https://s3.eu-west-1.amazonaws.com" or "http://localhost:9000"
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// Client sends the requests, a client with a 30 second timeout if nil.
+	Client *http.Client
+	// Timeout of each request, response body included, whatever the client. Defaults to 30 seconds.
+	Timeout time.Duration
+}
+
+var defaultClient = &http.Client{Timeout: 30 * time.Second}
+
+// Put implements BlobStore.
+func (s *S3) Put(key string, data []byte) error {
+	rs, body, err := s.do(http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+
+	if rs.StatusCode != http.StatusOK {
+		return s.error(http.MethodPut, key, rs, body)
+	}
+
+	return nil
+}
+
+// Get implements BlobStore.
+func (s *S3) Get(key string) ([]byte, error) {
+	rs, body, err := s.do(http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	switch rs.StatusCode {
+	case http.StatusOK:
+		return body, nil
+	case http.StatusNotFound:
+		return nil, ErrNotFound
+	default:
+		return nil, s.error(http.MethodGet, key, rs, body)
+	}
+}
+
+// Delete implements BlobStore. S3 answers 204 No Content whether the object existed or not.
+func (s *S3) Delete(key string) error {
+	rs, body, err := s.do(http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+
+	if rs.StatusCode != http.StatusNoContent && rs.StatusCode != http.StatusOK {
+		return s.error(http.MethodDelete, key, rs, body)
+	}
+
+	return nil
+}
+
+// do sends a signed request about the object stored under key, and returns the response with its body read.
+// The request is canceled once the timeout is over, so a stalled object store can't hold a request forever.
+func (s *S3) do(method, key string, body []byte) (*http.Response, []byte, error) {
+	u, err := url.Parse(strings.TrimSuffix(s.Endpoint, "/"))
+	if err != nil {
+		return nil, nil, err
+	}
+	u.Path = u.Path + "/" + s.Bucket + "/" + key
+	u.RawPath = uriEncode(u.Path, false)
+
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sum := sha256.Sum256(body)
+	signV4(req, hex.EncodeToString(sum[:]), s.AccessKey, s.SecretKey, s.Region, time.Now())
+
+	client := s.Client
+	if client == nil {
+		client = defaultClient
+	}
+
+	rs, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rs.Body.Close()
+
+	data, err := ioutil.ReadAll(rs.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return rs, data, nil
+}
+
+// error returns the error of an unexpected response, with the start of the error document S3 sends in it.
+func (s *S3) error(method, key string, rs *http.Response, body []byte) error {
+	if len(body) > 512 {
+		body = body[:512]
+	}
+	return fmt.Errorf("storage: S3 %s %s: %s: %s", method, key, rs.Status, bytes.TrimSpace(body))
+}
+
+// signV4 signs a request with AWS Signature Version 4 for the S3 service, adding the Authorization header.
+// payloadHash is the hex encoded SHA-256 hash of the body. Every header already set on the request is signed,
+// along with the host.
+func signV4(req *http.Request, payloadHash, accessKey, secretKey, region string, t time.Time) {
+	amzDate := t.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	names := []string{"host"}
+	for name := range req.Header {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+
+	var headers strings.Builder
+	for _, name := range names {
+		value := host
+		if name != "host" {
+			value = strings.Join(req.Header.Values(name), ",")
+		}
+		fmt.Fprintf(&headers, "%s:%s\n", name, strings.TrimSpace(value))
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		canonicalQuery(req.URL.Query()),
+		headers.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hashHex(canonicalRequest)
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s,SignedHeaders=%s,Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+// canonicalQuery returns the query string of a request as signed: sorted, with its names and values encoded.
+func canonicalQuery(query url.Values) string {
+	var params []string
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, uriEncode(name, true)+"="+uriEncode(value, true))
+		}
+	}
+	sort.Strings(params)
+
+	return strings.Join(params, "&")
+}
+
+// uriEncode percent-encodes every byte of s but the unreserved characters of RFC 3986, as signatures expect.
+// Slashes are kept unless encodeSlash is set. An empty path is "/".
+func uriEncode(s string, encodeSlash bool) string {
+	if s == "" && !encodeSlash {
+		return "/"
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '.', c == '_', c == '~':
+			sb.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			sb.WriteByte(c)
+		default:
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+
+	return sb.String()
+}
+
+func hashHex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,172 @@
+// Package s3test provides an in-process stand-in for an S3 compatible object store, for tests.
+package s3test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Server is a fake object store with a single bucket. It supports the PUT, GET and DELETE object requests with
+// path-style URLs, and checks they are signed with AWS Signature Version 4 by the expected credentials.
+type Server struct {
+	*httptest.Server
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+// NewServer starts a fake object store holding an empty bucket.
+// The caller should call Close when finished, to shut it down.
+func NewServer(region, bucket, accessKey, secretKey string) *Server {
+	s := &Server{
+		Region:    region,
+		Bucket:    bucket,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		objects:   map[string][]byte{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+
+	return s
+}
+
+// Object returns the object stored under key, and whether there is one.
+func (s *Server) Object(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.objects[key]
+	return data, ok
+}
+
+// Len returns the number of objects stored.
+func (s *Server) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.objects)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		s.fail(w, http.StatusBadRequest, "IncompleteBody")
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+		s.fail(w, http.StatusBadRequest, "XAmzContentSHA256Mismatch")
+		return
+	}
+
+	if !s.validSignature(r) {
+		s.fail(w, http.StatusForbidden, "SignatureDoesNotMatch")
+		return
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	if parts[0] != s.Bucket {
+		s.fail(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	if len(parts) < 2 || parts[1] == "" {
+		s.fail(w, http.StatusNotImplemented, "NotImplemented")
+		return
+	}
+	key := parts[1]
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		s.objects[key] = body
+	case http.MethodGet:
+		data, ok := s.objects[key]
+		if !ok {
+			s.fail(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Write(data)
+	case http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s.fail(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+// validSignature reports whether the Authorization header of a request holds the signature of its signed
+// headers by the expected credentials.
+func (s *Server) validSignature(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 ") {
+		return false
+	}
+
+	fields := map[string]string{}
+	for _, field := range strings.Split(strings.TrimPrefix(auth, "AWS4-HMAC-SHA256 "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(kv) == 2 {
+			fields[kv[0]] = kv[1]
+		}
+	}
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	if len(amzDate) < 8 {
+		return false
+	}
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", amzDate[:8], s.Region)
+	if fields["Credential"] != s.AccessKey+"/"+scope {
+		return false
+	}
+
+	names := strings.Split(fields["SignedHeaders"], ";")
+	if !sort.StringsAreSorted(names) {
+		return false
+	}
+
+	var headers strings.Builder
+	for _, name := range names {
+		value := strings.Join(r.Header.Values(name), ",")
+		if name == "host" {
+			value = r.Host
+		}
+		headers.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+
+	// The requests of the store have no query string.
+	canonicalRequest := r.Method + "\n" + r.URL.EscapedPath() + "\n\n" + headers.String() + "\n" +
+		fields["SignedHeaders"] + "\n" + r.Header.Get("X-Amz-Content-Sha256")
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := []byte("AWS4" + s.SecretKey)
+	for _, data := range []string{amzDate[:8], s.Region, "s3", "aws4_request", stringToSign} {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(data))
+		key = mac.Sum(nil)
+	}
+
+	return hmac.Equal([]byte(fields["Signature"]), []byte(hex.EncodeToString(key)))
+}
+
+// fail sends an S3 error document.
+func (s *Server) fail(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>%s</Code></Error>`, code)
+}
@@ -0,0 +1,20 @@
+// Package storage stores blobs, large pieces of data kept outside the database, in a directory or in an S3
+// compatible object store.
+package storage
+
+import (
+	"errors"
+)
+
+// ErrNotFound is returned by BlobStore.Get when there is no blob with the given key.
+var ErrNotFound = errors.New("storage: blob not found")
+
+// BlobStore stores blobs by key. Keys are slash separated paths, ex: "contents/3a7bd3e2".
+type BlobStore interface {
+	// Put stores data under key, replacing the blob already stored under it if any.
+	Put(key string, data []byte) error
+	// Get returns the blob stored under key, or ErrNotFound.
+	Get(key string) ([]byte, error)
+	// Delete deletes the blob stored under key. Deleting a blob which doesn't exist isn't an error.
+	Delete(key string) error
+}
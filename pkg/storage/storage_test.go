@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"bytes"
+	"testing"
+)
+
+// testBlobStore checks a blob store stores, replaces and deletes blobs.
+func testBlobStore(t *testing.T, store BlobStore) {
+	t.Helper()
+
+	_, err := store.Get("contents/abc")
+	if err != ErrNotFound {
+		t.Errorf("want %v for a missing blob; got %v", ErrNotFound, err)
+	}
+
+	for _, data := range [][]byte{[]byte("port: 4000"), []byte("port: 4001 \x00\xff")} {
+		err = store.Put("contents/abc", data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := store.Get("contents/abc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("want %q; got %q", data, got)
+		}
+	}
+
+	err = store.Delete("contents/abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.Get("contents/abc")
+	if err != ErrNotFound {
+		t.Errorf("want %v for a deleted blob; got %v", ErrNotFound, err)
+	}
+
+	// Deleting a missing blob isn't an error.
+	err = store.Delete("contents/abc")
+	if err != nil {
+		t.Errorf("want no error deleting a missing blob; got %v", err)
+	}
+}
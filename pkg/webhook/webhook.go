@@ -0,0 +1,91 @@
+// Package webhook notifies other services of events by sending them JSON documents over HTTP.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// SignatureHeader is the header holding the signature of the body of a request, when the Notifier has a secret:
+// "sha256=" followed by the hex encoded HMAC-SHA256 of the body keyed by the secret.
+const SignatureHeader = "X-Snippetbox-Signature"
+
+// EventHeader is the header holding the type of the event a request is about.
+const EventHeader = "X-Snippetbox-Event"
+
+// Notifier posts events to a list of URLs.
+type Notifier struct {
+	URLs []string
+	// Secret, if set, signs the requests so receivers can check they come from this application.
+	Secret string
+	// Client sends the requests, a client with a 10 second timeout if nil.
+	Client *http.Client
+}
+
+var defaultClient = &http.Client{Timeout: 10 * time.Second}
+
+// Notify posts an event, with its payload encoded as JSON, to every URL. The URLs are all tried even when one of
+// them fails, the first error is returned. Any 2xx response is a success.
+func (n *Notifier) Notify(event string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	var first error
+	for _, url := range n.URLs {
+		err := n.post(url, event, body)
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
+
+func (n *Notifier) post(url, event string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event)
+	if n.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(n.Secret, body))
+	}
+
+	client := n.Client
+	if client == nil {
+		client = defaultClient
+	}
+
+	rs, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rs.Body.Close()
+
+	// Drain the body so the connection can be reused.
+	io.Copy(ioutil.Discard, io.LimitReader(rs.Body, 1<<20))
+
+	if rs.StatusCode < 200 || rs.StatusCode > 299 {
+		return fmt.Errorf("webhook: POST %s: %s", url, rs.Status)
+	}
+
+	return nil
+}
+
+// Sign returns the value of the SignatureHeader of a request with the given body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
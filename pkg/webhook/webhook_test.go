@@ -0,0 +1,54 @@
+package webhook
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSign(t *testing.T) {
+	// Test vector of the HMAC-SHA256 test cases of RFC 4231, test case 2.
+	want := "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+	if got := Sign("Jefe", []byte("what do ya want for nothing?")); got != want {
+		t.Errorf("want %q; got %q", want, got)
+	}
+}
+
+func TestNotify(t *testing.T) {
+	type request struct {
+		event     string
+		signature string
+		body      string
+	}
+
+	var received []request
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = append(received, request{r.Header.Get(EventHeader), r.Header.Get(SignatureHeader), string(body)})
+	}))
+	defer ok.Close()
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	n := &Notifier{URLs: []string{failing.URL, ok.URL}, Secret: "s3cret"}
+	err := n.Notify("snippet.published", map[string]int{"id": 1})
+
+	// The URL after the failing one is still notified.
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("want a 503 error; got %v", err)
+	}
+
+	if len(received) != 1 {
+		t.Fatalf("want 1 request; got %d", len(received))
+	}
+
+	want := request{"snippet.published", Sign("s3cret", []byte(`{"id":1}`)), `{"id":1}`}
+	if received[0] != want {
+		t.Errorf("want %+v; got %+v", want, received[0])
+	}
+}
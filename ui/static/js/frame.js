@@ -0,0 +1,8 @@
+// Embedded snippets tell the page showing them how tall they are, so the frame created by the embed.js loader
+// fits them. Only the height is sent, it can go to any page.
+function reportHeight() {
+	window.parent.postMessage({snippetbox: "resize", height: document.documentElement.scrollHeight}, "*");
+}
+
+window.addEventListener("load", reportHeight);
+window.addEventListener("resize", reportHeight);
@@ -5,4 +5,86 @@ for (var i = 0; i < navLinks.length; i++) {
 		link.classList.add("live");
 		break;
 	}
-}
\ No newline at end of file
+}
+
+// Snippet lines can be selected by their number: a click selects a line, a shift-click extends the selection
+// to a range of lines of the same file. The selection is kept in the URL fragment, ex: #F1-L12 or #F1-L12-L20,
+// and fills in the lines of the comment form. Fragments without a file, ex: #L12, select lines of the first file.
+var lineRange = /^#(?:F(\d+)-)?L(\d+)(?:-L(\d+))?$/;
+
+function selectedLines() {
+	var match = lineRange.exec(window.location.hash);
+	if (!match) {
+		return null;
+	}
+	var file = match[1] ? parseInt(match[1], 10) : 1;
+	var start = parseInt(match[2], 10);
+	var end = match[3] ? parseInt(match[3], 10) : start;
+	return {file: file, start: Math.min(start, end), end: Math.max(start, end)};
+}
+
+function highlightLines() {
+	var lines = selectedLines();
+	var tables = document.querySelectorAll("table.lines");
+	for (var i = 0; i < tables.length; i++) {
+		var file = parseInt(tables[i].getAttribute("data-file"), 10);
+		var rows = tables[i].querySelectorAll("tr");
+		for (var j = 0; j < rows.length; j++) {
+			var number = j + 1;
+			if (lines && file == lines.file && number >= lines.start && number <= lines.end) {
+				rows[j].classList.add("selected");
+			} else {
+				rows[j].classList.remove("selected");
+			}
+		}
+	}
+
+	var form = document.getElementById("comment-form");
+	if (lines && form) {
+		form.elements["line_file"].value = lines.file;
+		form.elements["line_start"].value = lines.start;
+		form.elements["line_end"].value = lines.end;
+	}
+}
+
+var lineLinks = document.querySelectorAll("table.lines td.line-number a");
+for (var i = 0; i < lineLinks.length; i++) {
+	lineLinks[i].addEventListener("click", function (event) {
+		var lines = selectedLines();
+		var file = parseInt(this.closest("table.lines").getAttribute("data-file"), 10);
+		if (!event.shiftKey || !lines || lines.file != file) {
+			return;
+		}
+
+		// Extend the current selection instead of replacing it.
+		event.preventDefault();
+		var number = parseInt(this.textContent, 10);
+		var start = Math.min(lines.start, number);
+		var end = Math.max(lines.end, number);
+		if (number > lines.start && number < lines.end) {
+			start = lines.start;
+			end = number;
+		}
+		var anchor = "#F" + file + "-L" + start;
+		if (start != end) {
+			anchor += "-L" + end;
+		}
+		history.replaceState(null, "", anchor);
+		highlightLines();
+	});
+}
+
+window.addEventListener("hashchange", highlightLines);
+if (lineLinks.length > 0) {
+	highlightLines();
+	var lines = selectedLines();
+	var first = lines && document.getElementById("F" + lines.file + "-L" + lines.start);
+	if (first) {
+		// The source of rendered files, like Markdown documents, is folded away.
+		var source = first.closest("details");
+		if (source) {
+			source.open = true;
+		}
+		first.scrollIntoView();
+	}
+}